@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*********************Policy administration, list, add, remove and check the casbin rules****************************/
+
+// Policy types of tenants.conf
+const (
+	PolicyTypeP = "p" //sub, dom, obj, act
+	PolicyTypeG = "g" //user, role, dom
+)
+
+// ErrInvalidRule a rule of the admin api does not fit its policy type
+var ErrInvalidRule = errors.New("rule should be [sub, dom, obj, act] of p or [user, role, dom] of g")
+
+// PolicyRule one p or g rule of tenants.csv
+type PolicyRule struct {
+	PType string   `json:"ptype"`
+	Rule  []string `json:"rule"`
+}
+
+// PolicyFilter the rules to list, an empty field matches every rule
+type PolicyFilter struct {
+	User   string `json:"user"`   //sub of p, user or role of g
+	Domain string `json:"domain"`
+	Object string `json:"object"` //prefix of obj of p, g rules have no object
+}
+
+//check a rule before it is added, every field is needed
+func checkRule(ptype string, rule []string) error {
+	size := 4
+	if ptype == PolicyTypeG {
+		size = 3
+	} else if ptype != PolicyTypeP {
+		return errors.Wrapf(ErrInvalidRule, "ptype %q", ptype)
+	}
+
+	if len(rule) != size {
+		return errors.Wrapf(ErrInvalidRule, "%d fields", len(rule))
+	}
+
+	for _, field := range rule {
+		if field == "" {
+			return errors.Wrap(ErrInvalidRule, "empty field")
+		}
+	}
+
+	return nil
+}
+
+func (f PolicyFilter) match(ptype string, rule []string) bool {
+	if ptype == PolicyTypeP {
+		return (f.User == "" || rule[0] == f.User) &&
+			(f.Domain == "" || rule[1] == f.Domain) &&
+			strings.HasPrefix(rule[2], f.Object)
+	}
+
+	return (f.User == "" || rule[0] == f.User || rule[1] == f.User) &&
+		(f.Domain == "" || rule[2] == f.Domain) &&
+		f.Object == ""
+}
+
+//the p and g rules matching the filter, p rules first
+func filterPolicies(policies [][]string, groupings [][]string, filter PolicyFilter) []PolicyRule {
+	rules := []PolicyRule{}
+
+	for _, rule := range policies {
+		if len(rule) == 4 && filter.match(PolicyTypeP, rule) {
+			rules = append(rules, PolicyRule{PType: PolicyTypeP, Rule: rule})
+		}
+	}
+
+	for _, rule := range groupings {
+		if len(rule) == 3 && filter.match(PolicyTypeG, rule) {
+			rules = append(rules, PolicyRule{PType: PolicyTypeG, Rule: rule})
+		}
+	}
+
+	return rules
+}
+
+//administrators are set by the admins of the config
+func (m Manager) isAdmin(user string) bool {
+	for _, admin := range m.config.Admins {
+		if admin == user {
+			return true
+		}
+	}
+
+	return false
+}
+
+//the rights of an admin are given to the caller proven by a token or signature, never to the user of a body
+func verifiedCaller(workerCtx *WorkerContext, user string, domain string) bool {
+	identity, ok := identityOf(workerCtx.workerRequest.GinContext)
+
+	return ok && identity.User == user && identity.Domain == domain
+}
+
+//list, add, remove or check rules, only an administrator may call it
+func (m Manager) alluxioPolicyAdmin (workerCtx *WorkerContext) ([]PolicyRule, *bool, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	ptype     := webRequst.PType
+	rule      := webRequst.Rule
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	if ptype == "" {
+		ptype = PolicyTypeP
+	}
+
+	logger.Infof("User:%s, domain:%s will %s policy %s %v", user, domain, workerCtx.workerRequest.Type, ptype, rule)
+
+	//a domain admin is limited to the rules of its domain
+	scope := ""
+	verified := verifiedCaller(workerCtx, user, domain)
+
+	if verified && m.isAdmin(user) {
+		logger.Infof("User:%s, domain:%s was permitted to administer policies", user, domain)
+	} else if verified && m.isDomainAdmin(user, domain) {
+		logger.Infof("User:%s, domain:%s was permitted to administer policies of its domain", user, domain)
+		scope = domain
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to administer policies", user, domain)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return nil, nil, baseResp
+	}
+
+	if workerCtx.workerRequest.Type == RequestPolicyList {
+		filter := webRequst.Filter
+		if scope != "" {
+			filter.Domain = scope
+		}
+
+		rules := filterPolicies(m.rbact.GetPolicy(), m.rbact.GetGroupingPolicy(), filter)
+
+		logger.Infof("User:%s, domain:%s listed %d rules with filter %+v", user, domain, len(rules), filter)
+		return rules, nil, baseResp
+	}
+
+	err := checkRule(ptype, rule)
+
+	if err == nil && workerCtx.workerRequest.Type == RequestPolicyCheck && ptype != PolicyTypeP {
+		err = errors.Wrap(ErrInvalidRule, "only a p rule can be checked")
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeFailedToParseBody
+		baseResp.ErrInfo = ErrInfoFailedToParseBody
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		return nil, nil, baseResp
+	}
+
+	if scope != "" {
+		err = checkDomainRule(ptype, rule, scope, m.config.DomainAdminRole)
+
+		if err != nil {
+			logger.Infof("User:%s, domain:%s was denied to %s %v: %s", user, domain, workerCtx.workerRequest.Type, rule, err)
+			baseResp.ErrCode = ErrCodeUserDeny
+			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+			return nil, nil, baseResp
+		}
+	}
+
+	params := make([]interface{}, len(rule))
+	for i, field := range rule {
+		params[i] = field
+	}
+
+	var changed bool
+
+	switch {
+	case workerCtx.workerRequest.Type == RequestPolicyCheck:
+		allowed := m.rbact.Enforce(params...)
+
+		logger.Infof("User:%s, domain:%s checked %v, allowed %v", user, domain, rule, allowed)
+		return nil, &allowed, baseResp
+
+	case workerCtx.workerRequest.Type == RequestPolicyAdd && ptype == PolicyTypeP:
+		changed = m.rbact.AddPolicy(params...)
+	case workerCtx.workerRequest.Type == RequestPolicyAdd:
+		changed = m.rbact.AddGroupingPolicy(params...)
+	case ptype == PolicyTypeP:
+		changed = m.rbact.RemovePolicy(params...)
+		if changed {
+			err = m.shares.remove([][]string{rule})
+		}
+	default:
+		changed = m.rbact.RemoveGroupingPolicy(params...)
+	}
+
+	if !changed {
+		baseResp.ErrCode = ErrCodePolicyFail
+		baseResp.ErrInfo = ErrInfoPolicyFail
+		baseResp.MoreInfo = fmt.Sprintf("%s rule %v exists already or is not found", ptype, rule)
+		logger.Infof("User:%s, domain:%s changed nothing by %s %v", user, domain, ptype, rule)
+		return nil, nil, baseResp
+	}
+
+	if err == nil {
+		err = m.rbact.SavePolicy()
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodePolicyFail
+		baseResp.ErrInfo = ErrInfoPolicyFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Save policies fail: %+v", err)
+		return nil, nil, baseResp
+	}
+
+	logger.Infof("User:%s, domain:%s did %s of %s rule %v", user, domain, workerCtx.workerRequest.Type, ptype, rule)
+
+	return nil, nil, baseResp
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func TestCheckRule(t *testing.T) {
+	assert.NoError(t, checkRule(PolicyTypeP, []string{"user1", "domain1", "/domain1/user1/*", "*"}))
+	assert.NoError(t, checkRule(PolicyTypeG, []string{"user1", "superAdmin", "domain1"}))
+
+	for _, rule := range []PolicyRule{
+		{PType: "x", Rule: []string{"user1", "superAdmin", "domain1"}},
+		{PType: PolicyTypeP, Rule: []string{"user1", "superAdmin", "domain1"}},
+		{PType: PolicyTypeG, Rule: []string{"user1", "domain1", "/domain1/*", "*"}},
+		{PType: PolicyTypeG, Rule: []string{"user1", "", "domain1"}},
+	} {
+		assert.Equal(t, ErrInvalidRule, errors.Cause(checkRule(rule.PType, rule.Rule)), "%v", rule)
+	}
+}
+
+func TestFilterPolicies(t *testing.T) {
+	policies := [][]string{
+		{"superAdmin", "domain1", "/domain1/*", "*"},
+		{"user1", "domain1", "/domain1/user1/*", "*"},
+		{"user2", "domain1", "/domain1/user2/*", "*"},
+		{"domain3", "domain3", "/domain3/*", "*"},
+	}
+	groupings := [][]string{
+		{"user1", "user1", "domain1"},
+		{"user2", "superAdmin", "domain1"},
+	}
+
+	assert.Len(t, filterPolicies(policies, groupings, PolicyFilter{}), 6)
+
+	assert.Equal(t, []PolicyRule{
+		{PType: PolicyTypeP, Rule: policies[0]},
+		{PType: PolicyTypeG, Rule: groupings[1]},
+	}, filterPolicies(policies, groupings, PolicyFilter{User: "superAdmin"}))
+
+	assert.Equal(t, []PolicyRule{
+		{PType: PolicyTypeP, Rule: policies[1]},
+	}, filterPolicies(policies, groupings, PolicyFilter{Domain: "domain1", Object: "/domain1/user1/"}))
+
+	assert.Equal(t, []PolicyRule{
+		{PType: PolicyTypeP, Rule: policies[3]},
+	}, filterPolicies(policies, groupings, PolicyFilter{Domain: "domain3"}))
+}
+
+func TestAdminNeedsIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-admin")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := newAccountStore(filepath.Join(dir, "service-accounts.json"), 5*time.Minute)
+	assert.NoError(t, err)
+	account, err := store.create("root", "domain1", false)
+	assert.NoError(t, err)
+
+	//jwt and oidc are off, the /auth api trusts the body but /admin does not
+	m := Manager{accounts: store, logger: logp.NewLogger("admin"), config: DefaultConfig()}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/admin/policy/add", m.authenticate(), m.requireIdentity(), func(c *gin.Context) {
+		identity, _ := identityOf(c)
+		c.String(http.StatusOK, identity.User+"@"+identity.Domain)
+	})
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	req := httptest.NewRequest("POST", "/admin/policy/add", strings.NewReader(`{"user":"root","domain":"domain1"}`))
+	req.Header.Set("Content-Type", ContentTypeJSON)
+	assert.Equal(t, http.StatusUnauthorized, serve(req).Code)
+
+	w := serve(signedRequest(account, "POST", "/admin/policy/add", `{"user":"root","domain":"domain1"}`, "n1", time.Now()))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "root@domain1", w.Body.String())
+}
+
+func TestLogLevelNeedsAdmin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-admin")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := newAccountStore(filepath.Join(dir, "service-accounts.json"), 5*time.Minute)
+	assert.NoError(t, err)
+	root, err := store.create("root", "domain1", false)
+	assert.NoError(t, err)
+	tenant, err := store.create("user1", "domain1", false)
+	assert.NoError(t, err)
+
+	m := Manager{accounts: store, logger: logp.NewLogger("admin"), config: DefaultConfig()}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/auth/log-level", m.authenticate(), m.requireIdentity(), m.requireAdmin(), func(c *gin.Context) {
+		c.String(http.StatusOK, "level")
+	})
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	//a caller naming root in the query is not root
+	assert.Equal(t, http.StatusUnauthorized, serve(httptest.NewRequest("GET", "/auth/log-level?user=root&domain=domain1", nil)).Code)
+
+	//a tenant proven by its signature is not an admin either
+	assert.Equal(t, http.StatusForbidden, serve(signedRequest(tenant, "GET", "/auth/log-level", "", "n1", time.Now())).Code)
+
+	assert.Equal(t, http.StatusOK, serve(signedRequest(root, "GET", "/auth/log-level", "", "n2", time.Now())).Code)
+}
@@ -8,11 +8,10 @@ import (
 	"hexmeet.com/haishen/tuna/utils"
 	"net/http"
 	"time"
-	"github.com/Alluxio/alluxio-go/option"
+	"io"
 	"io/ioutil"
 	"strings"
-    "strconv"
-	"github.com/Alluxio/alluxio-go/wire"
+	"strconv"
 )
 /*********************Role-Based Access Control of Tenants****************************/
 
@@ -23,15 +22,59 @@ type AlluxioWebRequest struct {
 	NewName   string       `json:"new_name"`
 	FileID    string       `json:"token_id"`    //the file handle
 	Body      string       `json:"content"`
-	Size      string       `json:"size"`        //default is 1G , xxM or xxG or xxT
+	StorageClass string    `json:"storage_class"` //cache, standard, archive or async, default is set by domain
+	TTL       int64        `json:"ttl"`         //seconds after creation, default is set by domain, negative is no ttl
+	TTLAction string       `json:"ttl_action"`  //delete or free, default is delete
+	Size      string       `json:"size"`        //quota of allocate-res and set-quota, default is 1G , xxM or xxG or xxT
+	SessionID string       `json:"session_id"`  //resumable upload session
+	Length    int64        `json:"length"`      //total bytes of a resumable upload
+	Method    string       `json:"method"`      //GET or PUT of presign, default is GET
+	Expires   int64        `json:"expires"`     //seconds a presigned url is valid
+	Recursive bool         `json:"recursive"`   //list sub directories too, or pin, unpin and free them
+	Prefix    string       `json:"prefix"`      //only list paths starting with it
+	Cursor    string       `json:"cursor"`      //next_cursor of the previous page
+	Limit     int          `json:"limit"`       //entries of a page
+	SrcUser   string       `json:"src_user"`    //owner of the source of copy-file or move-file, default is user
+	SrcDomain string       `json:"src_domain"`
+	DstUser   string       `json:"dst_user"`    //owner of the destination, default is user
+	DstDomain string       `json:"dst_domain"`
+	Owner     string       `json:"owner"`       //owner of a file shared to the user, default is user
+	OwnerDomain string     `json:"owner_domain"`
+	Grantee   string       `json:"grantee"`     //a user, role:<role> or domain:<domain> of share and unshare
+	GranteeDomain string   `json:"grantee_domain"` //domain of a user or role grantee, default is domain
+	Access    string       `json:"access"`      //read or write of share, default is read
+	PType     string       `json:"ptype"`       //p or g rule of the policy admin api, default is p
+	Rule      []string     `json:"rule"`        //the rule to add, remove or check
+	Filter    PolicyFilter `json:"filter"`      //the rules to list
+	Account   ServiceAccount `json:"account"`   //service account to create or remove
+	Trash     string       `json:"trash"`       //<user>-<unix seconds> of restore-res and purge-res, default is the latest
+	Tenant    string       `json:"tenant"`      //user of the domain a domain admin provisions, deprovisions or reports on
+	From      string       `json:"from"`        //first day of the usage of a domain admin, default is 29 days before to
+	To        string       `json:"to"`          //last day of the usage, default is today
 	ClientIP  string
 }
 
 type AlluxioWebResponse struct {
 	GUID      string       `json:"guid"`
 	BaseResponse
-	FileID    string       //`json:"token_id"`    //the file handle
-	Body      string       //`json:"content"`    //files content
+	FileID    string       `json:"token_id,omitempty"`    //the file handle
+	Body      string       `json:"content,omitempty"`     //files content
+	Files     []UploadFileResult `json:"files,omitempty"` //result of each file of upload-file
+	SessionID string       `json:"session_id,omitempty"`  //resumable upload session
+	Offset    *int64       `json:"offset,omitempty"`      //bytes received by the upload session
+	Length    int64        `json:"length,omitempty"`
+	Entries   []FileEntry  `json:"entries,omitempty"`     //listing of a folder
+	NextCursor string      `json:"next_cursor,omitempty"` //set when there are more entries
+	Stat      *FileStat    `json:"stat,omitempty"`        //metadata of a file or folder
+	Quota     *QuotaUsage  `json:"quota,omitempty"`       //usage against the quota
+	URL       string       `json:"url,omitempty"`         //presigned url
+	ExpiresAt int64        `json:"expires_at,omitempty"`  //unix seconds the presigned url expires at
+	Shares    []ShareEntry `json:"shares,omitempty"`      //shared-with-me and shared-by-me
+	Policies  []PolicyRule `json:"policies,omitempty"`    //rules of the policy admin api
+	Allowed   *bool        `json:"allowed,omitempty"`     //result of a policy check
+	Accounts  []ServiceAccount `json:"accounts,omitempty"` //service accounts, the secret only when created
+	Trash     string       `json:"trash,omitempty"`       //where free-res moved the tenant, or the trash restored or purged
+	Tenants   []TenantUsage `json:"tenants,omitempty"`    //usage of the domain of a domain admin
 }
 
 func (r *AlluxioWebRequest) webRequestParamCheck() error {
@@ -75,6 +118,17 @@ func (m Manager) alluxioRestCall(c *gin.Context) {
 			return
 		}
 
+		//the user and domain of a token or service account win over the body, a body naming somebody else is refused
+		if identity, ok := identityOf(c); ok {
+			err = bindIdentity(identity, &inReq.RbactBaseRequest)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, BaseResponse{ErrCode: ErrCodeUnauthorized,
+					ErrInfo: ErrInfoUnauthorized,
+					MoreInfo: fmt.Sprintf("Err: %s", err)})
+				return
+			}
+		}
+
 		err = inReq.webRequestParamCheck()
 		if err != nil {
 			c.JSON(http.StatusBadRequest, BaseResponse{ErrCode: ErrCodeFailedToParseBody,
@@ -86,14 +140,26 @@ func (m Manager) alluxioRestCall(c *gin.Context) {
 
 	} else {
 
+		//the query names the tenant of a raw body, a token or signature must agree with it,
+		//the multipart fields of upload-file are checked against the token or signature by the handler
+		inReq.User = c.Query("user")
+		inReq.Domain = c.Query("domain")
+
+		if identity, ok := identityOf(c); ok {
+			err := bindIdentity(identity, &inReq.RbactBaseRequest)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, BaseResponse{ErrCode: ErrCodeUnauthorized,
+					ErrInfo: ErrInfoUnauthorized,
+					MoreInfo: fmt.Sprintf("Err: %s", err)})
+				return
+			}
+		}
+
 		timeoutChan = time.After(time.Duration(m.config.ReqTimeout) * time.Minute)
 
 	}
 
 	inReq.ClientIP = c.ClientIP()
-	guid := utils.NewUUID()
-	rspChan := make(chan interface{})
-	doneChan := make(chan bool)
 
 	var requestType string
 
@@ -102,15 +168,87 @@ func (m Manager) alluxioRestCall(c *gin.Context) {
 		requestType = RequestAlluxioCreateUser
 	case "/free-res" :
 		requestType = RequestAlluxioDeleteUser
+	case "/set-quota" :
+		requestType = RequestAlluxioSetQuota
+	case "/restore-res" :
+		requestType = RequestAlluxioRestoreUser
+	case "/purge-res" :
+		requestType = RequestAlluxioPurgeUser
+	case "/admin/policy/list" :
+		requestType = RequestPolicyList
+	case "/admin/policy/add" :
+		requestType = RequestPolicyAdd
+	case "/admin/policy/remove" :
+		requestType = RequestPolicyRemove
+	case "/admin/policy/check" :
+		requestType = RequestPolicyCheck
+	case "/service-account/create" :
+		requestType = RequestInternalAccountCreate
+	case "/admin/service-account/create" :
+		requestType = RequestServiceAccountCreate
+	case "/admin/service-account/remove" :
+		requestType = RequestServiceAccountRemove
+	case "/admin/service-account/list" :
+		requestType = RequestServiceAccountList
+	case "/admin/domain/allocate-res" :
+		requestType = RequestDomainCreateUser
+	case "/admin/domain/free-res" :
+		requestType = RequestDomainDeleteUser
+	case "/admin/domain/usage" :
+		requestType = RequestDomainUsage
+	case "/auth/quota" :
+		requestType = RequestAlluxioQuota
+	case "/auth/set-ttl" :
+		requestType = RequestAlluxioSetTTL
+	case "/auth/presign" :
+		requestType = RequestAlluxioPresign
+	case "/auth/share" :
+		requestType = RequestAlluxioShare
+	case "/auth/unshare" :
+		requestType = RequestAlluxioUnshare
+	case "/auth/shared-with-me" :
+		requestType = RequestAlluxioSharedWithMe
+	case "/auth/shared-by-me" :
+		requestType = RequestAlluxioSharedByMe
+	case "/auth/pin" :
+		requestType = RequestAlluxioPin
+	case "/auth/unpin" :
+		requestType = RequestAlluxioUnpin
+	case "/auth/free" :
+		requestType = RequestAlluxioFree
+	case "/auth/preload" :
+		requestType = RequestAlluxioPreload
 	case "/auth/delete-file" :
 		requestType = RequestAlluxioDeleteFile
 	case "/auth/rename-file" :
 		requestType = RequestAlluxioRenameFile
+	case "/auth/copy-file" :
+		requestType = RequestAlluxioCopyFile
+	case "/auth/move-file" :
+		requestType = RequestAlluxioMoveFile
 	case "/auth/upload-file" :
 		requestType = RequestAlluxioUploadFile
 	case "/auth/read-file"   :
 		requestType = RequestAlluxioReadFile
-	/************following cases were not used******************/
+	case "/auth/create-dir" :
+		requestType = RequestAlluxioCreateDir
+	case "/auth/remove-dir" :
+		requestType = RequestAlluxioRemoveDir
+	case "/auth/list" :
+		requestType = RequestAlluxioList
+	case "/auth/stat" :
+		requestType = RequestAlluxioStat
+	case "/auth/upload-session/create" :
+		requestType = RequestUploadSessionCreate
+	case "/auth/upload-session/chunk" :
+		requestType = RequestUploadSessionChunk
+	case "/auth/upload-session/offset" :
+		requestType = RequestUploadSessionOffset
+	case "/auth/upload-session/finish" :
+		requestType = RequestUploadSessionFinish
+	case "/auth/upload-session/abort" :
+		requestType = RequestUploadSessionAbort
+	/************the handle api******************/
 	case "/auth/open-file" :
 		requestType = RequestAlluxioOpenFile
 	case "/auth/read-content" :
@@ -129,6 +267,23 @@ func (m Manager) alluxioRestCall(c *gin.Context) {
 		return
 	}
 
+	//a download, a copy or finishing an upload session is streamed by the worker, it may last much longer than a json request
+	if requestType == RequestAlluxioReadFile || requestType == RequestUploadSessionFinish ||
+		requestType == RequestAlluxioCopyFile || requestType == RequestAlluxioMoveFile {
+		timeoutChan = time.After(time.Duration(m.config.ReqTimeout) * time.Minute)
+	}
+
+	m.dispatchRequest(c, requestType, inReq, timeoutChan)
+}
+
+//hand the request to a worker and send its response, a download is answered by the worker itself
+func (m Manager) dispatchRequest(c *gin.Context, requestType string, inReq AlluxioWebRequest, timeoutChan <-chan time.Time) {
+	logger := m.logger.Named("alluxio")
+
+	guid := utils.NewUUID()
+	rspChan := make(chan interface{})
+	doneChan := make(chan bool)
+
 	workerReq := WorkerRequest{Type: requestType,
 		GUID:         guid,
 		GinContext:   c,
@@ -188,6 +343,21 @@ func (m Manager)alluxioWorkerHandle (workerCtx *WorkerContext) {
 
 	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
 	fileID    := ""
+	body      := ""
+	var files []UploadFileResult
+	var session *UploadSession
+	var entries []FileEntry
+	var stat *FileStat
+	var quota *QuotaUsage
+	nextCursor := ""
+	presigned  := ""
+	var shares []ShareEntry
+	var policies []PolicyRule
+	var allowed *bool
+	var accounts []ServiceAccount
+	expiresAt  := int64(0)
+	trash      := ""
+	var tenants []TenantUsage
 
 	switch workerCtx.workerRequest.Type {
 	case RequestAlluxioCreateUser :
@@ -204,7 +374,8 @@ func (m Manager)alluxioWorkerHandle (workerCtx *WorkerContext) {
 	case RequestAlluxioDeleteUser :
 		logger.Infof("Guid:%s, begin to handle create usr info", workerCtx.workerRequest.GUID)
 
-		err := m.alluxioDeleteUser(workerCtx)
+		var err error
+		trash, err = m.alluxioDeleteUser(workerCtx)
 
 		if err != nil {
 			baseResp.ErrCode = ErrCodeDeleteResFail
@@ -212,6 +383,77 @@ func (m Manager)alluxioWorkerHandle (workerCtx *WorkerContext) {
 			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
 		}
 
+	case RequestAlluxioRestoreUser, RequestAlluxioPurgeUser :
+		logger.Infof("Guid:%s, begin to handle %s", workerCtx.workerRequest.GUID, workerCtx.workerRequest.Type)
+
+		var err error
+		if workerCtx.workerRequest.Type == RequestAlluxioRestoreUser {
+			trash, err = m.alluxioRestoreUser(workerCtx)
+		} else {
+			trash, err = m.alluxioPurgeUser(workerCtx)
+		}
+
+		if err != nil {
+			baseResp.ErrCode = ErrCodeTrashFail
+			baseResp.ErrInfo = ErrInfoTrashFail
+			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		}
+
+	case RequestAlluxioSetQuota :
+		logger.Infof("Guid:%s, begin to handle set quota", workerCtx.workerRequest.GUID)
+
+		baseResp = m.alluxioSetQuota(workerCtx)
+
+	case RequestPolicyList, RequestPolicyAdd, RequestPolicyRemove, RequestPolicyCheck :
+		logger.Infof("Guid:%s, begin to handle %s", workerCtx.workerRequest.GUID, workerCtx.workerRequest.Type)
+
+		policies, allowed, baseResp = m.alluxioPolicyAdmin(workerCtx)
+
+	case RequestServiceAccountCreate, RequestServiceAccountRemove, RequestServiceAccountList, RequestInternalAccountCreate :
+		logger.Infof("Guid:%s, begin to handle %s", workerCtx.workerRequest.GUID, workerCtx.workerRequest.Type)
+
+		accounts, baseResp = m.alluxioServiceAccount(workerCtx)
+
+	case RequestDomainCreateUser, RequestDomainDeleteUser, RequestDomainUsage :
+		logger.Infof("Guid:%s, begin to handle %s", workerCtx.workerRequest.GUID, workerCtx.workerRequest.Type)
+
+		tenants, trash, baseResp = m.alluxioDomainAdmin(workerCtx)
+
+	case RequestAlluxioQuota :
+		logger.Infof("Guid:%s, begin to handle quota", workerCtx.workerRequest.GUID)
+
+		quota, baseResp = m.alluxioQuota(workerCtx)
+
+	case RequestAlluxioSetTTL :
+		logger.Infof("Guid:%s, begin to handle set ttl", workerCtx.workerRequest.GUID)
+
+		baseResp = m.alluxioSetTTL(workerCtx)
+
+	case RequestAlluxioPresign :
+		logger.Infof("Guid:%s, begin to handle presign", workerCtx.workerRequest.GUID)
+
+		presigned, expiresAt, baseResp = m.alluxioPresign(workerCtx)
+
+	case RequestPresignedPut :
+		logger.Infof("Guid:%s, begin to handle presigned put", workerCtx.workerRequest.GUID)
+
+		files, baseResp = m.alluxioPresignedPut(workerCtx)
+
+	case RequestAlluxioShare, RequestAlluxioUnshare :
+		logger.Infof("Guid:%s, begin to handle %s", workerCtx.workerRequest.GUID, workerCtx.workerRequest.Type)
+
+		baseResp = m.alluxioShare(workerCtx)
+
+	case RequestAlluxioSharedWithMe, RequestAlluxioSharedByMe :
+		logger.Infof("Guid:%s, begin to handle %s", workerCtx.workerRequest.GUID, workerCtx.workerRequest.Type)
+
+		shares, baseResp = m.alluxioListShares(workerCtx)
+
+	case RequestAlluxioPin, RequestAlluxioUnpin, RequestAlluxioFree, RequestAlluxioPreload :
+		logger.Infof("Guid:%s, begin to handle cache control %s", workerCtx.workerRequest.GUID, workerCtx.workerRequest.Type)
+
+		baseResp = m.alluxioCacheControl(workerCtx)
+
 	case RequestAlluxioDeleteFile :
 		logger.Infof("Guid:%s, begin to handle delete file", workerCtx.workerRequest.GUID)
 
@@ -222,15 +464,68 @@ func (m Manager)alluxioWorkerHandle (workerCtx *WorkerContext) {
 		logger.Infof("Guid:%s, begin to handle rename file", workerCtx.workerRequest.GUID)
 
 		baseResp = m.alluxioRenameFile(workerCtx)
+	case RequestAlluxioCopyFile :
+		logger.Infof("Guid:%s, begin to handle copy file", workerCtx.workerRequest.GUID)
+
+		baseResp = m.alluxioCopyFile(workerCtx)
+	case RequestAlluxioMoveFile :
+		logger.Infof("Guid:%s, begin to handle move file", workerCtx.workerRequest.GUID)
+
+		baseResp = m.alluxioMoveFile(workerCtx)
 	case RequestAlluxioUploadFile:
 		logger.Infof("Guid:%s, begin to handle upload file", workerCtx.workerRequest.GUID)
 
-		baseResp = m.alluxioUploadFile(workerCtx)
+		files, baseResp = m.alluxioUploadFile(workerCtx)
 	case RequestAlluxioReadFile :
 		logger.Infof("Guid:%s, begin to handle read file", workerCtx.workerRequest.GUID)
 		m.alluxioReadFile(workerCtx)
 
-	/*****************following cases were not used*********************/
+	case RequestAlluxioCreateDir :
+		logger.Infof("Guid:%s, begin to handle create directory", workerCtx.workerRequest.GUID)
+
+		baseResp = m.alluxioCreateDir(workerCtx)
+
+	case RequestAlluxioRemoveDir :
+		logger.Infof("Guid:%s, begin to handle remove directory", workerCtx.workerRequest.GUID)
+
+		baseResp = m.alluxioRemoveDir(workerCtx)
+
+	case RequestAlluxioList :
+		logger.Infof("Guid:%s, begin to handle list", workerCtx.workerRequest.GUID)
+
+		entries, nextCursor, baseResp = m.alluxioList(workerCtx)
+
+	case RequestAlluxioStat :
+		logger.Infof("Guid:%s, begin to handle stat", workerCtx.workerRequest.GUID)
+
+		stat, baseResp = m.alluxioStat(workerCtx)
+
+	case RequestUploadSessionCreate :
+		logger.Infof("Guid:%s, begin to handle create upload session", workerCtx.workerRequest.GUID)
+
+		session, baseResp = m.uploadSessionCreate(workerCtx)
+
+	case RequestUploadSessionChunk :
+		logger.Infof("Guid:%s, begin to handle upload session chunk", workerCtx.workerRequest.GUID)
+
+		session, baseResp = m.uploadSessionChunk(workerCtx)
+
+	case RequestUploadSessionOffset :
+		logger.Infof("Guid:%s, begin to handle upload session offset", workerCtx.workerRequest.GUID)
+
+		session, baseResp = m.uploadSessionOffset(workerCtx)
+
+	case RequestUploadSessionFinish :
+		logger.Infof("Guid:%s, begin to handle finish upload session", workerCtx.workerRequest.GUID)
+
+		session, baseResp = m.uploadSessionFinish(workerCtx)
+
+	case RequestUploadSessionAbort :
+		logger.Infof("Guid:%s, begin to handle abort upload session", workerCtx.workerRequest.GUID)
+
+		session, baseResp = m.uploadSessionAbort(workerCtx)
+
+	/*****************the handle api*********************/
 
 	case RequestAlluxioOpenFile   :
 		logger.Infof("Guid:%s, begin to handle open file", workerCtx.workerRequest.GUID)
@@ -240,7 +535,7 @@ func (m Manager)alluxioWorkerHandle (workerCtx *WorkerContext) {
 	case RequestAlluxioReadContent :
 		logger.Infof("Guid:%s, begin to handle read content", workerCtx.workerRequest.GUID)
 
-		//body, baseResp = m.alluxioReadContent(workerCtx)
+		body, baseResp = m.alluxioReadContent(workerCtx)
 
 	case RequestAlluxioCreateFile  :
 		logger.Infof("Guid:%s, begin to handle create file", workerCtx.workerRequest.GUID)
@@ -262,10 +557,33 @@ func (m Manager)alluxioWorkerHandle (workerCtx *WorkerContext) {
 		baseResp.ErrInfo = "the Method is not matched"
 	}
 
+	//what a domain admin does to the users of its domain is audited
+	m.auditDelegated(workerCtx, baseResp)
+
 	rsp = AlluxioWebResponse {
 		BaseResponse: baseResp,
 		GUID  : webRequst.GUID,
 		FileID: fileID,
+		Body  : body,
+		Files : files,
+		Entries: entries,
+		NextCursor: nextCursor,
+		Stat  : stat,
+		Quota : quota,
+		URL   : presigned,
+		ExpiresAt: expiresAt,
+		Shares: shares,
+		Policies: policies,
+		Allowed: allowed,
+		Accounts: accounts,
+		Trash: trash,
+		Tenants: tenants,
+	}
+
+	if session != nil {
+		rsp.SessionID = session.ID
+		rsp.Offset = &session.Offset
+		rsp.Length = session.Length
 	}
 
 	m.workerSendRsp(workerCtx, rsp)
@@ -277,55 +595,118 @@ func (m Manager) alluxioCreateUser (workerCtx *WorkerContext) error {
 	logger := workerCtx.logger
 	user := webRequst.User
 	domain := webRequst.Domain
-	object := ""
+	object, err := resolveTenantRoot(domain, user)
 
-	logger.Infof("User:%s, domain:%s will be created", user, domain)
+	if err != nil {
+		return err
+	}
 
+	//the quota of the user, or of the whole domain when user is the domain
+	limit, err := parseSize(webRequst.Size)
 
-	if user == domain {
-		object = "/" + domain + "/"
-	} else {
-		object = "/" + domain + "/" + user + "/"
+	if err != nil {
+		return err
 	}
 
-	writeType := new(wire.WriteType)
-	*writeType = wire.WriteTypeCacheThrough
+	//a storage class other than the default of the domain is granted to the tenant
+	class := webRequst.StorageClass
+	if class == "" {
+		class = m.defaultStorageClass(domain)
+	}
+
+	if !validStorageClass(class) {
+		return errors.Wrapf(ErrStorageClassUnknown, "storage class %q", class)
+	}
 
-	m.fs.CreateDirectory("/" + domain + "/", &option.CreateDirectory{WriteType: writeType})
+	writeType := storageClassWriteTypes[class]
 
-	m.fs.CreateDirectory(object, &option.CreateDirectory{WriteType: writeType})
+	logger.Infof("User:%s, domain:%s will be created with storage class %s", user, domain, class)
+
+	m.fs.CreateDirectory("/" + domain + "/", &DirectoryOption{WriteType: writeType})
+
+	m.fs.CreateDirectory(object, &DirectoryOption{WriteType: writeType})
 
 	m.rbactInsertPolicy(user, user, domain, object + "*", "*")
 
-	return nil
+	m.grantStorageClass(user, domain, class)
+
+	return m.quotas.set(object, limit)
 }
 
-func (m Manager) alluxioDeleteUser (workerCtx *WorkerContext) error {
+//the files of the tenant are moved to the trash, they are deleted at once only when the trash retention is 0
+func (m Manager) alluxioDeleteUser (workerCtx *WorkerContext) (string, error) {
 	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
 	logger := workerCtx.logger
 	user := webRequst.User
 	domain := webRequst.Domain
-	object := ""
+	object, err := resolveTenantRoot(domain, user)
 
+	if err != nil {
+		return "", err
+	}
 
 	logger.Infof("User:%s, domain:%s will be removed", user, domain)
 
+	//the root of a domain tenant holds the folders of the other users of the domain, they must be freed first
 	if user == domain {
-		object = "/" + domain + "/"
-	} else {
-		object = "/" + domain + "/" + user + "/"
+		statuses, listErr := m.fs.ListStatus(object)
+
+		if listErr != nil && errors.Cause(listErr) != ErrStorageNotFound {
+			return "", listErr
+		}
+
+		for _, status := range statuses {
+			if status.Name != domain {
+				logger.Infof("User:%s, domain:%s still holds %s and is not removed", user, domain, status.Path)
+				return "", errors.Wrapf(ErrTenantNotEmpty, "%s of domain %s", status.Name, domain)
+			}
+		}
 	}
 
-	err := m.fs.Delete(object, &option.Delete{})
+	trash := ""
+
+	if m.config.Internal.TrashRetention > 0 {
+		trash, err = m.trash.move(domain, user, object, time.Now())
+
+		if err == nil {
+			err = m.ttls.rename(object, trash)
+		}
+	} else {
+		err = m.fs.Delete(object, &DeleteOption{})
+
+		if err == nil {
+			err = m.ttls.drop(object)
+		}
+	}
 
 	if err != nil {
 		logger.Infof("User:%s, domain:%s was deleted fail", user, domain)
-		return err
+		return "", err
+	}
+
+	if trash != "" {
+		logger.Infof("User:%s, domain:%s was moved to %s", user, domain, trash)
+	}
+
+	//the rules, shares and quota are kept next to the trash for restore-res
+	state, err := m.revokeShares(object, user, domain)
+	if err != nil {
+		return trash, err
 	}
 
 	m.rbactDeletePolicy(user, user, domain, object + "*", "*")
 
-	return nil
+	m.revokeStorageClasses(user, domain)
+
+	state.Quota, _ = m.quotas.get(object)
+
+	err = m.quotas.remove(object)
+
+	if err == nil && trash != "" {
+		err = m.trash.keep(trash, state)
+	}
+
+	return trash, err
 }
 
 func (m Manager) alluxioDeleteFile (workerCtx *WorkerContext) BaseResponse {
@@ -334,13 +715,18 @@ func (m Manager) alluxioDeleteFile (workerCtx *WorkerContext) BaseResponse {
 	logger    := workerCtx.logger
 	user      := webRequst.User
 	domain    := webRequst.Domain
-	object    := "/" + domain + "/" + user + "/" + webRequst.FileName
+	object, pathErr := resolveRequestObject(webRequst, webRequst.FileName)
 
 	baseResp  := BaseResponse {
 		ErrCode: ErrCodeOk,
 		ErrInfo: ErrInfoOk,
 	}
 
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return baseResp
+	}
+
 	logger.Infof("User:%s, domain:%s will delete %s", user, domain, object)
 
 	if m.rbactCheckRights(user, domain, object, "write") {
@@ -352,12 +738,20 @@ func (m Manager) alluxioDeleteFile (workerCtx *WorkerContext) BaseResponse {
 		return baseResp
 	}
 
-	err := m.fs.Delete(object, &option.Delete{})
+	//the freed bytes are given back to the quotas now, not at the next scan
+	status, statErr := m.fs.GetStatus(object)
+
+	err := m.fs.Delete(object, &DeleteOption{})
 
 	if err != nil {
 		baseResp.ErrCode = ErrCodeDeleteFileFail
 		baseResp.ErrInfo = ErrInfoDeleteFileFail
 		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+	} else {
+		if statErr == nil {
+			m.usage.stored(object, -status.Length)
+		}
+		m.ttls.drop(object)
 	}
 
 	return baseResp
@@ -369,26 +763,45 @@ func (m Manager) alluxioRenameFile (workerCtx *WorkerContext) BaseResponse {
 	logger    := workerCtx.logger
 	user      := webRequst.User
 	domain    := webRequst.Domain
-	object    := "/" + domain + "/" + user + "/" + webRequst.FileName
-	newName   := "/" + domain + "/" + user + "/" + webRequst.NewName
+	object, pathErr := resolveRequestObject(webRequst, webRequst.FileName)
 
 	baseResp  := BaseResponse {
 		ErrCode: ErrCodeOk,
 		ErrInfo: ErrInfoOk,
 	}
 
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return baseResp
+	}
+
+	newName, pathErr := resolveRequestObject(webRequst, webRequst.NewName)
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return baseResp
+	}
+
 	logger.Infof("User:%s, domain:%s will rename %s", user, domain, object)
 
-	if m.rbactCheckRights(user, domain, object, "write") {
-		logger.Infof("User:%s, domain:%s was rename to delete %s", user, domain, object)
+	if m.rbactCheckRights(user, domain, object, "write") && m.rbactCheckRights(user, domain, newName, "write") {
+		logger.Infof("User:%s, domain:%s was permitted to rename %s to %s", user, domain, object, newName)
 	} else {
-		logger.Infof("User:%s, domain:%s was rename to delete %s", user, domain, object)
+		logger.Infof("User:%s, domain:%s was denied to rename %s to %s", user, domain, object, newName)
 		baseResp.ErrCode = ErrCodeUserDeny
 		baseResp.MoreInfo = ErrInfoUserDeny
 		return baseResp
 	}
 
-	err := m.fs.Rename(object, newName, &option.Rename{})
+	err := m.ensureParent(newName)
+
+	if err == nil {
+		err = m.fs.Rename(object, newName)
+	}
+
+	if err == nil {
+		err = m.ttls.rename(object, newName)
+	}
 
 	if err != nil {
 		baseResp.ErrCode = ErrCodeRenameFileFail
@@ -401,119 +814,438 @@ func (m Manager) alluxioRenameFile (workerCtx *WorkerContext) BaseResponse {
 
 
 
-func (m Manager) alluxioUploadFile (workerCtx *WorkerContext) BaseResponse {
+func (m Manager) alluxioCreateDir (workerCtx *WorkerContext) BaseResponse {
 
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
 	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	object, pathErr := resolveRequestObject(webRequst, webRequst.FileName)
 
-	baseResp := BaseResponse {
+	baseResp  := BaseResponse {
 		ErrCode: ErrCodeOk,
 		ErrInfo: ErrInfoOk,
 	}
 
-	err := workerCtx.workerRequest.GinContext.Request.ParseMultipartForm(32 << 10)  //32M
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return baseResp
+	}
+
+	logger.Infof("User:%s, domain:%s will create directory %s", user, domain, object)
+
+	if strings.Trim(webRequst.FileName, "/") == "" {
+		baseResp.ErrCode = ErrCodeFailedToParseBody
+		baseResp.ErrInfo = ErrInfoFailedToParseBody
+		baseResp.MoreInfo = "file_name should be set"
+		return baseResp
+	}
+
+	if m.rbactCheckRights(user, domain, object, "write") {
+		logger.Infof("User:%s, domain:%s was permitted to create directory %s", user, domain, object)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to create directory %s", user, domain, object)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return baseResp
+	}
+
+	writeType, err := m.resolveWriteType(user, domain, webRequst.StorageClass)
 
 	if err != nil {
+		storageClassError(&baseResp, err)
+		return baseResp
+	}
 
-		baseResp.ErrCode = ErrCodeUploadFileFail
-		baseResp.ErrInfo = ErrInfoUploadFileFail
+	ttl, ttlAction, err := m.resolveTTL(domain, webRequst.TTL, webRequst.TTLAction)
+
+	if err != nil {
+		ttlError(&baseResp, err)
+		return baseResp
+	}
+
+	err = m.fs.CreateDirectory(object, &DirectoryOption{
+		WriteType:   writeType,
+		Recursive:   true,
+		AllowExists: true,
+	})
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeCreateDirFail
+		baseResp.ErrInfo = ErrInfoCreateDirFail
 		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
-		logger.Errorf(" Parse multipart form fail: %+v", err)
 		return baseResp
 	}
 
-	form := workerCtx.workerRequest.GinContext.Request.MultipartForm
+	err = m.applyTTL(object, ttl, ttlAction)
+
+	if err != nil {
+		ttlError(&baseResp, err)
+		logger.Errorf("Set ttl of %s fail: %+v", object, err)
+	}
+
+	return baseResp
+}
+
+//the directory must be empty unless recursive is set, the folder of the tenant itself is kept
+func (m Manager) alluxioRemoveDir (workerCtx *WorkerContext) BaseResponse {
+
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	object, pathErr := resolveRequestObject(webRequst, webRequst.FileName)
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return baseResp
+	}
 
-	user := form.Value["user"][0]
-	domain := form.Value["domain"][0]
-	files := form.File["upload"]
-	object    := "/" + domain + "/" + user + "/"
+	logger.Infof("User:%s, domain:%s will remove directory %s, recursive %t", user, domain, object, webRequst.Recursive)
 
+	if strings.Trim(webRequst.FileName, "/") == "" {
+		baseResp.ErrCode = ErrCodeFailedToParseBody
+		baseResp.ErrInfo = ErrInfoFailedToParseBody
+		baseResp.MoreInfo = "file_name should be set"
+		return baseResp
+	}
 
 	if m.rbactCheckRights(user, domain, object, "write") {
-		logger.Infof("User:%s, domain:%s was permitted to create %s", user, domain, object)
+		logger.Infof("User:%s, domain:%s was permitted to remove directory %s", user, domain, object)
 	} else {
-		logger.Infof("User:%s, domain:%s was denied to create %s", user, domain, object)
+		logger.Infof("User:%s, domain:%s was denied to remove directory %s", user, domain, object)
 		baseResp.ErrCode = ErrCodeUserDeny
 		baseResp.MoreInfo = ErrInfoUserDeny
 		return baseResp
 	}
 
-	for i, _ := range files {
-		fileName := files[i].Filename
-		logger.Infof("User:%s, domain:%s will create %s", user, domain, fileName)
+	status, err := m.fs.GetStatus(object)
 
-		file, err := files[i].Open()
+	if err == nil && !status.Folder {
+		err = errors.Errorf("%s is not a directory", object)
+	}
 
-		defer file.Close()
+	if err == nil {
+		err = m.fs.Delete(object, &DeleteOption{Recursive: webRequst.Recursive})
+	}
 
-		if err != nil {
-			baseResp.ErrCode = ErrCodeUploadFileFail
-			baseResp.ErrInfo = ErrInfoUploadFileFail
-			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
-			logger.Errorf("Open source file : %+v", err)
-			return baseResp
-		}
+	if err == nil {
+		err = m.ttls.drop(object)
+	}
 
-		writeType := new(wire.WriteType)
-		*writeType = wire.WriteTypeCacheThrough
+	if err != nil {
+		baseResp.ErrCode = ErrCodeRemoveDirFail
+		baseResp.ErrInfo = ErrInfoRemoveDirFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+	}
 
-		id, err := m.fs.CreateFile(object+fileName, &option.CreateFile{ WriteType: writeType})
-		defer m.fs.Close(id)
+	return baseResp
+}
 
-		if err != nil {
-			baseResp.ErrCode = ErrCodeUploadFileFail
-			baseResp.ErrInfo = ErrInfoUploadFileFail
-			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
-			logger.Errorf("Create destination file fail on alluxio: %+v", err)
-			return baseResp
-		}
+//read the multipart stream part by part, each file is piped straight into the storage,
+//the "user", "domain" and optional "path" and "storage_class" fields must come before the "upload" files
+func (m Manager) alluxioUploadFile (workerCtx *WorkerContext) ([]UploadFileResult, BaseResponse) {
 
-		_, err = m.fs.Write(id, file)
+	logger    := workerCtx.logger
+	results   := []UploadFileResult{}
 
-		if err != nil {
-			baseResp.ErrCode = ErrCodeUploadFileFail
-			baseResp.ErrInfo = ErrInfoUploadFileFail
-			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
-			logger.Errorf("Write destination file fail on alluxio: %+v", err)
-			return baseResp
-		}
+	baseResp := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
 
-		/*save file to local
+	reader, err := workerCtx.workerRequest.GinContext.Request.MultipartReader()
 
-		out, err := os.Create(fileName)
-		defer out.Close()
-		if err != nil {
-			baseResp.ErrCode = ErrCodeUploadFileFail
-			baseResp.ErrInfo = ErrInfoUploadFileFail
-			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
-			return baseResp
+	if err != nil {
+		baseResp.ErrCode = ErrCodeUploadFileFail
+		baseResp.ErrInfo = ErrInfoUploadFileFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf(" Read multipart form fail: %+v", err)
+		return results, baseResp
+	}
+
+	user      := ""
+	domain    := ""
+	dir       := ""
+	class     := ""
+	ttlField  := ""
+	ttlAction := ""
+	object    := ""
+	writeType := ""
+	ttl       := int64(0)
+	failed    := 0
+
+	for {
+		part, err := reader.NextPart()
+
+		if err == io.EOF {
+			break
 		}
 
-		_, err = io.Copy(out, file)
 		if err != nil {
 			baseResp.ErrCode = ErrCodeUploadFileFail
 			baseResp.ErrInfo = ErrInfoUploadFileFail
 			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
-			return baseResp
+			logger.Errorf(" Read multipart part fail: %+v", err)
+			return results, baseResp
+		}
+
+		switch part.FormName() {
+		case "user", "domain", "path", "storage_class", "ttl", "ttl_action":
+			value, err := ioutil.ReadAll(io.LimitReader(part, 1024))
+			part.Close()
+
+			if err != nil {
+				baseResp.ErrCode = ErrCodeUploadFileFail
+				baseResp.ErrInfo = ErrInfoUploadFileFail
+				baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+				return results, baseResp
+			}
+
+			switch part.FormName() {
+			case "user":
+				user = string(value)
+			case "domain":
+				domain = string(value)
+			case "storage_class":
+				class = string(value)
+			case "ttl":
+				ttlField = string(value)
+			case "ttl_action":
+				ttlAction = string(value)
+			default:
+				dir = strings.Trim(string(value), "/")
+			}
+
+		case "upload":
+			if identity, ok := identityOf(workerCtx.workerRequest.GinContext); ok && object == "" {
+				tenant := RbactBaseRequest{User: user, Domain: domain}
+				err = bindIdentity(identity, &tenant)
+				if err != nil {
+					part.Close()
+					baseResp.ErrCode = ErrCodeUnauthorized
+					baseResp.ErrInfo = ErrInfoUnauthorized
+					baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+					return results, baseResp
+				}
+				user, domain = tenant.User, tenant.Domain
+			}
+
+			if user == "" || domain == "" {
+				part.Close()
+				baseResp.ErrCode = ErrCodeFailedToParseBody
+				baseResp.ErrInfo = ErrInfoFailedToParseBody
+				baseResp.MoreInfo = "user and domain must be sent before the files"
+				return results, baseResp
+			}
+
+			if object == "" {
+				object, err = resolveObject(domain, user, dir)
+				if err != nil {
+					part.Close()
+					pathError(&baseResp, err)
+					return results, baseResp
+				}
+
+				if !strings.HasSuffix(object, "/") {
+					object += "/"
+				}
+
+				if m.rbactCheckRights(user, domain, object, "write") {
+					logger.Infof("User:%s, domain:%s was permitted to create %s", user, domain, object)
+				} else {
+					part.Close()
+					logger.Infof("User:%s, domain:%s was denied to create %s", user, domain, object)
+					baseResp.ErrCode = ErrCodeUserDeny
+					baseResp.MoreInfo = ErrInfoUserDeny
+					return results, baseResp
+				}
+
+				writeType, err = m.resolveWriteType(user, domain, class)
+				if err != nil {
+					part.Close()
+					storageClassError(&baseResp, err)
+					return results, baseResp
+				}
+
+				if ttlField != "" {
+					ttl, err = strconv.ParseInt(ttlField, 10, 64)
+					if err != nil {
+						part.Close()
+						baseResp.ErrCode = ErrCodeFailedToParseBody
+						baseResp.ErrInfo = ErrInfoFailedToParseBody
+						baseResp.MoreInfo = fmt.Sprintf("ttl %q should be seconds", ttlField)
+						return results, baseResp
+					}
+				}
+
+				ttl, ttlAction, err = m.resolveTTL(domain, ttl, ttlAction)
+				if err != nil {
+					part.Close()
+					ttlError(&baseResp, err)
+					return results, baseResp
+				}
+
+				err = m.ensureParent(object + "file")
+				if err != nil {
+					part.Close()
+					baseResp.ErrCode = ErrCodeUploadFileFail
+					baseResp.ErrInfo = ErrInfoUploadFileFail
+					baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+					logger.Errorf("Create directory %s fail: %+v", object, err)
+					return results, baseResp
+				}
+			}
+
+			result := m.alluxioUploadStream(workerCtx, object, part.FileName(), part, writeType)
+			part.Close()
+
+			if result.ErrCode == ErrCodeOk {
+				err = m.applyTTL(object + result.FileName, ttl, ttlAction)
+				if err != nil {
+					m.fs.Delete(object + result.FileName, &DeleteOption{})
+					ttlError(&result.BaseResponse, err)
+					logger.Errorf("Set ttl of %s fail: %+v", object + result.FileName, err)
+				}
+			}
+
+			if result.ErrCode != ErrCodeOk {
+				failed++
+			}
+			results = append(results, result)
+
+			m.usage.uploaded(domain, user, result.Size)
+
+		default:
+			part.Close()
 		}
-		*/
 	}
 
-	return baseResp
+	if failed > 0 {
+		baseResp.ErrCode = ErrCodeUploadFileFail
+		baseResp.ErrInfo = ErrInfoUploadFileFail
+		baseResp.MoreInfo = fmt.Sprintf("%d of %d files failed", failed, len(results))
+	}
+
+	return results, baseResp
 }
 
+//pipe one file of the multipart stream or of a presigned put into the storage, a partial file is removed on failure
+func (m Manager) alluxioUploadStream (workerCtx *WorkerContext, object string, fileName string, body io.Reader, writeType string) UploadFileResult {
+	logger   := workerCtx.logger
+	result   := UploadFileResult{
+		FileName: fileName,
+		BaseResponse: BaseResponse{
+			ErrCode: ErrCodeOk,
+			ErrInfo: ErrInfoOk,
+		},
+	}
+
+	//the file name of a part is one segment, sub directories are given by the "path" field
+	name, err := cleanName(fileName)
+
+	if err == nil {
+		err = checkSegment(name)
+	}
+
+	if err != nil {
+		pathError(&result.BaseResponse, err)
+		logger.Infof("File name %q of the upload is rejected: %v", fileName, err)
+		return result
+	}
+
+	//report the name the file is stored as
+	result.FileName = name
+
+	//a tenant without a byte left is refused before the file is created
+	err = m.checkQuota(object + name, 1)
+
+	if err != nil {
+		result.ErrCode = ErrCodeUploadFileFail
+		result.ErrInfo = ErrInfoUploadFileFail
+		if errors.Cause(err) == ErrQuotaExceeded {
+			result.ErrCode = ErrCodeQuotaExceeded
+			result.ErrInfo = ErrInfoQuotaExceeded
+		}
+		result.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Check quota of %s fail: %+v", object+name, err)
+		return result
+	}
+
+	logger.Infof("%s will be created", object+name)
 
+	id, err := m.fs.CreateFile(object+name, &FileOption{WriteType: writeType})
+
+	if err != nil {
+		result.ErrCode = ErrCodeUploadFileFail
+		result.ErrInfo = ErrInfoUploadFileFail
+		result.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Create destination file fail on alluxio: %+v", err)
+		return result
+	}
+
+	quota := m.newQuotaReader(body, object + name)
+	reader := newUploadLimitReader(quota, m.config.MaxUploadSize)
+
+	_, err = m.fs.Write(id, reader)
+	m.fs.Close(id)
+
+	result.Size = reader.count
+
+	if err != nil {
+		m.fs.Delete(object+name, &DeleteOption{})
+		quota.release(0)
+
+		result.ErrCode = ErrCodeUploadFileFail
+		result.ErrInfo = ErrInfoUploadFileFail
+		switch errors.Cause(err) {
+		case ErrUploadTooLarge:
+			result.ErrCode = ErrCodeUploadTooLarge
+			result.ErrInfo = ErrInfoUploadTooLarge
+		case ErrQuotaExceeded:
+			result.ErrCode = ErrCodeQuotaExceeded
+			result.ErrInfo = ErrInfoQuotaExceeded
+		}
+		result.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Write destination file fail on alluxio: %+v", err)
+		return result
+	}
+
+	quota.release(result.Size)
+
+	logger.Infof("%s was created with %d bytes", object+name, result.Size)
+
+	return result
+}
+
+//stream the file to the client, a Range header resumes an interrupted download
 func (m Manager) alluxioReadFile (workerCtx *WorkerContext)  {
 	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	c      := workerCtx.workerRequest.GinContext
 	logger := workerCtx.logger
 	user   := webRequst.User
 	domain := webRequst.Domain
-	object := "/" + domain + "/" + user + "/" + webRequst.FileName
+	object, pathErr := resolveRequestObject(webRequst, webRequst.FileName)
 	baseResp := BaseResponse {
 		ErrCode: ErrCodeOk,
 		ErrInfo: ErrInfoOk,
 	}
 
+	sendErr := func(status int) {
+		c.JSON(status, AlluxioWebResponse{GUID: webRequst.GUID, BaseResponse: baseResp})
+	}
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		sendErr(http.StatusOK)
+		return
+	}
+
 	logger.Infof("User:%s, domain:%s will open %s", user, domain, object)
 
 	if m.rbactCheckRights(user, domain, object, "read") {
@@ -522,21 +1254,58 @@ func (m Manager) alluxioReadFile (workerCtx *WorkerContext)  {
 		logger.Infof("User:%s, domain:%s was denied to open %s", user, domain, object)
 		baseResp.ErrCode = ErrCodeUserDeny
 		baseResp.MoreInfo = ErrInfoUserDeny
-		workerCtx.workerRequest.GinContext.Data(http.StatusOK, ContentTypeStream, nil)
+		sendErr(http.StatusOK)
 		return
 	}
 
-	id, err := m.fs.OpenFile(object, &option.OpenFile{})
+	status, err := m.fs.GetStatus(object)
+
+	if err == nil && status.Folder {
+		err = errors.Errorf("%s is a directory", object)
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeOpenFail
+		baseResp.ErrInfo = ErrInfoOpenFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Get file status fail: %+v", err)
+		sendErr(http.StatusOK)
+		return
+	}
+
+	lastModified := time.Unix(0, status.LastModificationTimeMs*int64(time.Millisecond)).UTC().Format(http.TimeFormat)
+
+	//If-Range asks for the whole file when it has changed since the first part was fetched
+	rangeHeader := c.GetHeader("Range")
+	if ifRange := c.GetHeader("If-Range"); ifRange != "" && ifRange != lastModified {
+		rangeHeader = ""
+	}
+
+	byteRange, err := parseByteRange(rangeHeader, status.Length)
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeRangeNotSatisfiable
+		baseResp.ErrInfo = ErrInfoRangeNotSatisfiable
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s, file size %d", rangeHeader, status.Length)
+		logger.Errorf("Range %s of %s is not satisfiable", rangeHeader, object)
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", status.Length))
+		sendErr(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	id, err := m.fs.OpenFile(object, &OpenOption{Offset: byteRange.Start})
 
 	if err != nil {
 		baseResp.ErrCode = ErrCodeOpenFail
 		baseResp.ErrInfo = ErrInfoOpenFail
 		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
 		logger.Errorf("Open file fail: %+v", err)
-		workerCtx.workerRequest.GinContext.Data(http.StatusOK, ContentTypeStream, nil)
+		sendErr(http.StatusOK)
 		return
 	}
 
+	defer m.fs.Close(id)
+
 	r, err := m.fs.Read(id)
 
 	if err != nil {
@@ -544,38 +1313,69 @@ func (m Manager) alluxioReadFile (workerCtx *WorkerContext)  {
 		baseResp.ErrInfo = ErrInfoReadFail
 		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
 		logger.Errorf("Read file fail: %+v", err)
-		workerCtx.workerRequest.GinContext.Data(http.StatusOK, ContentTypeStream, nil)
+		sendErr(http.StatusOK)
 		return
 	}
 	defer r.Close()
 
-	defer m.fs.Close(id)
+	c.Header("Content-Type", ContentTypeStream)
+	c.Header("Content-Length", strconv.FormatInt(byteRange.Length, 10))
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Last-Modified", lastModified)
 
-	content, err := ioutil.ReadAll(r)
+	if byteRange.Partial {
+		c.Header("Content-Range", byteRange.ContentRange(status.Length))
+		c.Status(http.StatusPartialContent)
+	} else {
+		c.Status(http.StatusOK)
+	}
+
+	//the headers are out, a failure from here on can only be logged
+	n, err := io.CopyN(c.Writer, r, byteRange.Length)
 
-	workerCtx.workerRequest.GinContext.Data(http.StatusOK, ContentTypeStream, content)
+	m.usage.downloaded(domain, user, n)
 
+	if err != nil {
+		logger.Errorf("User:%s, domain:%s stream %s stopped after %d bytes: %+v", user, domain, object, n, err)
+		return
+	}
 
-	return
+	logger.Infof("User:%s, domain:%s read %d bytes of %s from offset %d", user, domain, n, object, byteRange.Start)
 }
 
 //////////////////////////////////////////////////////////////////////////////////////
 /************************************************************************************
-*****************************the functions will not to be run************************
+*********the handle api, token_id is an opaque token of the handle table*************
 ************************************************************************************/
 /////////////////////////////////////////////////////////////////////////////////////
 
+func handleError(baseResp *BaseResponse, err error) {
+	if errors.Cause(err) == ErrHandleDenied {
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.ErrInfo = ErrInfoUserDeny
+	} else {
+		baseResp.ErrCode = ErrCodeInvalidHandle
+		baseResp.ErrInfo = ErrInfoInvalidHandle
+	}
+	baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+}
+
 func (m Manager) alluxioOpenFile (workerCtx *WorkerContext) (string, BaseResponse) {
 	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
 	logger := workerCtx.logger
 	user   := webRequst.User
 	domain := webRequst.Domain
-	object := "/" + domain + "/" + user + "/" + webRequst.FileName
+	object, pathErr := resolveRequestObject(webRequst, webRequst.FileName)
 	baseResp := BaseResponse {
 		ErrCode: ErrCodeOk,
 		ErrInfo: ErrInfoOk,
 	}
 
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return "", baseResp
+	}
+
 	logger.Infof("User:%s, domain:%s will open %s", user, domain, object)
 
 	if m.rbactCheckRights(user, domain, object, "read") {
@@ -587,7 +1387,7 @@ func (m Manager) alluxioOpenFile (workerCtx *WorkerContext) (string, BaseRespons
 		return "", baseResp
 	}
 
-	id, err := m.fs.OpenFile(object, &option.OpenFile{})
+	id, err := m.fs.OpenFile(object, &OpenOption{})
 
 	if err != nil {
 		baseResp.ErrCode = ErrCodeOpenFail
@@ -596,7 +1396,7 @@ func (m Manager) alluxioOpenFile (workerCtx *WorkerContext) (string, BaseRespons
 		return "", baseResp
 	}
 
-	return string(id), baseResp
+	return m.handles.open(user, domain, object, id, false), baseResp
 }
 
 func (m Manager) alluxioReadContent (workerCtx *WorkerContext) (string, BaseResponse) {
@@ -605,13 +1405,21 @@ func (m Manager) alluxioReadContent (workerCtx *WorkerContext) (string, BaseResp
 	logger    := workerCtx.logger
 	user      := webRequst.User
 	domain    := webRequst.Domain
-	fileID    := webRequst.FileID
-	object    := "/" + domain + "/" + user + "/" + webRequst.FileName
 	baseResp := BaseResponse {
 		ErrCode: ErrCodeOk,
 		ErrInfo: ErrInfoOk,
 	}
 
+	handle, err := m.handles.lookup(webRequst.FileID, user, domain, false)
+
+	if err != nil {
+		logger.Infof("User:%s, domain:%s was denied to read handle: %s", user, domain, err)
+		handleError(&baseResp, err)
+		return "", baseResp
+	}
+
+	object := handle.object
+
 	logger.Infof("User:%s, domain:%s will read %s", user, domain, object)
 
 	if m.rbactCheckRights(user, domain, object, "read") {
@@ -623,9 +1431,7 @@ func (m Manager) alluxioReadContent (workerCtx *WorkerContext) (string, BaseResp
 		return "", baseResp
 	}
 
-	id, _ := strconv.Atoi(fileID)
-
-	r, err := m.fs.Read(id)
+	r, err := m.fs.Read(handle.streamID)
 
 	if err != nil {
 		baseResp.ErrCode = ErrCodeReadFail
@@ -643,6 +1449,8 @@ func (m Manager) alluxioReadContent (workerCtx *WorkerContext) (string, BaseResp
 		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
 		return "", baseResp
 	}
+	m.usage.downloaded(domain, user, int64(len(content)))
+
 	return string(content), baseResp
 }
 
@@ -651,12 +1459,17 @@ func (m Manager) alluxioCreateFile (workerCtx *WorkerContext) (string, BaseRespo
 	logger    := workerCtx.logger
 	user      := webRequst.User
 	domain    := webRequst.Domain
-	object    := "/" + domain + "/" + user + "/" + webRequst.FileName
+	object, pathErr := resolveRequestObject(webRequst, webRequst.FileName)
 	baseResp := BaseResponse {
 		ErrCode: ErrCodeOk,
 		ErrInfo: ErrInfoOk,
 	}
 
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return "", baseResp
+	}
+
 	logger.Infof("User:%s, domain:%s will create %s", user, domain, object)
 
 	if m.rbactCheckRights(user, domain, object, "write") {
@@ -668,17 +1481,46 @@ func (m Manager) alluxioCreateFile (workerCtx *WorkerContext) (string, BaseRespo
 		return "", baseResp
 	}
 
-	writeType := new(wire.WriteType)
-	*writeType = wire.WriteTypeCacheThrough
+	writeType, err := m.resolveWriteType(user, domain, webRequst.StorageClass)
+
+	if err != nil {
+		storageClassError(&baseResp, err)
+		return "", baseResp
+	}
+
+	ttl, ttlAction, err := m.resolveTTL(domain, webRequst.TTL, webRequst.TTLAction)
+
+	if err != nil {
+		ttlError(&baseResp, err)
+		return "", baseResp
+	}
+
+	err = m.ensureParent(object)
+
+	id := 0
+	if err == nil {
+		id, err = m.fs.CreateFile(object, &FileOption{WriteType: writeType})
+	}
 
-	id, err := m.fs.CreateFile(object, &option.CreateFile{WriteType: writeType})
 	if err != nil {
 		baseResp.ErrCode = ErrCodeCreateFileFail
 		baseResp.ErrInfo = ErrInfoCreateFileFail
 		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
 		return "", baseResp
 	}
-	return string(id), baseResp
+
+	//the ttl counts from the creation, it is set at once so an abandoned file expires too
+	err = m.applyTTL(object, ttl, ttlAction)
+
+	if err != nil {
+		m.fs.Close(id)
+		m.fs.Delete(object, &DeleteOption{})
+		ttlError(&baseResp, err)
+		logger.Errorf("Set ttl of %s fail: %+v", object, err)
+		return "", baseResp
+	}
+
+	return m.handles.open(user, domain, object, id, true), baseResp
 }
 
 func (m Manager) alluxioWriteContent (workerCtx *WorkerContext) BaseResponse {
@@ -686,13 +1528,21 @@ func (m Manager) alluxioWriteContent (workerCtx *WorkerContext) BaseResponse {
 	logger    := workerCtx.logger
 	user      := webRequst.User
 	domain    := webRequst.Domain
-	fileID    := webRequst.FileID
-	object    := "/" + domain + "/" + user + "/" + webRequst.FileName
 	baseResp  := BaseResponse {
 		ErrCode: ErrCodeOk,
 		ErrInfo: ErrInfoOk,
 	}
 
+	handle, err := m.handles.lookup(webRequst.FileID, user, domain, true)
+
+	if err != nil {
+		logger.Infof("User:%s, domain:%s was denied to write handle: %s", user, domain, err)
+		handleError(&baseResp, err)
+		return baseResp
+	}
+
+	object := handle.object
+
 	logger.Infof("User:%s, domain:%s will write %s", user, domain, object)
 
 	if m.rbactCheckRights(user, domain, object, "write") {
@@ -704,9 +1554,22 @@ func (m Manager) alluxioWriteContent (workerCtx *WorkerContext) BaseResponse {
 		return baseResp
 	}
 
-	id, _ := strconv.Atoi(fileID)
+	size := int64(len(webRequst.Body))
+	err = m.reserveQuota(object, size)
 
-	_, err := m.fs.Write(id, strings.NewReader(webRequst.Body))
+	if err != nil {
+		quotaError(&baseResp, err)
+		return baseResp
+	}
+
+	_, err = m.fs.Write(handle.streamID, strings.NewReader(webRequst.Body))
+
+	if err == nil {
+		m.releaseQuota(object, size, size)
+		m.usage.uploaded(domain, user, size)
+	} else {
+		m.releaseQuota(object, size, 0)
+	}
 
 	if err != nil {
 		baseResp.ErrCode = ErrCodeWriteFail
@@ -723,29 +1586,26 @@ func (m Manager) alluxioCloseFile (workerCtx *WorkerContext) BaseResponse {
 	logger    := workerCtx.logger
 	user      := webRequst.User
 	domain    := webRequst.Domain
-	fileID    := webRequst.FileID
-	object    := "/" + domain + "/" + user + "/" + webRequst.FileName
 
 	baseResp  := BaseResponse {
 		ErrCode: ErrCodeOk,
 		ErrInfo: ErrInfoOk,
 	}
 
-	logger.Infof("User:%s, domain:%s will close %s", user, domain, object)
+	handle, err := m.handles.close(webRequst.FileID, user, domain)
 
-	if m.rbactCheckRights(user, domain, object, "read") || m.rbactCheckRights(user, domain, object, "write") {
-		logger.Infof("User:%s, domain:%s was permitted to close %s", user, domain, object)
-	} else {
-		logger.Infof("User:%s, domain:%s was denied to close %s", user, domain, object)
-		baseResp.ErrCode = ErrCodeUserDeny
-		baseResp.MoreInfo = ErrInfoUserDeny
+	if errors.Cause(err) == ErrHandleNotFound || errors.Cause(err) == ErrHandleDenied {
+		logger.Infof("User:%s, domain:%s was denied to close handle: %s", user, domain, err)
+		handleError(&baseResp, err)
 		return baseResp
 	}
 
-	id, _ := strconv.Atoi(fileID)
+	logger.Infof("User:%s, domain:%s closed %s", user, domain, handle.object)
 
-	m.fs.Close(id)
+	if err != nil {
+		baseResp.ErrCode = ErrCodeGeneral
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+	}
 
 	return baseResp
 }
-
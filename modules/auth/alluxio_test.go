@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+//a manager over the memory backend, rules are lines of tenants.csv
+func newTestManager(t *testing.T, rules ...string) (*Manager, func()) {
+	dir, err := ioutil.TempDir("", "tuna-manager")
+	assert.NoError(t, err)
+
+	csv := filepath.Join(dir, "tenants.csv")
+	assert.NoError(t, ioutil.WriteFile(csv, []byte(strings.Join(rules, "\n")+"\n"), 0644))
+
+	logger := logp.NewLogger("test")
+	fs := newMemoryBackend()
+
+	usage, err := newUsageTracker(fs, filepath.Join(dir, "usage.json"), time.Hour, 30, logger)
+	assert.NoError(t, err)
+	ttls, err := newTTLStore(fs, filepath.Join(dir, "ttl.json"), logger)
+	assert.NoError(t, err)
+	quotas, err := newQuotaStore(filepath.Join(dir, "quota.json"))
+	assert.NoError(t, err)
+	shares, err := newShareStore(filepath.Join(dir, "shares.json"))
+	assert.NoError(t, err)
+
+	config := DefaultConfig()
+
+	m := &Manager{
+		config: config,
+		logger: logger,
+		rbact:  casbin.NewEnforcer("../../data/tenants.conf", csv),
+		fs:     fs,
+		usage:  usage,
+		ttls:   ttls,
+		quotas: quotas,
+		shares: shares,
+		trash:  newTenantTrash(fs, time.Duration(config.Internal.TrashRetention)*time.Hour, logger),
+	}
+
+	return m, func() { os.RemoveAll(dir) }
+}
+
+func writeTestFile(t *testing.T, fs StorageBackend, file string, content string) {
+	assert.NoError(t, fs.CreateDirectory(path.Dir(file), &DirectoryOption{Recursive: true, AllowExists: true}))
+	id, err := fs.CreateFile(file, &FileOption{})
+	assert.NoError(t, err)
+	_, err = fs.Write(id, strings.NewReader(content))
+	assert.NoError(t, err)
+	assert.NoError(t, fs.Close(id))
+}
+
+//run a handler on a request of webRequst, header are the http headers of the request
+func testWorkerContext(requestType string, webRequst AlluxioWebRequest, header map[string]string) (*WorkerContext, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range header {
+		c.Request.Header.Set(k, v)
+	}
+
+	return &WorkerContext{
+		logger:        logp.NewLogger("test"),
+		workerRequest: WorkerRequest{Type: requestType, GinContext: c, Body: webRequst},
+	}, w
+}
+
+func TestReadFileRange(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, user1, domain1, /domain1/user1/*, *")
+	defer cleanup()
+
+	writeTestFile(t, m.fs, "/domain1/user1/a.txt", "0123456789")
+	request := AlluxioWebRequest{User: "user1", Domain: "domain1", FileName: "a.txt"}
+
+	ctx, w := testWorkerContext(RequestAlluxioReadFile, request, map[string]string{"Range": "bytes=4-"})
+	m.alluxioReadFile(ctx)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "456789", w.Body.String())
+	assert.Equal(t, "bytes 4-9/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "6", w.Header().Get("Content-Length"))
+
+	lastModified := w.Header().Get("Last-Modified")
+	assert.NotEmpty(t, lastModified)
+
+	//the file is unchanged, the range is served
+	ctx, w = testWorkerContext(RequestAlluxioReadFile, request, map[string]string{"Range": "bytes=-3", "If-Range": lastModified})
+	m.alluxioReadFile(ctx)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "789", w.Body.String())
+
+	//the file changed since the first part, the whole file is sent
+	stale := time.Unix(0, 0).UTC().Format(http.TimeFormat)
+	ctx, w = testWorkerContext(RequestAlluxioReadFile, request, map[string]string{"Range": "bytes=4-", "If-Range": stale})
+	m.alluxioReadFile(ctx)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Empty(t, w.Header().Get("Content-Range"))
+
+	ctx, w = testWorkerContext(RequestAlluxioReadFile, request, map[string]string{"Range": "bytes=10-"})
+	m.alluxioReadFile(ctx)
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, "bytes */10", w.Header().Get("Content-Range"))
+
+	//the range of a denied read is never served
+	request.User = "user2"
+	request.Owner = "user1"
+	ctx, w = testWorkerContext(RequestAlluxioReadFile, request, map[string]string{"Range": "bytes=4-"})
+	m.alluxioReadFile(ctx)
+
+	var rsp AlluxioWebResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+	assert.Equal(t, ErrCodeUserDeny, rsp.ErrCode)
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+/*********************Cache management, pin, unpin, free and preload of tenant paths****************************/
+
+// ErrPreloadBusy the preload queue is full
+var ErrPreloadBusy = errors.New("too many preloads are waiting, try again later")
+
+type preloadJob struct {
+	user   string
+	domain string
+	object string
+}
+
+//preloader reads files through Alluxio with CACHE_PROMOTE in the background,
+//a few workers take the jobs so preloads do not starve the request workers
+type preloader struct {
+	fs     StorageBackend
+	logger *logp.Logger
+	jobs   chan preloadJob
+}
+
+func newPreloader(fs StorageBackend, queue int, logger *logp.Logger) *preloader {
+	return &preloader{
+		fs:     fs,
+		logger: logger,
+		jobs:   make(chan preloadJob, queue),
+	}
+}
+
+func (p *preloader) enqueue(job preloadJob) error {
+	select {
+	case p.jobs <- job:
+		return nil
+	default:
+		return ErrPreloadBusy
+	}
+}
+
+func (p *preloader) run(doneChan chan bool) {
+	for {
+		select {
+		case <-doneChan:
+			return
+		case job := <-p.jobs:
+			files, bytes, err := p.preload(job.object)
+			if err != nil {
+				p.logger.Errorf("User:%s, domain:%s preload of %s stopped after %d files, %d bytes: %+v",
+					job.user, job.domain, job.object, files, bytes, err)
+				continue
+			}
+			p.logger.Infof("User:%s, domain:%s preloaded %s, %d files, %d bytes", job.user, job.domain, job.object, files, bytes)
+		}
+	}
+}
+
+//read the file, or every file under the directory, so Alluxio caches it
+func (p *preloader) preload(object string) (int, int64, error) {
+	status, err := p.fs.GetStatus(object)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !status.Folder {
+		n, err := p.readThrough(object)
+		if err != nil {
+			return 0, n, err
+		}
+		return 1, n, nil
+	}
+
+	statuses, err := p.fs.ListStatus(object)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	files := 0
+	bytes := int64(0)
+
+	for _, status := range statuses {
+		f, n, err := p.preload(status.Path)
+		files += f
+		bytes += n
+		if err != nil {
+			return files, bytes, err
+		}
+	}
+
+	return files, bytes, nil
+}
+
+func (p *preloader) readThrough(object string) (int64, error) {
+	id, err := p.fs.OpenFile(object, &OpenOption{ReadType: ReadTypeCachePromote})
+	if err != nil {
+		return 0, err
+	}
+	defer p.fs.Close(id)
+
+	r, err := p.fs.Read(id)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	return io.Copy(ioutil.Discard, r)
+}
+
+//pin, unpin, free or preload the file_name of the tenant, changing the cache needs write,
+//preload only reads
+func (m Manager) alluxioCacheControl (workerCtx *WorkerContext) BaseResponse {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	object, pathErr := resolveObject(domain, user, webRequst.FileName)
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return baseResp
+	}
+
+	verb := ""
+	method := "write"
+
+	switch workerCtx.workerRequest.Type {
+	case RequestAlluxioPin:
+		verb = "pin"
+	case RequestAlluxioUnpin:
+		verb = "unpin"
+	case RequestAlluxioFree:
+		verb = "free"
+	case RequestAlluxioPreload:
+		verb = "preload"
+		method = "read"
+	}
+
+	logger.Infof("User:%s, domain:%s will %s %s", user, domain, verb, object)
+
+	if m.rbactCheckRights(user, domain, object, method) {
+		logger.Infof("User:%s, domain:%s was permitted to %s %s", user, domain, verb, object)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to %s %s", user, domain, verb, object)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return baseResp
+	}
+
+	var err error
+
+	switch workerCtx.workerRequest.Type {
+	case RequestAlluxioPin, RequestAlluxioUnpin:
+		pinned := workerCtx.workerRequest.Type == RequestAlluxioPin
+		err = m.fs.SetAttribute(object, &AttributeOption{Pinned: &pinned, Recursive: webRequst.Recursive})
+	case RequestAlluxioFree:
+		err = m.fs.Free(object, &FreeOption{Recursive: webRequst.Recursive})
+	case RequestAlluxioPreload:
+		_, err = m.fs.GetStatus(object)
+		if err == nil {
+			err = m.preloads.enqueue(preloadJob{user: user, domain: domain, object: object})
+		}
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeCacheFail
+		baseResp.ErrInfo = ErrInfoCacheFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("User:%s, domain:%s %s %s fail: %+v", user, domain, verb, object, err)
+		return baseResp
+	}
+
+	if workerCtx.workerRequest.Type == RequestAlluxioPreload {
+		logger.Infof("User:%s, domain:%s queued the preload of %s", user, domain, object)
+	} else {
+		logger.Infof("User:%s, domain:%s did %s %s", user, domain, verb, object)
+	}
+
+	return baseResp
+}
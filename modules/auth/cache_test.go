@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func TestPreloader(t *testing.T) {
+	fs := newMemoryBackend()
+	assert.NoError(t, fs.CreateDirectory("/d1/alice/sub/", &DirectoryOption{Recursive: true}))
+
+	for _, name := range []string{"/d1/alice/a.txt", "/d1/alice/sub/b.txt"} {
+		id, err := fs.CreateFile(name, &FileOption{})
+		assert.NoError(t, err)
+		_, err = fs.Write(id, strings.NewReader("hello"))
+		assert.NoError(t, err)
+		assert.NoError(t, fs.Close(id))
+	}
+
+	p := newPreloader(fs, 1, logp.NewLogger("preload"))
+
+	//a folder is read recursively
+	files, bytes, err := p.preload("/d1/alice/")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, files)
+	assert.Equal(t, int64(10), bytes)
+
+	_, _, err = p.preload("/d1/alice/none.txt")
+	assert.Equal(t, ErrStorageNotFound, err)
+
+	//the queue does not grow past its size
+	assert.NoError(t, p.enqueue(preloadJob{object: "/d1/alice/a.txt"}))
+	assert.Equal(t, ErrPreloadBusy, p.enqueue(preloadJob{object: "/d1/alice/a.txt"}))
+}
@@ -25,6 +25,8 @@ const (
 	RequestExample                = "RequestExample"
 	RequestAlluxioCreateUser      = "RequestAlluxioCreateUser"
 	RequestAlluxioDeleteUser      = "RequestAlluxioDeleteUser"
+	RequestAlluxioRestoreUser     = "RequestAlluxioRestoreUser"
+	RequestAlluxioPurgeUser       = "RequestAlluxioPurgeUser"
 	RequestAlluxioCreateFile      = "RequestAlluxioCreateFile"
 	RequestAlluxioWriteContent    = "RequestAlluxioWriteContent"
 	RequestAlluxioOpenFile        = "RequestAlluxioOpenFile"
@@ -32,8 +34,43 @@ const (
 	RequestAlluxioCloseFile       = "RequestAlluxioCloseFile"
 	RequestAlluxioDeleteFile      = "RequestAlluxioDeleteFile"
 	RequestAlluxioRenameFile      = "RequestAlluxioRenameFile"
+	RequestAlluxioCopyFile        = "RequestAlluxioCopyFile"
+	RequestAlluxioMoveFile        = "RequestAlluxioMoveFile"
+	RequestAlluxioQuota           = "RequestAlluxioQuota"
+	RequestAlluxioSetQuota        = "RequestAlluxioSetQuota"
+	RequestAlluxioSetTTL          = "RequestAlluxioSetTTL"
+	RequestAlluxioPresign         = "RequestAlluxioPresign"
+	RequestPresignedPut           = "RequestPresignedPut"
+	RequestPolicyList             = "RequestPolicyList"
+	RequestPolicyAdd              = "RequestPolicyAdd"
+	RequestPolicyRemove           = "RequestPolicyRemove"
+	RequestPolicyCheck            = "RequestPolicyCheck"
+	RequestServiceAccountCreate   = "RequestServiceAccountCreate"
+	RequestServiceAccountRemove   = "RequestServiceAccountRemove"
+	RequestServiceAccountList     = "RequestServiceAccountList"
+	RequestInternalAccountCreate  = "RequestInternalAccountCreate"
+	RequestDomainCreateUser       = "RequestDomainCreateUser"
+	RequestDomainDeleteUser       = "RequestDomainDeleteUser"
+	RequestDomainUsage            = "RequestDomainUsage"
+	RequestAlluxioShare           = "RequestAlluxioShare"
+	RequestAlluxioUnshare         = "RequestAlluxioUnshare"
+	RequestAlluxioSharedWithMe    = "RequestAlluxioSharedWithMe"
+	RequestAlluxioSharedByMe      = "RequestAlluxioSharedByMe"
+	RequestAlluxioPin             = "RequestAlluxioPin"
+	RequestAlluxioUnpin           = "RequestAlluxioUnpin"
+	RequestAlluxioFree            = "RequestAlluxioFree"
+	RequestAlluxioPreload         = "RequestAlluxioPreload"
 	RequestAlluxioUploadFile      = "RequestAlluxioUploadFile"
 	RequestAlluxioReadFile        = "RequestAlluxioReadFile"
+	RequestAlluxioCreateDir       = "RequestAlluxioCreateDir"
+	RequestAlluxioRemoveDir       = "RequestAlluxioRemoveDir"
+	RequestAlluxioList            = "RequestAlluxioList"
+	RequestAlluxioStat            = "RequestAlluxioStat"
+	RequestUploadSessionCreate    = "RequestUploadSessionCreate"
+	RequestUploadSessionChunk     = "RequestUploadSessionChunk"
+	RequestUploadSessionOffset    = "RequestUploadSessionOffset"
+	RequestUploadSessionFinish    = "RequestUploadSessionFinish"
+	RequestUploadSessionAbort     = "RequestUploadSessionAbort"
 )
 
 // API response error code
@@ -53,6 +90,30 @@ const (
 	ErrCodeDeleteFileFail      = 12
 	ErrCodeRenameFileFail      = 13
 	ErrCodeUploadFileFail      = 14
+	ErrCodeRangeNotSatisfiable = 15
+	ErrCodeUploadTooLarge      = 16
+	ErrCodeUploadSessionFail   = 17
+	ErrCodeUploadOffsetMismatch = 18
+	ErrCodeInvalidHandle       = 19
+	ErrCodeListFail            = 20
+	ErrCodeStatFail            = 21
+	ErrCodeCreateDirFail       = 22
+	ErrCodeRemoveDirFail       = 23
+	ErrCodeInvalidPath         = 24
+	ErrCodeCopyFileFail        = 25
+	ErrCodeMoveFileFail        = 26
+	ErrCodeQuotaExceeded       = 27
+	ErrCodeQuotaFail           = 28
+	ErrCodeUsageFail           = 29
+	ErrCodeInvalidStorageClass = 30
+	ErrCodeTTLFail             = 31
+	ErrCodeCacheFail           = 32
+	ErrCodeSignatureInvalid    = 33
+	ErrCodeShareFail           = 34
+	ErrCodePolicyFail          = 35
+	ErrCodeUnauthorized        = 36
+	ErrCodeServiceAccountFail  = 37
+	ErrCodeTrashFail           = 38
 )
 
 // API response error info
@@ -71,6 +132,30 @@ const (
 	ErrInfoDeleteFileFail      = "ErrInfoDeleteFileFail"
 	ErrInfoRenameFileFail      = "ErrInfoRenameFileFail"
 	ErrInfoUploadFileFail      = "ErrInfoUploadFileFail"
+	ErrInfoRangeNotSatisfiable = "ErrInfoRangeNotSatisfiable"
+	ErrInfoUploadTooLarge      = "ErrInfoUploadTooLarge"
+	ErrInfoUploadSessionFail   = "ErrInfoUploadSessionFail"
+	ErrInfoUploadOffsetMismatch = "ErrInfoUploadOffsetMismatch"
+	ErrInfoInvalidHandle       = "ErrInfoInvalidHandle"
+	ErrInfoListFail            = "ErrInfoListFail"
+	ErrInfoStatFail            = "ErrInfoStatFail"
+	ErrInfoCreateDirFail       = "ErrInfoCreateDirFail"
+	ErrInfoRemoveDirFail       = "ErrInfoRemoveDirFail"
+	ErrInfoInvalidPath         = "ErrInfoInvalidPath"
+	ErrInfoCopyFileFail        = "ErrInfoCopyFileFail"
+	ErrInfoMoveFileFail        = "ErrInfoMoveFileFail"
+	ErrInfoQuotaExceeded       = "ErrInfoQuotaExceeded"
+	ErrInfoQuotaFail           = "ErrInfoQuotaFail"
+	ErrInfoUsageFail           = "ErrInfoUsageFail"
+	ErrInfoInvalidStorageClass = "ErrInfoInvalidStorageClass"
+	ErrInfoTTLFail             = "ErrInfoTTLFail"
+	ErrInfoCacheFail           = "ErrInfoCacheFail"
+	ErrInfoSignatureInvalid    = "ErrInfoSignatureInvalid"
+	ErrInfoShareFail           = "ErrInfoShareFail"
+	ErrInfoPolicyFail          = "ErrInfoPolicyFail"
+	ErrInfoUnauthorized        = "ErrInfoUnauthorized"
+	ErrInfoServiceAccountFail  = "ErrInfoServiceAccountFail"
+	ErrInfoTrashFail           = "ErrInfoTrashFail"
 )
 
 // BaseResponse definition
@@ -80,12 +165,58 @@ type BaseResponse struct {
 	MoreInfo string `json:"more_info"`
 }
 
+// AlluxioConfig address of an Alluxio REST proxy
+type AlluxioConfig struct {
+	Host         string `json:"host"`
+	Port         int    `json:"port"`
+	Timeout      int    `json:"timeout"`       //milliseconds
+}
+
+// TTLConfig default ttl of the new files and directories of a domain
+type TTLConfig struct {
+	TTL    int64  `json:"ttl"`    //seconds, 0 is no ttl
+	Action string `json:"action"` //delete or free
+}
+
 // Config config for audit manager
 type Config struct {
 	MaxWorker    int    `json:"maxworker"`
 	WebPort      int    `json:"webport"`
 	ReqTimeout   int    `json:"reqtimeout"`
 	Debug        bool   `json:"debug"`
+	Storage      string `json:"storage"`      //alluxio, local or memory
+	LocalRoot    string `json:"localroot"`    //root directory of local storage
+	MaxUploadSize int64 `json:"maxuploadsize"` //bytes of one uploaded file, 0 is no limit
+	UploadSessionDir string `json:"uploadsessiondir"`  //staging directory of resumable uploads
+	UploadSessionExpiry int `json:"uploadsessionexpiry"` //minutes an idle upload session is kept
+	HandleLease  int    `json:"handlelease"`  //seconds an idle token_id of the handle api is kept
+	QuotaFile    string `json:"quotafile"`    //quotas of users and domains
+	UsageFile    string `json:"usagefile"`    //usage figures of users and domains
+	UsageScanInterval int `json:"usagescaninterval"` //minutes between two scans of the stored bytes
+	UsageRetention int  `json:"usageretention"` //days the daily traffic is kept
+	StorageClass string `json:"storageclass"` //default storage class: cache, standard, archive or async
+	DomainStorageClasses map[string]string `json:"domainstorageclasses"` //domain -> its default storage class
+	DomainTTLs   map[string]TTLConfig `json:"domainttls"`        //domain -> ttl of its new files
+	TTLFile      string `json:"ttlfile"`      //ttls kept by tuna when the storage has none
+	ShareFile    string `json:"sharefile"`    //the policies made by share
+	PreloadWorkers int  `json:"preloadworkers"` //preloads read at the same time
+	PreloadQueue int    `json:"preloadqueue"` //preloads waiting at most
+	PresignSecret string `json:"presignsecret"` //hmac key of presigned urls, random when empty
+	PresignExpires int  `json:"presignexpires"` //default seconds a presigned url is valid
+	PresignMaxExpires int `json:"presignmaxexpires"` //seconds a presigned url is valid at most
+	Admins       []string `json:"admins"`      //users of the policy admin api
+	DomainAdminRole string `json:"domainadminrole"` //role of the domain admins in tenants.csv, empty turns delegation off
+	AuditFile    string `json:"auditfile"`    //delegated actions of the domain admins
+	DelegatedQuota int64 `json:"delegatedquota"` //bytes of quota a domain admin may give a user at most, 0 is the default quota
+	JWT          JWTConfig `json:"jwt"`        //bearer tokens of the /auth and /admin apis
+	OIDC         OIDCConfig `json:"oidc"`      //access tokens of an identity provider, tried after jwt
+	ServiceAccountFile string `json:"serviceaccountfile"` //api keys and secrets of the service accounts
+	SignatureWindow int `json:"signaturewindow"` //seconds a signed request is valid around its timestamp
+	RequireSignedInternal bool `json:"requiresignedinternal"` //the internal api refuses unsigned requests
+	Internal     InternalConfig `json:"internal"`  //listener of the internal api and the trash of free-res
+	Alluxio      AlluxioConfig `json:"alluxio"`                    //the default cluster
+	Clusters     map[string]AlluxioConfig `json:"clusters"`        //more clusters by name
+	DomainClusters map[string]string `json:"domainclusters"`       //domain -> cluster name
 }
 
 type GetLogLevelResponse struct {
@@ -103,6 +234,51 @@ var defaultConfig = Config {
 	WebPort:    8088,
 	ReqTimeout: 10000,
 	Debug:      false,
+	Storage:    StorageAlluxio,
+	LocalRoot:  "./data/storage",
+	UploadSessionDir:    "./data/upload-sessions",
+	UploadSessionExpiry: 1440,
+	HandleLease:         300,
+	QuotaFile:           "./data/quotas.json",
+	UsageFile:           "./data/usage.json",
+	UsageScanInterval:   60,
+	UsageRetention:      400,
+	StorageClass:        StorageClassStandard,
+	TTLFile:             "./data/ttl.json",
+	ShareFile:           "./data/shares.json",
+	PreloadWorkers:      2,
+	PreloadQueue:        100,
+	PresignExpires:      3600,
+	PresignMaxExpires:   604800,
+	Admins:              []string{"root"},
+	DomainAdminRole:     "superAdmin",
+	AuditFile:           "./data/audit.log",
+	DelegatedQuota:      DefaultQuota,
+	ServiceAccountFile:  "./data/service-accounts.json",
+	SignatureWindow:     300,
+	JWT:                 JWTConfig{
+		Algorithm:   JWTAlgHS256,
+		UserClaim:   "sub",
+		DomainClaim: "domain",
+		Leeway:      30,
+	},
+	OIDC:                OIDCConfig{
+		Mode:        OIDCModeJWKS,
+		UserClaim:   "sub",
+		DomainClaim: "tenant",
+		CacheTTL:    60,
+		Timeout:     5000,
+		Leeway:      30,
+	},
+	Internal:            InternalConfig{
+		Address:        "127.0.0.1:8089",
+		TrashRetention: 72,
+	},
+	Alluxio:    AlluxioConfig{
+		Host:    "172.25.0.113",
+		Port:    39999,
+		Timeout: 10000,
+	},
 }
 
 //get default config
@@ -133,6 +309,87 @@ func initConfig() (Config, error) {
 		logger.Panic("initConfig: ReqTimeout should be larger than 100")
 	}
 
+	if config.HandleLease <= 0 {
+		logger.Panic("initConfig: HandleLease should be larger than 0")
+	}
+
+	if config.UploadSessionExpiry <= 0 {
+		logger.Panic("initConfig: UploadSessionExpiry should be larger than 0")
+	}
+
+	if config.PreloadWorkers <= 0 || config.PreloadQueue <= 0 {
+		logger.Panic("initConfig: PreloadWorkers and PreloadQueue should be larger than 0")
+	}
+
+	if config.PresignExpires <= 0 || config.PresignMaxExpires < config.PresignExpires {
+		logger.Panic("initConfig: PresignExpires should be larger than 0 and not larger than PresignMaxExpires")
+	}
+
+	if config.SignatureWindow <= 0 {
+		logger.Panic("initConfig: SignatureWindow should be larger than 0")
+	}
+
+	if config.Internal.TrashRetention < 0 {
+		logger.Panic("initConfig: TrashRetention should not be less than 0")
+	}
+
+	if (config.Internal.TLSCert == "") != (config.Internal.TLSKey == "") {
+		logger.Panic("initConfig: TLSCert and TLSKey of the internal api should be set together")
+	}
+
+	//on the public port the internal api would be open to anybody
+	if config.Internal.Address == "" && len(config.Internal.Tokens) == 0 && !config.RequireSignedInternal {
+		logger.Panic("initConfig: the internal api on webport needs internal tokens or RequireSignedInternal, or set its own address")
+	}
+
+	if config.Internal.TLSCert != "" && config.Internal.Address == "" {
+		logger.Panic("initConfig: TLSCert of the internal api needs its own address")
+	}
+
+	if config.Internal.ClientCA != "" && config.Internal.TLSCert == "" {
+		logger.Panic("initConfig: ClientCA of the internal api needs TLSCert")
+	}
+
+	if config.UsageScanInterval <= 0 || config.UsageRetention <= 0 {
+		logger.Panic("initConfig: UsageScanInterval and UsageRetention should be larger than 0")
+	}
+
+	if !validStorageClass(config.StorageClass) {
+		logger.Panicf("initConfig: unknown storage class %s", config.StorageClass)
+	}
+
+	for domain, class := range config.DomainStorageClasses {
+		if !validStorageClass(class) {
+			logger.Panicf("initConfig: unknown storage class %s of domain %s", class, domain)
+		}
+	}
+
+	for domain, ttl := range config.DomainTTLs {
+		action, err := normalizeTTLAction(ttl.Action)
+		if err != nil {
+			logger.Panicf("initConfig: ttl action of domain %s: %s", domain, err)
+		}
+		ttl.Action = action
+		config.DomainTTLs[domain] = ttl
+	}
+
+	if config.Storage == StorageAlluxio {
+		if config.Alluxio.Host == "" || config.Alluxio.Port <= 0 {
+			logger.Panic("initConfig: alluxio host and port should be set")
+		}
+
+		for name, cluster := range config.Clusters {
+			if cluster.Host == "" || cluster.Port <= 0 {
+				logger.Panicf("initConfig: host and port of cluster %s should be set", name)
+			}
+
+			if cluster.Timeout <= 0 {
+				cluster.Timeout = defaultConfig.Alluxio.Timeout
+				config.Clusters[name] = cluster
+			}
+		}
+	}
+
 	return config, nil
 }
 
@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*********************Server side copy and move, the source and destination may belong to other tenants****************************/
+
+//the tenant of the source or destination, the caller when the request leaves it out
+func tenantOrCaller(user string, domain string, webRequst AlluxioWebRequest) (string, string) {
+	if user == "" {
+		user = webRequst.User
+	}
+
+	if domain == "" {
+		domain = webRequst.Domain
+	}
+
+	return user, domain
+}
+
+//the domain of a resolved object
+func tenantDomain(object string) string {
+	return strings.SplitN(strings.TrimPrefix(object, "/"), "/", 2)[0]
+}
+
+//resolve the source and destination of a copy or move request
+func resolveCopyObjects(webRequst AlluxioWebRequest) (string, string, error) {
+	srcUser, srcDomain := tenantOrCaller(webRequst.SrcUser, webRequst.SrcDomain, webRequst)
+	dstUser, dstDomain := tenantOrCaller(webRequst.DstUser, webRequst.DstDomain, webRequst)
+
+	src, err := resolveObject(srcDomain, srcUser, webRequst.FileName)
+	if err != nil {
+		return "", "", err
+	}
+
+	if src == "/"+srcDomain+"/"+srcUser+"/" {
+		return "", "", errors.Wrap(ErrInvalidPath, "file_name is not set")
+	}
+
+	dst, err := resolveObject(dstDomain, dstUser, webRequst.NewName)
+	if err != nil {
+		return "", "", err
+	}
+
+	if dst == "/"+dstDomain+"/"+dstUser+"/" {
+		return "", "", errors.Wrap(ErrInvalidPath, "new_name is not set")
+	}
+
+	return src, dst, nil
+}
+
+//stream the file src into a new file dst, the data never leaves tuna
+func (m Manager) copyObject(src string, dst string, writeType string) (int64, error) {
+	status, err := m.fs.GetStatus(src)
+	if err != nil {
+		return 0, err
+	}
+
+	if status.Folder {
+		return 0, errors.Errorf("%s is a directory", src)
+	}
+
+	err = m.reserveQuota(dst, status.Length)
+	if err != nil {
+		return 0, err
+	}
+
+	written := int64(0)
+	defer func() { m.releaseQuota(dst, status.Length, written) }()
+
+	err = m.ensureParent(dst)
+	if err != nil {
+		return 0, err
+	}
+
+	srcID, err := m.fs.OpenFile(src, &OpenOption{})
+	if err != nil {
+		return 0, err
+	}
+	defer m.fs.Close(srcID)
+
+	reader, err := m.fs.Read(srcID)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	dstID, err := m.fs.CreateFile(dst, &FileOption{WriteType: writeType})
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := m.fs.Write(dstID, reader)
+	closeErr := m.fs.Close(dstID)
+
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		//do not leave half a file behind
+		m.fs.Delete(dst, &DeleteOption{})
+		return 0, err
+	}
+
+	written = int64(n)
+
+	return written, nil
+}
+
+//move src to another cluster as a rename would, the copy keeps the storage class and the expiry of the ttl of src
+func (m Manager) moveAcrossClusters(src string, dst string) error {
+	status, err := m.fs.GetStatus(src)
+	if err != nil {
+		return err
+	}
+
+	m.ttls.fill(&status)
+
+	writeType := statusWriteType(status)
+	if writeType == "" {
+		writeType = storageClassWriteTypes[m.defaultStorageClass(tenantDomain(dst))]
+	}
+
+	_, err = m.copyObject(src, dst, writeType)
+	if err != nil {
+		return err
+	}
+
+	//the ttl of Alluxio counts from the creation of the copy, what is left of it is set
+	if status.TTL > 0 {
+		left := (status.CreationTimeMs + status.TTL - nowMs()) / 1000
+		if left < 1 {
+			left = 1
+		}
+
+		err = m.applyTTL(dst, left, status.TTLAction)
+		if err != nil {
+			m.fs.Delete(dst, &DeleteOption{})
+			return err
+		}
+	}
+
+	err = m.fs.Delete(src, &DeleteOption{})
+	if err != nil {
+		return err
+	}
+	m.usage.stored(src, -status.Length)
+
+	return m.ttls.remove(src)
+}
+
+//copy needs read on the source and write on the destination
+func (m Manager) alluxioCopyFile (workerCtx *WorkerContext) BaseResponse {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	src, dst, err := resolveCopyObjects(webRequst)
+
+	if err != nil {
+		pathError(&baseResp, err)
+		return baseResp
+	}
+
+	logger.Infof("User:%s, domain:%s will copy %s to %s", user, domain, src, dst)
+
+	if m.rbactCheckRights(user, domain, src, "read") && m.rbactCheckRights(user, domain, dst, "write") {
+		logger.Infof("User:%s, domain:%s was permitted to copy %s to %s", user, domain, src, dst)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to copy %s to %s", user, domain, src, dst)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return baseResp
+	}
+
+	writeType, err := m.resolveWriteType(user, domain, webRequst.StorageClass)
+
+	if err != nil {
+		storageClassError(&baseResp, err)
+		return baseResp
+	}
+
+	ttl, ttlAction, err := m.resolveTTL(tenantDomain(dst), webRequst.TTL, webRequst.TTLAction)
+
+	if err != nil {
+		ttlError(&baseResp, err)
+		return baseResp
+	}
+
+	size, err := m.copyObject(src, dst, writeType)
+
+	if err == nil {
+		err = m.applyTTL(dst, ttl, ttlAction)
+		if err != nil {
+			m.fs.Delete(dst, &DeleteOption{})
+			ttlError(&baseResp, err)
+			logger.Errorf("Set ttl of %s fail: %+v", dst, err)
+			return baseResp
+		}
+	}
+
+	if errors.Cause(err) == ErrQuotaExceeded {
+		quotaError(&baseResp, err)
+		return baseResp
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeCopyFileFail
+		baseResp.ErrInfo = ErrInfoCopyFileFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Copy %s to %s fail: %+v", src, dst, err)
+		return baseResp
+	}
+
+	logger.Infof("User:%s, domain:%s copied %s to %s, %d bytes", user, domain, src, dst, size)
+
+	return baseResp
+}
+
+//move also removes the source, so it needs write on the source as well as read,
+//a move between two clusters is a copy followed by a delete
+func (m Manager) alluxioMoveFile (workerCtx *WorkerContext) BaseResponse {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	src, dst, err := resolveCopyObjects(webRequst)
+
+	if err != nil {
+		pathError(&baseResp, err)
+		return baseResp
+	}
+
+	logger.Infof("User:%s, domain:%s will move %s to %s", user, domain, src, dst)
+
+	if m.rbactCheckRights(user, domain, src, "read") && m.rbactCheckRights(user, domain, src, "write") &&
+		m.rbactCheckRights(user, domain, dst, "write") {
+		logger.Infof("User:%s, domain:%s was permitted to move %s to %s", user, domain, src, dst)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to move %s to %s", user, domain, src, dst)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return baseResp
+	}
+
+	//the moved data is counted in the quotas of the destination tenant from now on,
+	//it is reserved there during the rename like the bytes of a write
+	var size, moved int64
+	release := func() {}
+
+	if tenantOf(src) != tenantOf(dst) {
+		size, err = m.pathUsage(src)
+		if err == nil {
+			err = m.reserveQuota(dst, size)
+		}
+		if err == nil {
+			release = func() { m.releaseQuota(dst, size, moved) }
+		}
+	}
+
+	if err == nil {
+		err = m.ensureParent(dst)
+	}
+
+	if err == nil {
+		err = m.fs.Rename(src, dst)
+		if err == nil {
+			m.usage.stored(src, -size)
+			moved = size
+			err = m.ttls.rename(src, dst)
+		}
+	}
+
+	//the copy between two clusters reserves on its own
+	release()
+
+	if errors.Cause(err) == ErrStorageCrossCluster {
+		logger.Infof("%s and %s are on different clusters, the file will be copied", src, dst)
+
+		err = m.moveAcrossClusters(src, dst)
+	}
+
+	if errors.Cause(err) == ErrQuotaExceeded {
+		quotaError(&baseResp, err)
+		return baseResp
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeMoveFileFail
+		baseResp.ErrInfo = ErrInfoMoveFileFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Move %s to %s fail: %+v", src, dst, err)
+		return baseResp
+	}
+
+	logger.Infof("User:%s, domain:%s moved %s to %s", user, domain, src, dst)
+
+	return baseResp
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func copyRequest(user string, file string, dstUser string, dstDomain string, newName string) AlluxioWebRequest {
+	return AlluxioWebRequest{
+		RbactBaseRequest: RbactBaseRequest{User: user, Domain: "domain1"},
+		SrcUser:          "user1",
+		FileName:         file,
+		DstUser:          dstUser,
+		DstDomain:        dstDomain,
+		NewName:          newName,
+	}
+}
+
+func TestCopyFileRights(t *testing.T) {
+	m, cleanup := newTestManager(t,
+		"p, user1, domain1, /domain1/user1/*, *",
+		"p, user2, domain1, /domain1/user2/*, *",
+		"p, user3, domain1, /domain1/user3/*, *",
+		"p, user3, domain1, /domain1/user1/*, read")
+	defer cleanup()
+
+	writeTestFile(t, m.fs, "/domain1/user1/a.txt", "hello")
+
+	//user2 may not read the source
+	ctx, _ := testWorkerContext(RequestAlluxioCopyFile, copyRequest("user2", "a.txt", "user2", "", "a.txt"), nil)
+	assert.Equal(t, ErrCodeUserDeny, m.alluxioCopyFile(ctx).ErrCode)
+
+	//user3 may read the source but not write to user2
+	ctx, _ = testWorkerContext(RequestAlluxioCopyFile, copyRequest("user3", "a.txt", "user2", "", "a.txt"), nil)
+	assert.Equal(t, ErrCodeUserDeny, m.alluxioCopyFile(ctx).ErrCode)
+	_, err := m.fs.GetStatus("/domain1/user2/a.txt")
+	assert.Equal(t, ErrStorageNotFound, err)
+
+	//a move needs write on the source too
+	ctx, _ = testWorkerContext(RequestAlluxioMoveFile, copyRequest("user3", "a.txt", "user3", "", "a.txt"), nil)
+	assert.Equal(t, ErrCodeUserDeny, m.alluxioMoveFile(ctx).ErrCode)
+
+	ctx, _ = testWorkerContext(RequestAlluxioCopyFile, copyRequest("user3", "a.txt", "user3", "", "b.txt"), nil)
+	assert.Equal(t, ErrCodeOk, m.alluxioCopyFile(ctx).ErrCode)
+
+	status, err := m.fs.GetStatus("/domain1/user3/b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), status.Length)
+	_, err = m.fs.GetStatus("/domain1/user1/a.txt")
+	assert.NoError(t, err)
+}
+
+func TestMoveFileKeepsTTL(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, user1, domain1, /domain1/user1/*, *")
+	defer cleanup()
+
+	writeTestFile(t, m.fs, "/domain1/user1/a.txt", "hello")
+	assert.NoError(t, m.applyTTL("/domain1/user1/a.txt", 60, TTLActionDelete))
+
+	ctx, _ := testWorkerContext(RequestAlluxioMoveFile, copyRequest("user1", "a.txt", "", "", "x/b.txt"), nil)
+	assert.Equal(t, ErrCodeOk, m.alluxioMoveFile(ctx).ErrCode)
+
+	_, ok := m.ttls.entries["/domain1/user1/a.txt"]
+	assert.False(t, ok)
+
+	status, err := m.fs.GetStatus("/domain1/user1/x/b.txt")
+	assert.NoError(t, err)
+	m.ttls.fill(&status)
+	assert.Equal(t, int64(60000), status.TTL)
+	assert.Equal(t, TTLActionDelete, status.TTLAction)
+}
+
+func TestMoveFileQuota(t *testing.T) {
+	m, cleanup := newTestManager(t,
+		"p, user1, domain1, /domain1/user1/*, *",
+		"p, user1, domain1, /domain1/user2/*, *")
+	defer cleanup()
+
+	writeTestFile(t, m.fs, "/domain1/user1/a.txt", "12345678")
+	m.usage.stored("/domain1/user1/a.txt", 8)
+	assert.NoError(t, m.quotas.set("/domain1/user2/", 10))
+
+	//a write in progress holds part of the quota of user2, the move does not fit next to it
+	assert.NoError(t, m.reserveQuota("/domain1/user2/b.txt", 4))
+	ctx, _ := testWorkerContext(RequestAlluxioMoveFile, copyRequest("user1", "a.txt", "user2", "", "a.txt"), nil)
+	assert.Equal(t, ErrCodeQuotaExceeded, m.alluxioMoveFile(ctx).ErrCode)
+	assert.Equal(t, int64(4), m.quotas.reserved["/domain1/user2/"])
+
+	m.releaseQuota("/domain1/user2/b.txt", 4, 0)
+	ctx, _ = testWorkerContext(RequestAlluxioMoveFile, copyRequest("user1", "a.txt", "user2", "", "a.txt"), nil)
+	assert.Equal(t, ErrCodeOk, m.alluxioMoveFile(ctx).ErrCode)
+
+	//the reservation of the move became the usage of user2
+	assert.Empty(t, m.quotas.reserved)
+	assert.Equal(t, int64(8), m.usage.used("/domain1/user2/"))
+	assert.Equal(t, int64(0), m.usage.used("/domain1/user1/"))
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(m.reserveQuota("/domain1/user2/b.txt", 3)))
+}
+
+func TestMoveFileAcrossClusters(t *testing.T) {
+	m, cleanup := newTestManager(t,
+		"p, user1, domain1, /domain1/user1/*, *",
+		"p, user1, domain1, /domain2/user1/*, write")
+	defer cleanup()
+
+	rb, def, other := newTestRouter()
+	m.fs = rb
+	m.ttls.fs = rb
+
+	writeTestFile(t, m.fs, "/domain1/user1/a.txt", "hello")
+	assert.NoError(t, m.applyTTL("/domain1/user1/a.txt", 60, TTLActionDelete))
+
+	ctx, _ := testWorkerContext(RequestAlluxioMoveFile, copyRequest("user1", "a.txt", "user1", "domain2", "a.txt"), nil)
+	assert.Equal(t, ErrCodeOk, m.alluxioMoveFile(ctx).ErrCode)
+
+	//the file is copied to the cluster of domain2 and removed from the default one
+	_, err := def.GetStatus("/domain1/user1/a.txt")
+	assert.Equal(t, ErrStorageNotFound, err)
+	status, err := other.GetStatus("/domain2/user1/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), status.Length)
+
+	//the ttl follows the file
+	_, ok := m.ttls.entries["/domain1/user1/a.txt"]
+	assert.False(t, ok)
+	m.ttls.fill(&status)
+	assert.InDelta(t, 60000, status.TTL, 1000)
+	assert.Equal(t, TTLActionDelete, status.TTLAction)
+}
+
+func TestStatusWriteType(t *testing.T) {
+	assert.Equal(t, WriteTypeMustCache, statusWriteType(FileStatus{PersistenceState: "NOT_PERSISTED", InMemoryPercentage: 100}))
+	assert.Equal(t, WriteTypeAsyncThrough, statusWriteType(FileStatus{PersistenceState: "TO_BE_PERSISTED", InMemoryPercentage: 100}))
+	assert.Equal(t, WriteTypeCacheThrough, statusWriteType(FileStatus{PersistenceState: "PERSISTED", InMemoryPercentage: 100}))
+	assert.Equal(t, WriteTypeThrough, statusWriteType(FileStatus{PersistenceState: "PERSISTED"}))
+	assert.Equal(t, "", statusWriteType(FileStatus{}))
+}
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+/*********************Domain administrators, the users of a domain managed by the holders of its admin role****************************/
+
+// ErrOutOfDomain a domain admin acts on a rule or tenant of another domain
+var ErrOutOfDomain = errors.New("domain admin may only act in its own domain")
+
+// ErrTenantExists a domain admin creates a user whose folder is there already
+var ErrTenantExists = errors.New("tenant exists already")
+
+// AuditEntry one delegated action of a domain admin
+type AuditEntry struct {
+	Time     string `json:"time"`
+	Admin    string `json:"admin"`
+	Domain   string `json:"domain"`
+	Action   string `json:"action"`
+	Target   string `json:"target"` //tenant, rule or file acted on
+	ClientIP string `json:"client_ip"`
+	GUID     string `json:"guid"`
+	ErrCode  int    `json:"err_code"`
+}
+
+//auditLog appends the delegated actions to a file, one json entry by line
+type auditLog struct {
+	mutex  sync.Mutex
+	file   string
+	logger *logp.Logger
+}
+
+func newAuditLog(file string, logger *logp.Logger) *auditLog {
+	return &auditLog{file: file, logger: logger}
+}
+
+func (a *auditLog) record(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.logger.Infof("Audit: %s", string(data))
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	f, err := os.OpenFile(a.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+//a domain admin holds the admin role of the config in its domain, the role needs a p rule over /domain/* to reach the files
+func (m Manager) isDomainAdmin(user string, domain string) bool {
+	return m.config.DomainAdminRole != "" && m.rbact.HasGroupingPolicy(user, m.config.DomainAdminRole, domain)
+}
+
+//a rule a domain admin may list, add, remove or check, it stays in the domain and never grants the admin role
+func checkDomainRule(ptype string, rule []string, domain string, adminRole string) error {
+	if ptype == PolicyTypeG {
+		if rule[2] != domain {
+			return errors.Wrapf(ErrOutOfDomain, "g rule of domain %s", rule[2])
+		}
+
+		if rule[0] == adminRole || rule[1] == adminRole {
+			return errors.Wrapf(ErrOutOfDomain, "role %s is given by the admins", adminRole)
+		}
+
+		return nil
+	}
+
+	if rule[1] != domain || !strings.HasPrefix(rule[2], "/"+domain+"/") {
+		return errors.Wrapf(ErrOutOfDomain, "p rule of domain %s over %s", rule[1], rule[2])
+	}
+
+	if rule[0] == adminRole {
+		return errors.Wrapf(ErrOutOfDomain, "rules of role %s are set by the admins", adminRole)
+	}
+
+	return nil
+}
+
+//the quota of a user created by a domain admin, the delegated quota unless a smaller size is asked,
+//no quota and storage classes other than the default of the domain are given by the internal api only
+func (m Manager) delegatedQuota(domain string, size string, class string) (int64, error) {
+	limit := m.config.DelegatedQuota
+	if limit <= 0 {
+		limit = DefaultQuota
+	}
+
+	if class != "" && class != m.defaultStorageClass(domain) {
+		return 0, errors.Wrapf(ErrOutOfDomain, "storage class %s is granted by the admins", class)
+	}
+
+	if size == "" {
+		return limit, nil
+	}
+
+	n, err := parseSize(size)
+	if err != nil {
+		return 0, err
+	}
+
+	if n == 0 || n > limit {
+		return 0, errors.Wrapf(ErrOutOfDomain, "quota %s is over the %d bytes a domain admin may give", size, limit)
+	}
+
+	return n, nil
+}
+
+//what a request of a domain admin acts on, false when it is not a delegated action
+func (m Manager) delegatedTarget(requestType string, webRequst AlluxioWebRequest) (string, bool) {
+	switch requestType {
+	case RequestDomainCreateUser, RequestDomainDeleteUser, RequestDomainUsage:
+		return webRequst.Tenant, true
+
+	case RequestPolicyList:
+		return fmt.Sprintf("%+v", webRequst.Filter), !m.isAdmin(webRequst.User) && m.isDomainAdmin(webRequst.User, webRequst.Domain)
+
+	case RequestPolicyAdd, RequestPolicyRemove, RequestPolicyCheck:
+		return fmt.Sprintf("%s %v", webRequst.PType, webRequst.Rule), !m.isAdmin(webRequst.User) && m.isDomainAdmin(webRequst.User, webRequst.Domain)
+	}
+
+	//the files of another user of the domain
+	owner, ownerDomain := requestOwner(webRequst)
+	if owner == webRequst.User || ownerDomain != webRequst.Domain || !m.isDomainAdmin(webRequst.User, webRequst.Domain) {
+		return "", false
+	}
+
+	return owner + ":" + webRequst.FileName, true
+}
+
+//record a delegated action with the identity of the domain admin
+func (m Manager) auditDelegated(workerCtx *WorkerContext, baseResp BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+
+	target, ok := m.delegatedTarget(workerCtx.workerRequest.Type, webRequst)
+	if !ok || m.audit == nil {
+		return
+	}
+
+	err := m.audit.record(AuditEntry{
+		Time:     time.Now().Format(time.RFC3339),
+		Admin:    webRequst.User,
+		Domain:   webRequst.Domain,
+		Action:   workerCtx.workerRequest.Type,
+		Target:   target,
+		ClientIP: webRequst.ClientIP,
+		GUID:     webRequst.GUID,
+		ErrCode:  baseResp.ErrCode,
+	})
+
+	if err != nil {
+		workerCtx.logger.Errorf("Record audit of %s fail: %+v", webRequst.User, err)
+	}
+}
+
+//provision or deprovision a user of the domain of the admin, or report the usage of the domain
+func (m Manager) alluxioDomainAdmin (workerCtx *WorkerContext) ([]TenantUsage, string, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	tenant    := webRequst.Tenant
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	logger.Infof("User:%s, domain:%s will %s of tenant %s", user, domain, workerCtx.workerRequest.Type, tenant)
+
+	if verifiedCaller(workerCtx, user, domain) && m.isDomainAdmin(user, domain) {
+		logger.Infof("User:%s, domain:%s was permitted to administer the domain", user, domain)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to administer the domain", user, domain)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return nil, "", baseResp
+	}
+
+	if workerCtx.workerRequest.Type == RequestDomainUsage {
+		to := webRequst.To
+		if to == "" {
+			to = time.Now().Format(UsageDayFormat)
+		}
+
+		from := webRequst.From
+		if from == "" {
+			from = time.Now().AddDate(0, 0, -29).Format(UsageDayFormat)
+		}
+
+		return m.usage.report(domain, tenant, from, to).Tenants, "", baseResp
+	}
+
+	//the domain itself and the other admins are left to the internal api
+	err := checkTenantName(tenant)
+
+	if err == nil && (tenant == domain || m.isDomainAdmin(tenant, domain)) {
+		err = errors.Wrapf(ErrOutOfDomain, "tenant %s is the domain or one of its admins", tenant)
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		return nil, "", baseResp
+	}
+
+	if workerCtx.workerRequest.Type == RequestDomainCreateUser {
+		//the quota and class are the ones of the domain admin, not the ones the body asks for
+		var limit int64
+		limit, err = m.delegatedQuota(domain, webRequst.Size, webRequst.StorageClass)
+
+		if err != nil {
+			baseResp.ErrCode = ErrCodeUserDeny
+			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+			return nil, "", baseResp
+		}
+
+		webRequst.Size = strconv.FormatInt(limit, 10)
+		webRequst.StorageClass = m.defaultStorageClass(domain)
+
+		//an existing user keeps its quota and classes, it is not provisioned again
+		_, err = m.fs.GetStatus("/" + domain + "/" + tenant)
+
+		if err == nil {
+			err = errors.Wrapf(ErrTenantExists, "tenant %s of domain %s", tenant, domain)
+		} else if errors.Cause(err) == ErrStorageNotFound {
+			err = nil
+		}
+
+		if err != nil {
+			logger.Infof("User:%s, domain:%s was denied to create tenant %s: %s", user, domain, tenant, err)
+			baseResp.ErrCode = ErrCodeAllocateResFail
+			baseResp.ErrInfo = ErrInfoAllocateResFail
+			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+			return nil, "", baseResp
+		}
+	}
+
+	//the tenant takes the place of the admin in the request of allocate-res or free-res
+	webRequst.User = tenant
+	target := &WorkerContext{logger: logger, workerRequest: workerCtx.workerRequest}
+	target.workerRequest.Body = webRequst
+
+	trash := ""
+
+	if workerCtx.workerRequest.Type == RequestDomainCreateUser {
+		err = m.alluxioCreateUser(target)
+
+		if err != nil {
+			baseResp.ErrCode = ErrCodeAllocateResFail
+			baseResp.ErrInfo = ErrInfoAllocateResFail
+		}
+	} else {
+		trash, err = m.alluxioDeleteUser(target)
+
+		if err != nil {
+			baseResp.ErrCode = ErrCodeDeleteResFail
+			baseResp.ErrInfo = ErrInfoDeleteResFail
+		}
+	}
+
+	if err != nil {
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+	}
+
+	return nil, trash, baseResp
+}
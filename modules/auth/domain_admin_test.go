@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func TestCheckDomainRule(t *testing.T) {
+	assert.NoError(t, checkDomainRule(PolicyTypeP, []string{"user1", "domain1", "/domain1/user2/*", "read"}, "domain1", "superAdmin"))
+	assert.NoError(t, checkDomainRule(PolicyTypeG, []string{"user1", "editors", "domain1"}, "domain1", "superAdmin"))
+
+	//rules of another domain, or objects outside of the domain
+	err := checkDomainRule(PolicyTypeP, []string{"user1", "domain2", "/domain2/*", "*"}, "domain1", "superAdmin")
+	assert.Equal(t, ErrOutOfDomain, errors.Cause(err))
+	err = checkDomainRule(PolicyTypeP, []string{"user1", "domain1", "/domain2/*", "*"}, "domain1", "superAdmin")
+	assert.Equal(t, ErrOutOfDomain, errors.Cause(err))
+	err = checkDomainRule(PolicyTypeP, []string{"user1", "domain1", "/domain10/*", "*"}, "domain1", "superAdmin")
+	assert.Equal(t, ErrOutOfDomain, errors.Cause(err))
+	err = checkDomainRule(PolicyTypeG, []string{"user1", "editors", "domain2"}, "domain1", "superAdmin")
+	assert.Equal(t, ErrOutOfDomain, errors.Cause(err))
+
+	//the admin role is given and shaped by the admins of the config only
+	err = checkDomainRule(PolicyTypeG, []string{"user1", "superAdmin", "domain1"}, "domain1", "superAdmin")
+	assert.Equal(t, ErrOutOfDomain, errors.Cause(err))
+	err = checkDomainRule(PolicyTypeP, []string{"superAdmin", "domain1", "/domain1/*", "*"}, "domain1", "superAdmin")
+	assert.Equal(t, ErrOutOfDomain, errors.Cause(err))
+}
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	audit := newAuditLog(filepath.Join(dir, "audit.log"), logp.NewLogger("audit"))
+
+	assert.NoError(t, audit.record(AuditEntry{Admin: "admin1", Domain: "domain1", Action: RequestDomainCreateUser, Target: "user1"}))
+	assert.NoError(t, audit.record(AuditEntry{Admin: "admin1", Domain: "domain1", Action: RequestDomainDeleteUser, Target: "user1", ErrCode: ErrCodeDeleteResFail}))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(t, lines, 2) {
+		var entry AuditEntry
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+		assert.Equal(t, "admin1", entry.Admin)
+		assert.Equal(t, RequestDomainDeleteUser, entry.Action)
+		assert.Equal(t, ErrCodeDeleteResFail, entry.ErrCode)
+	}
+}
+
+func TestDomainAdminNeedsIdentity(t *testing.T) {
+	m, cleanup := newTestManager(t, "g, admin1, superAdmin, domain1", "p, superAdmin, domain1, /domain1/*, *")
+	defer cleanup()
+
+	request := AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "admin1", Domain: "domain1"}, Tenant: "user2"}
+
+	//an unsigned body naming a domain admin is refused
+	ctx, _ := testWorkerContext(RequestDomainCreateUser, request, nil)
+	_, _, baseResp := m.alluxioDomainAdmin(ctx)
+	assert.Equal(t, ErrCodeUserDeny, baseResp.ErrCode)
+	_, err := m.fs.GetStatus("/domain1/user2")
+	assert.Equal(t, ErrStorageNotFound, err)
+
+	ctx, _ = testWorkerContext(RequestPolicyList, request, nil)
+	_, _, baseResp = m.alluxioPolicyAdmin(ctx)
+	assert.Equal(t, ErrCodeUserDeny, baseResp.ErrCode)
+
+	//the same request of the caller of a token or signature
+	ctx, _ = testWorkerContext(RequestDomainCreateUser, request, nil)
+	ctx.workerRequest.GinContext.Set(ContextIdentity, Identity{User: "admin1", Domain: "domain1"})
+	_, _, baseResp = m.alluxioDomainAdmin(ctx)
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+	_, err = m.fs.GetStatus("/domain1/user2")
+	assert.NoError(t, err)
+
+	ctx, _ = testWorkerContext(RequestPolicyList, request, nil)
+	ctx.workerRequest.GinContext.Set(ContextIdentity, Identity{User: "admin1", Domain: "domain1"})
+	_, _, baseResp = m.alluxioPolicyAdmin(ctx)
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+}
+
+func TestDomainAdminCreateLimits(t *testing.T) {
+	m, cleanup := newTestManager(t, "g, admin1, superAdmin, domain1", "p, superAdmin, domain1, /domain1/*, *")
+	defer cleanup()
+
+	m.config.DelegatedQuota = 1 << 20
+
+	create := func(tenant string, size string, class string) BaseResponse {
+		request := AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "admin1", Domain: "domain1"},
+			Tenant: tenant, Size: size, StorageClass: class}
+		ctx, _ := testWorkerContext(RequestDomainCreateUser, request, nil)
+		ctx.workerRequest.GinContext.Set(ContextIdentity, Identity{User: "admin1", Domain: "domain1"})
+		_, _, baseResp := m.alluxioDomainAdmin(ctx)
+		return baseResp
+	}
+
+	//no unlimited quota, no quota over the delegated one and no premium class
+	assert.Equal(t, ErrCodeUserDeny, create("user2", "0", "").ErrCode)
+	assert.Equal(t, ErrCodeUserDeny, create("user2", "2M", "").ErrCode)
+	assert.Equal(t, ErrCodeUserDeny, create("user2", "", StorageClassCache).ErrCode)
+	_, err := m.fs.GetStatus("/domain1/user2")
+	assert.Equal(t, ErrStorageNotFound, err)
+
+	assert.Equal(t, ErrCodeOk, create("user2", "", "").ErrCode)
+	limit, ok := m.quotas.get("/domain1/user2/")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1<<20), limit)
+
+	assert.Equal(t, ErrCodeOk, create("user3", "512K", "").ErrCode)
+	limit, _ = m.quotas.get("/domain1/user3/")
+	assert.Equal(t, int64(512<<10), limit)
+
+	//an existing user is not provisioned again
+	assert.NoError(t, m.quotas.set("/domain1/user2/", 100))
+	assert.Equal(t, ErrCodeAllocateResFail, create("user2", "", "").ErrCode)
+	limit, _ = m.quotas.get("/domain1/user2/")
+	assert.Equal(t, int64(100), limit)
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"hexmeet.com/haishen/tuna/logp"
+	"hexmeet.com/haishen/tuna/utils"
+)
+
+/*********************Handle table, clients get an opaque token instead of the storage stream id****************************/
+
+// Handle errors
+var (
+	ErrHandleNotFound = errors.New("token_id is unknown or expired")
+	ErrHandleDenied   = errors.New("token_id belongs to another user")
+	ErrHandleMode     = errors.New("token_id was not opened for this operation")
+)
+
+type fileHandle struct {
+	token    string
+	user     string
+	domain   string
+	object   string
+	streamID int
+	write    bool
+	lastUsed time.Time
+}
+
+type handleTable struct {
+	fs      StorageBackend
+	lease   time.Duration
+	logger  *logp.Logger
+	mutex   sync.Mutex
+	handles map[string]*fileHandle
+}
+
+func newHandleTable(fs StorageBackend, lease time.Duration, logger *logp.Logger) *handleTable {
+	return &handleTable{
+		fs:      fs,
+		lease:   lease,
+		logger:  logger,
+		handles: make(map[string]*fileHandle),
+	}
+}
+
+//bind a stream to the user, domain and path that opened it
+func (t *handleTable) open(user string, domain string, object string, streamID int, write bool) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	handle := &fileHandle{
+		token:    utils.NewUUID(),
+		user:     user,
+		domain:   domain,
+		object:   object,
+		streamID: streamID,
+		write:    write,
+		lastUsed: time.Now(),
+	}
+	t.handles[handle.token] = handle
+
+	return handle.token
+}
+
+//find the handle of the token, a token of another tenant is denied, using it renews the lease
+func (t *handleTable) lookup(token string, user string, domain string, write bool) (fileHandle, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	handle, ok := t.handles[token]
+	if !ok {
+		return fileHandle{}, ErrHandleNotFound
+	}
+
+	if handle.user != user || handle.domain != domain {
+		return fileHandle{}, ErrHandleDenied
+	}
+
+	if handle.write != write {
+		return fileHandle{}, ErrHandleMode
+	}
+
+	handle.lastUsed = time.Now()
+
+	return *handle, nil
+}
+
+//drop the handle and close its stream
+func (t *handleTable) close(token string, user string, domain string) (fileHandle, error) {
+	t.mutex.Lock()
+
+	handle, ok := t.handles[token]
+	if !ok {
+		t.mutex.Unlock()
+		return fileHandle{}, ErrHandleNotFound
+	}
+
+	if handle.user != user || handle.domain != domain {
+		t.mutex.Unlock()
+		return fileHandle{}, ErrHandleDenied
+	}
+
+	delete(t.handles, token)
+	t.mutex.Unlock()
+
+	return *handle, t.fs.Close(handle.streamID)
+}
+
+//close the handles idle for longer than the lease
+func (t *handleTable) expire(doneChan chan bool) {
+	ticker := time.NewTicker(t.lease / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-doneChan:
+			return
+		case <-ticker.C:
+		}
+
+		t.closeIdle(time.Now())
+	}
+}
+
+//drop the handles not used for longer than the lease at now and close their streams
+func (t *handleTable) closeIdle(now time.Time) {
+	deadline := now.Add(-t.lease)
+	var expired []*fileHandle
+
+	t.mutex.Lock()
+	for token, handle := range t.handles {
+		if handle.lastUsed.Before(deadline) {
+			expired = append(expired, handle)
+			delete(t.handles, token)
+		}
+	}
+	t.mutex.Unlock()
+
+	for _, handle := range expired {
+		t.logger.Infof("Handle of %s opened by User:%s, domain:%s expired", handle.object, handle.user, handle.domain)
+		t.fs.Close(handle.streamID)
+	}
+}
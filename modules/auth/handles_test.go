@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func TestHandleTableOwner(t *testing.T) {
+	fs := newMemoryBackend()
+	assert.NoError(t, fs.CreateDirectory("/domain1/user1/", &DirectoryOption{Recursive: true}))
+	id, err := fs.CreateFile("/domain1/user1/a.txt", &FileOption{})
+	assert.NoError(t, err)
+
+	table := newHandleTable(fs, time.Minute, logp.NewLogger("handles"))
+	token := table.open("user1", "domain1", "/domain1/user1/a.txt", id, true)
+
+	//a token is bound to the user and the domain that opened it
+	_, err = table.lookup(token, "user2", "domain1", true)
+	assert.Equal(t, ErrHandleDenied, err)
+	_, err = table.lookup(token, "user1", "domain2", true)
+	assert.Equal(t, ErrHandleDenied, err)
+	_, err = table.close(token, "user2", "domain1")
+	assert.Equal(t, ErrHandleDenied, err)
+
+	_, err = table.lookup(token, "user1", "domain1", false)
+	assert.Equal(t, ErrHandleMode, err)
+
+	handle, err := table.lookup(token, "user1", "domain1", true)
+	assert.NoError(t, err)
+	assert.Equal(t, id, handle.streamID)
+
+	//the second close finds nothing, the stream is closed once
+	_, err = table.close(token, "user1", "domain1")
+	assert.NoError(t, err)
+	_, err = table.close(token, "user1", "domain1")
+	assert.Equal(t, ErrHandleNotFound, err)
+	_, err = table.lookup(token, "user1", "domain1", true)
+	assert.Equal(t, ErrHandleNotFound, err)
+}
+
+func TestHandleTableLease(t *testing.T) {
+	fs := newMemoryBackend()
+	assert.NoError(t, fs.CreateDirectory("/domain1/user1/", &DirectoryOption{Recursive: true}))
+	id, err := fs.CreateFile("/domain1/user1/a.txt", &FileOption{})
+	assert.NoError(t, err)
+
+	table := newHandleTable(fs, time.Minute, logp.NewLogger("handles"))
+	token := table.open("user1", "domain1", "/domain1/user1/a.txt", id, true)
+
+	table.closeIdle(time.Now().Add(30 * time.Second))
+	_, err = table.lookup(token, "user1", "domain1", true)
+	assert.NoError(t, err)
+
+	//the lease is over, the handle is dropped and its stream closed
+	table.closeIdle(time.Now().Add(2 * time.Minute))
+	_, err = table.lookup(token, "user1", "domain1", true)
+	assert.Equal(t, ErrHandleNotFound, err)
+	assert.Equal(t, ErrStorageBadStream, fs.Close(id))
+
+	_, err = table.close(token, "user1", "domain1")
+	assert.Equal(t, ErrHandleNotFound, err)
+}
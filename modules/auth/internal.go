@@ -0,0 +1,422 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+/*********************Internal api, its own listener and the trash of free-res****************************/
+
+// TrashRoot free-res moves a tenant under it, it is deleted when its retention is over or it is purged
+const TrashRoot = "/" + ReservedPrefix + "-trash/"
+
+// TrashStateSuffix the state of a trashed tenant is kept in the file of its trash name with the suffix
+const TrashStateSuffix = ".json"
+
+// ErrTrashNotFound no trashed tenant of the name
+var ErrTrashNotFound = errors.New("trashed tenant is not found")
+
+// ErrTenantNotEmpty free-res of a domain tenant while users of the domain still have folders
+var ErrTenantNotEmpty = errors.New("domain still holds the folders of its users")
+
+// InternalConfig listener and callers of allocate-res, free-res, set-quota and usage-report
+type InternalConfig struct {
+	Address        string   `json:"address"`        //host:port of the internal listener, empty serves the internal api on webport behind tokens or signatures
+	TLSCert        string   `json:"tlscert"`        //PEM certificate of the listener, plain http when empty
+	TLSKey         string   `json:"tlskey"`
+	ClientCA       string   `json:"clientca"`       //PEM CAs the client certificates must be signed by, none needed when empty
+	Tokens         []string `json:"tokens"`         //bearer tokens of the internal callers, none needed when empty
+	TrashRetention int      `json:"trashretention"` //hours a freed tenant is kept in the trash, 0 deletes it at once
+}
+
+//tenantState what free-res takes from a tenant besides its files, restore-res gives it back
+type tenantState struct {
+	Quota     int64      `json:"quota"`     //bytes, 0 is no quota
+	Policies  [][]string `json:"policies"`  //p rules of the tenant in its domain and the shares of its folder
+	Groupings [][]string `json:"groupings"` //roles of the tenant in its domain
+	Shares    [][]string `json:"shares"`    //the policies made by share among them
+}
+
+//tenantTrash keeps the freed tenants as /.tuna-trash/<domain>/<user>-<unix seconds>
+type tenantTrash struct {
+	fs        StorageBackend
+	retention time.Duration
+	logger    *logp.Logger
+}
+
+func newTenantTrash(fs StorageBackend, retention time.Duration, logger *logp.Logger) *tenantTrash {
+	return &tenantTrash{fs: fs, retention: retention, logger: logger}
+}
+
+//the user and the unix seconds of a trash name, false when it is not one
+func parseTrashName(name string) (string, int64, bool) {
+	i := strings.LastIndex(name, "-")
+	if i <= 0 {
+		return "", 0, false
+	}
+
+	at, err := strconv.ParseInt(name[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return name[:i], at, true
+}
+
+//move the tenant at object into the trash, the trash path is returned
+func (t *tenantTrash) move(domain string, user string, object string, now time.Time) (string, error) {
+	dir := TrashRoot + domain
+
+	err := t.fs.CreateDirectory(dir, &DirectoryOption{Recursive: true, AllowExists: true})
+	if err != nil {
+		return "", err
+	}
+
+	trash := fmt.Sprintf("%s/%s-%d", dir, user, now.Unix())
+
+	err = t.fs.Rename(strings.TrimRight(object, "/"), trash)
+	if err != nil {
+		return "", err
+	}
+
+	return trash, nil
+}
+
+//keep the state of the tenant moved to trash next to it
+func (t *tenantTrash) keep(trash string, state tenantState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	id, err := t.fs.CreateFile(trash + TrashStateSuffix, &FileOption{})
+	if err != nil {
+		return err
+	}
+
+	_, err = t.fs.Write(id, bytes.NewReader(data))
+	closeErr := t.fs.Close(id)
+
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+//the state kept next to trash, false for a trash freed before the states were kept
+func (t *tenantTrash) state(trash string) (tenantState, bool, error) {
+	var state tenantState
+
+	id, err := t.fs.OpenFile(trash + TrashStateSuffix, &OpenOption{})
+	if errors.Cause(err) == ErrStorageNotFound {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+	defer t.fs.Close(id)
+
+	r, err := t.fs.Read(id)
+	if err != nil {
+		return state, false, err
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return state, false, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return state, false, errors.Wrapf(err, "parse state of %s", trash)
+	}
+
+	return state, true, nil
+}
+
+//delete the state kept next to trash
+func (t *tenantTrash) forget(trash string) error {
+	err := t.fs.Delete(trash + TrashStateSuffix, &DeleteOption{})
+	if errors.Cause(err) == ErrStorageNotFound {
+		return nil
+	}
+
+	return err
+}
+
+//delete a trashed tenant and its state
+func (t *tenantTrash) drop(trash string) error {
+	err := t.fs.Delete(trash, &DeleteOption{Recursive: true})
+	if err != nil {
+		return err
+	}
+
+	return t.forget(trash)
+}
+
+//the trash path of a tenant, the latest one when name is empty
+func (t *tenantTrash) find(domain string, user string, name string) (string, error) {
+	if name != "" {
+		trashUser, _, ok := parseTrashName(name)
+		if !ok || trashUser != user {
+			return "", errors.Wrapf(ErrTrashNotFound, "%s is not a trash of user %s", name, user)
+		}
+
+		trash := TrashRoot + domain + "/" + name
+
+		_, err := t.fs.GetStatus(trash)
+		if err != nil {
+			return "", errors.Wrapf(ErrTrashNotFound, "%s: %s", name, err)
+		}
+
+		return trash, nil
+	}
+
+	statuses, err := t.fs.ListStatus(TrashRoot + domain)
+	if err != nil && errors.Cause(err) != ErrStorageNotFound {
+		return "", err
+	}
+
+	latest := ""
+	latestAt := int64(-1)
+
+	for _, status := range statuses {
+		trashUser, at, ok := parseTrashName(status.Name)
+		if ok && trashUser == user && at > latestAt {
+			latest = status.Name
+			latestAt = at
+		}
+	}
+
+	if latest == "" {
+		return "", errors.Wrapf(ErrTrashNotFound, "user %s, domain %s", user, domain)
+	}
+
+	return TrashRoot + domain + "/" + latest, nil
+}
+
+//delete the trashed tenants whose retention is over at now
+func (t *tenantTrash) expire(now time.Time) {
+	domains, err := t.fs.ListStatus(TrashRoot)
+	if err != nil {
+		if errors.Cause(err) != ErrStorageNotFound {
+			t.logger.Errorf("List %s fail: %+v", TrashRoot, err)
+		}
+		return
+	}
+
+	for _, domain := range domains {
+		statuses, err := t.fs.ListStatus(TrashRoot + domain.Name)
+		if err != nil {
+			t.logger.Errorf("List trash of domain %s fail: %+v", domain.Name, err)
+			continue
+		}
+
+		for _, status := range statuses {
+			_, at, ok := parseTrashName(status.Name)
+			if !ok || now.Sub(time.Unix(at, 0)) < t.retention {
+				continue
+			}
+
+			trash := path.Join(TrashRoot, domain.Name, status.Name)
+
+			err = t.drop(trash)
+			if err != nil {
+				t.logger.Errorf("Delete trash %s fail: %+v", trash, err)
+				continue
+			}
+
+			t.logger.Infof("Trash %s was kept %s and is deleted", trash, t.retention)
+		}
+	}
+}
+
+//delete the trash every hour
+func (t *tenantTrash) run(doneChan chan bool) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-doneChan:
+			return
+		case <-ticker.C:
+		}
+
+		t.expire(time.Now())
+	}
+}
+
+//a bearer token of the internal callers, compared in constant time
+func (m Manager) internalToken(c *gin.Context) bool {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" || token == c.GetHeader("Authorization") {
+		return false
+	}
+
+	for _, t := range m.config.Internal.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+//serve the internal api on its own address, with the client certificates checked when clientca is set
+func (m Manager) internalListen(router *gin.Engine) {
+	logger := m.logger.Named("internal")
+	config := m.config.Internal
+
+	server := &http.Server{Addr: config.Address, Handler: router}
+
+	if config.ClientCA != "" {
+		data, err := ioutil.ReadFile(config.ClientCA)
+		if err != nil {
+			logger.Panicf("internalListen: read client ca fail: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			logger.Panicf("internalListen: no certificate in %s", config.ClientCA)
+		}
+
+		server.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	}
+
+	var err error
+
+	if config.TLSCert != "" {
+		logger.Infof("Internal api listens on %s with tls", config.Address)
+		err = server.ListenAndServeTLS(config.TLSCert, config.TLSKey)
+	} else {
+		logger.Infof("Internal api listens on %s", config.Address)
+		err = server.ListenAndServe()
+	}
+
+	logger.Panicf("internalListen: %s", err)
+}
+
+//give a restored tenant back the rules, shares and quota it had when it was freed
+func (m Manager) restoreTenant(root string, state tenantState) error {
+	for _, policy := range state.Policies {
+		m.rbact.AddPolicy(policy[0], policy[1], policy[2], policy[3])
+	}
+
+	for _, rule := range state.Groupings {
+		m.rbact.AddGroupingPolicy(rule[0], rule[1], rule[2])
+	}
+
+	err := m.rbact.SavePolicy()
+
+	if err == nil {
+		err = m.shares.add(state.Shares)
+	}
+
+	if err == nil && state.Quota > 0 {
+		err = m.quotas.set(root, state.Quota)
+	}
+
+	return err
+}
+
+//move a tenant back from the trash with the rules, shares and quota it was freed with,
+//a trash without a kept state is granted again like allocate-res
+func (m Manager) alluxioRestoreUser (workerCtx *WorkerContext) (string, error) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger := workerCtx.logger
+	user := webRequst.User
+	domain := webRequst.Domain
+	object, err := resolveTenantRoot(domain, user)
+
+	if err != nil {
+		return "", err
+	}
+
+	trash, err := m.trash.find(domain, user, webRequst.Trash)
+
+	if err != nil {
+		return "", err
+	}
+
+	logger.Infof("User:%s, domain:%s will be restored from %s", user, domain, trash)
+
+	state, kept, err := m.trash.state(trash)
+
+	if err != nil {
+		return "", err
+	}
+
+	err = m.ensureParent(strings.TrimRight(object, "/"))
+
+	if err == nil {
+		err = m.fs.Rename(trash, strings.TrimRight(object, "/"))
+	}
+
+	if err == nil {
+		err = m.ttls.rename(trash, object)
+	}
+
+	if err != nil {
+		logger.Infof("User:%s, domain:%s was restored fail", user, domain)
+		return "", err
+	}
+
+	if !kept {
+		logger.Infof("User:%s, domain:%s has no kept state in %s, it is granted like allocate-res", user, domain, trash)
+		return trash, m.alluxioCreateUser(workerCtx)
+	}
+
+	err = m.restoreTenant(object, state)
+
+	if err == nil {
+		err = m.trash.forget(trash)
+	}
+
+	return trash, err
+}
+
+//delete a trashed tenant before its retention is over
+func (m Manager) alluxioPurgeUser (workerCtx *WorkerContext) (string, error) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger := workerCtx.logger
+	user := webRequst.User
+	domain := webRequst.Domain
+
+	_, err := resolveTenantRoot(domain, user)
+
+	if err != nil {
+		return "", err
+	}
+
+	trash, err := m.trash.find(domain, user, webRequst.Trash)
+
+	if err != nil {
+		return "", err
+	}
+
+	logger.Infof("User:%s, domain:%s will purge %s", user, domain, trash)
+
+	err = m.trash.drop(trash)
+
+	if err != nil {
+		return "", err
+	}
+
+	return trash, m.ttls.drop(trash)
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func TestParseTrashName(t *testing.T) {
+	user, at, ok := parseTrashName("alice-bob-1700000000")
+	assert.True(t, ok)
+	assert.Equal(t, "alice-bob", user)
+	assert.Equal(t, int64(1700000000), at)
+
+	_, _, ok = parseTrashName("alice")
+	assert.False(t, ok)
+
+	_, _, ok = parseTrashName("-1700000000")
+	assert.False(t, ok)
+
+	_, _, ok = parseTrashName("alice-x")
+	assert.False(t, ok)
+}
+
+func TestTenantTrash(t *testing.T) {
+	fs := newMemoryBackend()
+	assert.NoError(t, fs.CreateDirectory("/d1/alice/docs", &DirectoryOption{Recursive: true}))
+
+	trash := newTenantTrash(fs, time.Hour, logp.NewLogger("trash"))
+	now := time.Unix(1700000000, 0)
+
+	moved, err := trash.move("d1", "alice", "/d1/alice/", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "/.tuna-trash/d1/alice-1700000000", moved)
+
+	_, err = fs.GetStatus("/d1/alice")
+	assert.Equal(t, ErrStorageNotFound, err)
+	_, err = fs.GetStatus(moved + "/docs")
+	assert.NoError(t, err)
+
+	//freed again later, the latest one is found by default
+	assert.NoError(t, fs.CreateDirectory("/d1/alice", &DirectoryOption{}))
+	later, err := trash.move("d1", "alice", "/d1/alice/", now.Add(30*time.Minute))
+	assert.NoError(t, err)
+
+	found, err := trash.find("d1", "alice", "")
+	assert.NoError(t, err)
+	assert.Equal(t, later, found)
+
+	found, err = trash.find("d1", "alice", "alice-1700000000")
+	assert.NoError(t, err)
+	assert.Equal(t, moved, found)
+
+	//names of other users or paths are not trash of alice
+	_, err = trash.find("d1", "alice", "bob-1700000000")
+	assert.Equal(t, ErrTrashNotFound, errors.Cause(err))
+	_, err = trash.find("d1", "alice", "../alice-1700000000")
+	assert.Equal(t, ErrTrashNotFound, errors.Cause(err))
+	_, err = trash.find("d2", "alice", "")
+	assert.Equal(t, ErrTrashNotFound, errors.Cause(err))
+
+	//only the trash older than the retention is deleted
+	trash.expire(now.Add(time.Hour))
+	_, err = fs.GetStatus(moved)
+	assert.Equal(t, ErrStorageNotFound, err)
+	_, err = fs.GetStatus(later)
+	assert.NoError(t, err)
+}
+
+func TestInternalToken(t *testing.T) {
+	m := Manager{logger: logp.NewLogger("internal"), config: DefaultConfig()}
+	m.config.Internal.Tokens = []string{"token1"}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/free-res", m.internalAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	serve := func(authorization string) int {
+		req := httptest.NewRequest("POST", "/free-res", strings.NewReader("{}"))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("Bearer token1"))
+	assert.Equal(t, http.StatusUnauthorized, serve("Bearer token2"))
+	assert.Equal(t, http.StatusUnauthorized, serve("token1"))
+	assert.Equal(t, http.StatusUnauthorized, serve(""))
+}
+
+func TestDeleteDomainTenant(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, d1, d1, /d1/*, *", "p, alice, d1, /d1/alice/*, *")
+	defer cleanup()
+
+	m.config.Internal.TrashRetention = 72
+	m.trash = newTenantTrash(m.fs, 72*time.Hour, m.logger)
+
+	writeTestFile(t, m.fs, "/d1/d1/own.txt", "own")
+	writeTestFile(t, m.fs, "/d1/alice/a.txt", "alice")
+
+	//the domain tenant is not freed while alice has a folder in it
+	ctx, _ := testWorkerContext(RequestAlluxioDeleteUser, AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "d1", Domain: "d1"}}, nil)
+	_, err := m.alluxioDeleteUser(ctx)
+	assert.Equal(t, ErrTenantNotEmpty, errors.Cause(err))
+
+	_, err = m.fs.GetStatus("/d1/alice/a.txt")
+	assert.NoError(t, err)
+	_, err = m.fs.GetStatus("/d1/d1/own.txt")
+	assert.NoError(t, err)
+
+	ctx, _ = testWorkerContext(RequestAlluxioDeleteUser, AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "alice", Domain: "d1"}}, nil)
+	_, err = m.alluxioDeleteUser(ctx)
+	assert.NoError(t, err)
+
+	ctx, _ = testWorkerContext(RequestAlluxioDeleteUser, AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "d1", Domain: "d1"}}, nil)
+	trash, err := m.alluxioDeleteUser(ctx)
+	assert.NoError(t, err)
+
+	_, err = m.fs.GetStatus("/d1")
+	assert.Equal(t, ErrStorageNotFound, err)
+	_, err = m.fs.GetStatus(trash + "/d1/own.txt")
+	assert.NoError(t, err)
+}
+
+func TestRestoreTenant(t *testing.T) {
+	m, cleanup := newTestManager(t,
+		"p, user1, domain1, /domain1/user1/*, *",
+		"g, user1, user1, domain1",
+		"p, user2, domain1, /domain1/user2/*, *")
+	defer cleanup()
+
+	writeTestFile(t, m.fs, "/domain1/user1/a.txt", "hello")
+	writeTestFile(t, m.fs, "/domain1/user2/b.txt", "world")
+	assert.NoError(t, m.quotas.set("/domain1/user1/", 5000))
+	m.grantStorageClass("user1", "domain1", StorageClassArchive)
+
+	share := func(user string, file string, grantee string) {
+		ctx, _ := testWorkerContext(RequestAlluxioShare, AlluxioWebRequest{
+			RbactBaseRequest: RbactBaseRequest{User: user, Domain: "domain1"},
+			FileName:         file,
+			Grantee:          grantee,
+		}, nil)
+		assert.Equal(t, ErrCodeOk, m.alluxioShare(ctx).ErrCode)
+	}
+
+	share("user1", "a.txt", "user2")
+	share("user2", "b.txt", "user1")
+
+	tenant := AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "user1", Domain: "domain1"}}
+
+	ctx, _ := testWorkerContext(RequestAlluxioDeleteUser, tenant, nil)
+	trash, err := m.alluxioDeleteUser(ctx)
+	assert.NoError(t, err)
+	_, err = m.fs.GetStatus(trash + TrashStateSuffix)
+	assert.NoError(t, err)
+	assert.False(t, m.rbactCheckRights("user2", "domain1", "/domain1/user1/a.txt", "read"))
+
+	//the restored tenant gets its own quota, classes and shares, not the defaults of allocate-res
+	ctx, _ = testWorkerContext(RequestAlluxioRestoreUser, tenant, nil)
+	restored, err := m.alluxioRestoreUser(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, trash, restored)
+
+	_, err = m.fs.GetStatus("/domain1/user1/a.txt")
+	assert.NoError(t, err)
+	_, err = m.fs.GetStatus(trash + TrashStateSuffix)
+	assert.Equal(t, ErrStorageNotFound, errors.Cause(err))
+
+	limit, ok := m.quotas.get("/domain1/user1/")
+	assert.True(t, ok)
+	assert.Equal(t, int64(5000), limit)
+
+	_, err = m.resolveWriteType("user1", "domain1", StorageClassArchive)
+	assert.NoError(t, err)
+	assert.True(t, m.rbactCheckRights("user1", "domain1", "/domain1/user1/a.txt", "write"))
+	assert.True(t, m.rbactCheckRights("user2", "domain1", "/domain1/user1/a.txt", "read"))
+	assert.True(t, m.rbactCheckRights("user1", "domain1", "/domain1/user2/b.txt", "read"))
+
+	shares := collectShares(m.sharePolicies(m.rbact.GetPolicy()), func(entry ShareEntry) bool { return true })
+	assert.Len(t, shares, 2)
+}
+
+func TestPurgeTenant(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, user1, domain1, /domain1/user1/*, *")
+	defer cleanup()
+
+	writeTestFile(t, m.fs, "/domain1/user1/a.txt", "hello")
+
+	tenant := AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "user1", Domain: "domain1"}}
+
+	ctx, _ := testWorkerContext(RequestAlluxioDeleteUser, tenant, nil)
+	trash, err := m.alluxioDeleteUser(ctx)
+	assert.NoError(t, err)
+
+	//the trash and its kept state are deleted, there is nothing left to restore
+	ctx, _ = testWorkerContext(RequestAlluxioPurgeUser, tenant, nil)
+	purged, err := m.alluxioPurgeUser(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, trash, purged)
+
+	_, err = m.fs.GetStatus(trash)
+	assert.Equal(t, ErrStorageNotFound, errors.Cause(err))
+	_, err = m.fs.GetStatus(trash + TrashStateSuffix)
+	assert.Equal(t, ErrStorageNotFound, errors.Cause(err))
+
+	ctx, _ = testWorkerContext(RequestAlluxioRestoreUser, tenant, nil)
+	_, err = m.alluxioRestoreUser(ctx)
+	assert.Equal(t, ErrTrashNotFound, errors.Cause(err))
+
+	//a trash whose retention is over goes with its state too
+	writeTestFile(t, m.fs, "/domain1/user1/b.txt", "hello")
+	ctx, _ = testWorkerContext(RequestAlluxioDeleteUser, tenant, nil)
+	trash, err = m.alluxioDeleteUser(ctx)
+	assert.NoError(t, err)
+
+	m.trash.expire(time.Now().Add(73 * time.Hour))
+	_, err = m.fs.GetStatus(trash)
+	assert.Equal(t, ErrStorageNotFound, errors.Cause(err))
+	_, err = m.fs.GetStatus(trash + TrashStateSuffix)
+	assert.Equal(t, ErrStorageNotFound, errors.Cause(err))
+}
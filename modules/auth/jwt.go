@@ -0,0 +1,360 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+/*********************JWT bearer authentication, the user and domain come from the token instead of the body****************************/
+
+// JWT algorithms
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+)
+
+// ContextIdentity key of the caller in the gin context, set by the auth middlewares
+const ContextIdentity = "tuna.identity"
+
+// JWT errors
+var (
+	ErrTokenMissing     = errors.New("authorization bearer token is not set")
+	ErrTokenInvalid     = errors.New("token is not valid")
+	ErrTokenExpired     = errors.New("token has expired")
+	ErrIdentityMismatch = errors.New("user or domain of the request does not match the token")
+)
+
+// JWTConfig keys and claims of the bearer tokens
+type JWTConfig struct {
+	Enable        bool   `json:"enable"`
+	Algorithm     string `json:"algorithm"`     //HS256 or RS256
+	Secret        string `json:"secret"`        //key of HS256
+	PublicKeyFile string `json:"publickeyfile"` //PEM public key of RS256
+	UserClaim     string `json:"userclaim"`     //claim of the user, default is sub
+	DomainClaim   string `json:"domainclaim"`   //claim of the domain, default is domain
+	Issuer        string `json:"issuer"`        //iss the tokens must have, empty is any
+	Audience      string `json:"audience"`      //aud the tokens must have, empty is any
+	Leeway        int    `json:"leeway"`        //seconds of clock skew allowed on exp and nbf
+	AllowNoExp    bool   `json:"allownoexp"`    //accept tokens without exp, they never expire
+}
+
+// Identity the caller proven by a token or signature
+type Identity struct {
+	User   string
+	Domain string
+}
+
+// Authenticator turns a bearer token into the caller, the jwt keys of the config and an OIDC provider are two of them
+type Authenticator interface {
+	Authenticate(token string) (Identity, error)
+}
+
+//authenticatorChain tries its authenticators in turn, the first one accepting the token wins
+type authenticatorChain []Authenticator
+
+func (chain authenticatorChain) Authenticate(token string) (Identity, error) {
+	err := ErrTokenInvalid
+
+	for _, authenticator := range chain {
+		var identity Identity
+
+		identity, err = authenticator.Authenticate(token)
+		if err == nil {
+			return identity, nil
+		}
+	}
+
+	return Identity{}, err
+}
+
+type jwtVerifier struct {
+	config    JWTConfig
+	secret    []byte
+	publicKey *rsa.PublicKey
+	keyFunc   func(kid string) (*rsa.PublicKey, error) //the RS256 keys of a JWKS, by key id
+}
+
+func newJWTVerifier(config JWTConfig) (*jwtVerifier, error) {
+	v := &jwtVerifier{config: config}
+
+	if v.config.UserClaim == "" {
+		v.config.UserClaim = "sub"
+	}
+
+	if v.config.DomainClaim == "" {
+		v.config.DomainClaim = "domain"
+	}
+
+	switch config.Algorithm {
+	case JWTAlgHS256:
+		if config.Secret == "" {
+			return nil, errors.New("jwt secret is not set")
+		}
+		v.secret = []byte(config.Secret)
+
+	case JWTAlgRS256:
+		data, err := ioutil.ReadFile(config.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		v.publicKey, err = parseRSAPublicKey(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s", config.PublicKeyFile)
+		}
+
+	default:
+		return nil, errors.Errorf("jwt algorithm %q should be HS256 or RS256", config.Algorithm)
+	}
+
+	return v, nil
+}
+
+//a PEM "PUBLIC KEY" or "RSA PUBLIC KEY", or the public key of a certificate
+func parseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+
+	var key interface{}
+	var err error
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+
+	return publicKey, nil
+}
+
+//check the signature of the token and its time and audience claims
+func (v *jwtVerifier) claims(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.Wrap(ErrTokenInvalid, "token should have 3 parts")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, err
+	}
+
+	//the algorithm is fixed by the config, "none" or a HS256 token signed with the RSA public key are refused
+	if header.Alg != v.config.Algorithm {
+		return nil, errors.Wrapf(ErrTokenInvalid, "algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(ErrTokenInvalid, "signature is not base64url")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+
+	publicKey := v.publicKey
+	if v.keyFunc != nil {
+		publicKey, err = v.keyFunc(header.Kid)
+		if err != nil {
+			return nil, errors.Wrapf(ErrTokenInvalid, "key %q: %s", header.Kid, err)
+		}
+	}
+
+	if header.Alg == JWTAlgRS256 {
+		digest := sha256.Sum256(signed)
+		err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature)
+	} else {
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			err = ErrTokenInvalid
+		}
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(ErrTokenInvalid, "signature does not match")
+	}
+
+	claims := make(map[string]interface{})
+
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	leeway := int64(v.config.Leeway)
+
+	//a token without exp would be good forever, it is refused unless the config allows it
+	exp, ok := claims["exp"].(float64)
+	if !ok && !v.config.AllowNoExp {
+		return nil, errors.Wrap(ErrTokenInvalid, "claim exp is not set")
+	}
+
+	if ok && now.Unix() > int64(exp)+leeway {
+		return nil, ErrTokenExpired
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Unix()+leeway < int64(nbf) {
+		return nil, errors.Wrap(ErrTokenInvalid, "token is not valid yet")
+	}
+
+	if v.config.Issuer != "" && claims["iss"] != v.config.Issuer {
+		return nil, errors.Wrapf(ErrTokenInvalid, "issuer %v", claims["iss"])
+	}
+
+	if v.config.Audience != "" && !hasAudience(claims["aud"], v.config.Audience) {
+		return nil, errors.Wrapf(ErrTokenInvalid, "audience %v", claims["aud"])
+	}
+
+	return claims, nil
+}
+
+// Authenticate the caller of a token signed with the keys of the config
+func (v *jwtVerifier) Authenticate(token string) (Identity, error) {
+	return v.verify(token, time.Now())
+}
+
+//the caller named by a valid token
+func (v *jwtVerifier) verify(token string, now time.Time) (Identity, error) {
+	claims, err := v.claims(token, now)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	user, _ := claims[v.config.UserClaim].(string)
+	domain, _ := claims[v.config.DomainClaim].(string)
+
+	if user == "" || domain == "" {
+		return Identity{}, errors.Wrapf(ErrTokenInvalid, "claims %s and %s should be set", v.config.UserClaim, v.config.DomainClaim)
+	}
+
+	return Identity{User: user, Domain: domain}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.Wrap(ErrTokenInvalid, "segment is not base64url")
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return errors.Wrap(ErrTokenInvalid, "segment is not json")
+	}
+
+	return nil
+}
+
+//aud is a string or a list of strings
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//the caller set by an auth middleware, false when authentication is off
+func identityOf(c *gin.Context) (Identity, bool) {
+	value, ok := c.Get(ContextIdentity)
+	if !ok {
+		return Identity{}, false
+	}
+
+	identity, ok := value.(Identity)
+
+	return identity, ok
+}
+
+//fill the user and domain of a request from the identity, a request naming somebody else is refused
+func bindIdentity(identity Identity, req *RbactBaseRequest) error {
+	if req.User == "" {
+		req.User = identity.User
+	}
+
+	if req.Domain == "" {
+		req.Domain = identity.Domain
+	}
+
+	if req.User != identity.User || req.Domain != identity.Domain {
+		return errors.Wrapf(ErrIdentityMismatch, "user %s, domain %s", req.User, req.Domain)
+	}
+
+	return nil
+}
+
+//refuse a request without a valid bearer token, user and domain of the query must match the token too
+func (m Manager) bearerAuth() gin.HandlerFunc {
+	logger := m.logger.Named("bearer")
+
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+		var identity Identity
+		var err error
+
+		if token == "" || token == c.GetHeader("Authorization") {
+			err = ErrTokenMissing
+		} else {
+			identity, err = m.bearer.Authenticate(token)
+		}
+
+		if err == nil {
+			err = bindIdentity(identity, &RbactBaseRequest{User: c.Query("user"), Domain: c.Query("domain")})
+		}
+
+		if err != nil {
+			logger.Infof("%s %s from client %s is unauthorized: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, BaseResponse{ErrCode: ErrCodeUnauthorized,
+				ErrInfo: ErrInfoUnauthorized,
+				MoreInfo: fmt.Sprintf("Err: %s", err)})
+			return
+		}
+
+		c.Set(ContextIdentity, identity)
+		c.Next()
+	}
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func signJWT(t *testing.T, alg string, key interface{}, claims map[string]interface{}) string {
+	return signJWTHeader(t, map[string]string{"alg": alg, "typ": "JWT"}, key, claims)
+}
+
+func signJWTHeader(t *testing.T, fields map[string]string, key interface{}, claims map[string]interface{}) string {
+	header, err := json.Marshal(fields)
+	assert.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifyHS256(t *testing.T) {
+	v, err := newJWTVerifier(JWTConfig{Algorithm: JWTAlgHS256, Secret: "secret", Audience: "tuna"})
+	assert.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	claims := map[string]interface{}{"sub": "user1", "domain": "domain1", "exp": now.Unix() + 60, "aud": []string{"tuna"}}
+
+	identity, err := v.verify(signJWT(t, JWTAlgHS256, []byte("secret"), claims), now)
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{User: "user1", Domain: "domain1"}, identity)
+
+	_, err = v.verify(signJWT(t, JWTAlgHS256, []byte("other"), claims), now)
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+
+	_, err = v.verify(signJWT(t, "none", []byte{}, claims), now)
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+
+	_, err = v.verify(signJWT(t, JWTAlgHS256, []byte("secret"), claims), now.Add(61*time.Second))
+	assert.Equal(t, ErrTokenExpired, err)
+
+	//a token without exp never expires, it needs the consent of the config
+	delete(claims, "exp")
+	_, err = v.verify(signJWT(t, JWTAlgHS256, []byte("secret"), claims), now)
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+
+	v.config.AllowNoExp = true
+	_, err = v.verify(signJWT(t, JWTAlgHS256, []byte("secret"), claims), now)
+	assert.NoError(t, err)
+
+	claims["aud"] = "other"
+	_, err = v.verify(signJWT(t, JWTAlgHS256, []byte("secret"), claims), now)
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+
+	delete(claims, "aud")
+	delete(claims, "domain")
+	_, err = v.verify(signJWT(t, JWTAlgHS256, []byte("secret"), claims), now)
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+}
+
+func TestJWTVerifyRS256(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-jwt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+	file := filepath.Join(dir, "jwt.pem")
+	assert.NoError(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644))
+
+	v, err := newJWTVerifier(JWTConfig{Algorithm: JWTAlgRS256, PublicKeyFile: file, UserClaim: "uid", DomainClaim: "tenant"})
+	assert.NoError(t, err)
+
+	claims := map[string]interface{}{"uid": "user2", "tenant": "domain1", "exp": time.Now().Unix() + 60}
+
+	identity, err := v.verify(signJWT(t, JWTAlgRS256, key, claims), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{User: "user2", Domain: "domain1"}, identity)
+
+	//a HS256 token keyed with the public key must not pass
+	pub, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	_, err = v.verify(signJWT(t, JWTAlgHS256, pub, claims), time.Now())
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+}
+
+func TestJWTAuthMiddleware(t *testing.T) {
+	v, err := newJWTVerifier(JWTConfig{Algorithm: JWTAlgHS256, Secret: "secret"})
+	assert.NoError(t, err)
+	m := Manager{bearer: v, logger: logp.NewLogger("jwt")}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(m.bearerAuth())
+	router.GET("/whoami", func(c *gin.Context) {
+		identity, ok := identityOf(c)
+		assert.True(t, ok)
+		c.String(http.StatusOK, identity.User+"@"+identity.Domain)
+	})
+
+	token := signJWT(t, JWTAlgHS256, []byte("secret"), map[string]interface{}{"sub": "user1", "domain": "domain1",
+		"exp": time.Now().Unix() + 60})
+
+	for _, tc := range []struct {
+		target string
+		auth   string
+		code   int
+	}{
+		{"/whoami", "Bearer " + token, http.StatusOK},
+		{"/whoami?user=user1&domain=domain1", "Bearer " + token, http.StatusOK},
+		{"/whoami?user=root", "Bearer " + token, http.StatusUnauthorized},
+		{"/whoami", "", http.StatusUnauthorized},
+		{"/whoami", token, http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.code, w.Code, "%s %s", tc.target, tc.auth)
+	}
+
+	//a body naming somebody else is refused, an empty one is filled from the token
+	req := RbactBaseRequest{}
+	assert.NoError(t, bindIdentity(Identity{User: "user1", Domain: "domain1"}, &req))
+	assert.Equal(t, "user1", req.User)
+	assert.Equal(t, "domain1", req.Domain)
+
+	req = RbactBaseRequest{User: "root", Domain: "domain1"}
+	assert.Equal(t, ErrIdentityMismatch, errors.Cause(bindIdentity(Identity{User: "user1", Domain: "domain1"}, &req)))
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*********************Directory listing of a tenant****************************/
+
+// Listing page sizes
+const (
+	ListDefaultLimit = 100
+	ListMaxLimit     = 1000
+)
+
+// FileEntry one file or directory of a listing
+type FileEntry struct {
+	Name             string `json:"name"`
+	Path             string `json:"path"` //relative to the tenant folder, usable as file_name
+	Size             int64  `json:"size"`
+	Type             string `json:"type"` //file or directory
+	ModificationTime int64  `json:"modification_time"` //milliseconds
+	PersistenceState string `json:"persistence_state"`
+	TTLRemaining     *int64 `json:"ttl_remaining,omitempty"` //seconds until the ttl action, only with a ttl
+}
+
+func newFileEntry(status FileStatus, root string) FileEntry {
+	entry := FileEntry{
+		Name:             status.Name,
+		Path:             strings.TrimPrefix(status.Path, root),
+		Size:             status.Length,
+		Type:             "file",
+		ModificationTime: status.LastModificationTimeMs,
+		PersistenceState: status.PersistenceState,
+	}
+
+	if status.Folder {
+		entry.Type = "directory"
+	}
+
+	if status.TTL > 0 {
+		remaining := (status.CreationTimeMs + status.TTL - nowMs()) / 1000
+		if remaining < 0 {
+			remaining = 0
+		}
+		entry.TTLRemaining = &remaining
+	}
+
+	return entry
+}
+
+//list dir, and the directories under it when recursive
+func (m Manager) listStatus(dir string, recursive bool) ([]FileStatus, error) {
+	statuses, err := m.fs.ListStatus(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !recursive {
+		return statuses, nil
+	}
+
+	all := statuses
+	for _, status := range statuses {
+		if !status.Folder {
+			continue
+		}
+
+		children, err := m.listStatus(status.Path, recursive)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, children...)
+	}
+
+	return all, nil
+}
+
+//list a folder of the tenant, sorted by path, entries the user may not read are left out,
+//cursor is the path of the last entry of the previous page
+func (m Manager) alluxioList (workerCtx *WorkerContext) ([]FileEntry, string, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	owner, ownerDomain := requestOwner(webRequst)
+	root      := "/" + ownerDomain + "/" + owner + "/"
+	object, pathErr := resolveObject(ownerDomain, owner, webRequst.FileName)
+	entries   := []FileEntry{}
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return entries, "", baseResp
+	}
+
+	limit := webRequst.Limit
+	if limit <= 0 {
+		limit = ListDefaultLimit
+	}
+	if limit > ListMaxLimit {
+		limit = ListMaxLimit
+	}
+
+	logger.Infof("User:%s, domain:%s will list %s", user, domain, object)
+
+	//the directory is checked before it is read, so a denied user cannot tell whether it exists
+	if m.rbactCheckRights(user, domain, strings.TrimSuffix(object, "/")+"/", "read") {
+		logger.Infof("User:%s, domain:%s was permitted to list %s", user, domain, object)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to list %s", user, domain, object)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return entries, "", baseResp
+	}
+
+	statuses, err := m.listStatus(object, webRequst.Recursive)
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeListFail
+		baseResp.ErrInfo = ErrInfoListFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("List %s fail: %+v", object, err)
+		return entries, "", baseResp
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Path < statuses[j].Path })
+
+	for i := range statuses {
+		m.ttls.fill(&statuses[i])
+	}
+
+	nextCursor := ""
+	denied := 0
+
+	for _, status := range statuses {
+		entry := newFileEntry(status, root)
+
+		if webRequst.Cursor != "" && entry.Path <= webRequst.Cursor {
+			continue
+		}
+
+		if !strings.HasPrefix(entry.Path, webRequst.Prefix) {
+			continue
+		}
+
+		if !m.rbactCheckRights(user, domain, status.Path, "read") {
+			denied++
+			continue
+		}
+
+		if len(entries) == limit {
+			nextCursor = entries[len(entries)-1].Path
+			break
+		}
+
+		entries = append(entries, entry)
+	}
+
+	logger.Infof("User:%s, domain:%s listed %d entries of %s, %d were denied", user, domain, len(entries), object, denied)
+
+	return entries, nextCursor, baseResp
+}
+
+/*********************File metadata of a tenant****************************/
+
+// FileStat details of one file or directory
+type FileStat struct {
+	FileEntry
+	BlockSize          int64  `json:"block_size"`
+	CreationTime       int64  `json:"creation_time"` //milliseconds
+	InMemoryPercentage int32  `json:"in_memory_percentage"`
+	Persisted          bool   `json:"persisted"`
+	Pinned             bool   `json:"pinned"`
+	TTL                int64  `json:"ttl"` //milliseconds after creation, -1 is no ttl
+	TTLAction          string `json:"ttl_action,omitempty"`
+}
+
+func newFileStat(status FileStatus, root string) FileStat {
+	return FileStat{
+		FileEntry:          newFileEntry(status, root),
+		BlockSize:          status.BlockSizeBytes,
+		CreationTime:       status.CreationTimeMs,
+		InMemoryPercentage: status.InMemoryPercentage,
+		Persisted:          status.Persisted,
+		Pinned:             status.Pinned,
+		TTL:                status.TTL,
+		TTLAction:          status.TTLAction,
+	}
+}
+
+func (m Manager) alluxioStat (workerCtx *WorkerContext) (*FileStat, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	owner, ownerDomain := requestOwner(webRequst)
+	root      := "/" + ownerDomain + "/" + owner + "/"
+	object, pathErr := resolveObject(ownerDomain, owner, webRequst.FileName)
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return nil, baseResp
+	}
+
+	logger.Infof("User:%s, domain:%s will stat %s", user, domain, object)
+
+	if m.rbactCheckRights(user, domain, object, "read") {
+		logger.Infof("User:%s, domain:%s was permitted to stat %s", user, domain, object)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to stat %s", user, domain, object)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return nil, baseResp
+	}
+
+	status, err := m.fs.GetStatus(object)
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeStatFail
+		baseResp.ErrInfo = ErrInfoStatFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Stat %s fail: %+v", object, err)
+		return nil, baseResp
+	}
+
+	m.ttls.fill(&status)
+
+	stat := newFileStat(status, root)
+
+	return &stat, baseResp
+}
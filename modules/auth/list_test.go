@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listNames(entries []FileEntry) []string {
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Path)
+	}
+
+	return names
+}
+
+func TestListCursor(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, user1, domain1, /domain1/user1/*, *")
+	defer cleanup()
+
+	for _, file := range []string{"a.txt", "b.txt", "c.txt", "pub/a.txt"} {
+		writeTestFile(t, m.fs, "/domain1/user1/"+file, "hello")
+	}
+
+	request := AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "user1", Domain: "domain1"}, Limit: 2}
+
+	ctx, _ := testWorkerContext(RequestAlluxioList, request, nil)
+	entries, next, baseResp := m.alluxioList(ctx)
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, listNames(entries))
+	assert.Equal(t, "b.txt", next)
+
+	//the last page has no next_cursor
+	request.Cursor = next
+	ctx, _ = testWorkerContext(RequestAlluxioList, request, nil)
+	entries, next, baseResp = m.alluxioList(ctx)
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+	assert.Equal(t, []string{"c.txt", "pub"}, listNames(entries))
+	assert.Equal(t, "", next)
+
+	request.Cursor = ""
+	request.Recursive = true
+	request.Limit = 0
+	ctx, _ = testWorkerContext(RequestAlluxioList, request, nil)
+	entries, next, _ = m.alluxioList(ctx)
+	assert.Equal(t, []string{"a.txt", "b.txt", "c.txt", "pub", "pub/a.txt"}, listNames(entries))
+	assert.Equal(t, "", next)
+}
+
+func TestListDenied(t *testing.T) {
+	m, cleanup := newTestManager(t,
+		"p, user1, domain1, /domain1/user1/*, *",
+		"p, user2, domain1, /domain1/user1/pub/*, read",
+		"p, user3, domain1, /domain1/user1/pub/, read",
+		"p, user3, domain1, /domain1/user1/pub/a.txt, read")
+	defer cleanup()
+
+	for _, file := range []string{"a.txt", "pub/a.txt", "pub/b.txt"} {
+		writeTestFile(t, m.fs, "/domain1/user1/"+file, "hello")
+	}
+
+	list := func(user string, dir string) ([]FileEntry, BaseResponse) {
+		request := AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: user, Domain: "domain1"}, Owner: "user1", FileName: dir}
+		ctx, _ := testWorkerContext(RequestAlluxioList, request, nil)
+		entries, _, baseResp := m.alluxioList(ctx)
+
+		return entries, baseResp
+	}
+
+	entries, baseResp := list("user2", "pub")
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+	assert.Equal(t, []string{"pub/a.txt", "pub/b.txt"}, listNames(entries))
+
+	//entries the user may not read are left out
+	entries, baseResp = list("user3", "pub")
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+	assert.Equal(t, []string{"pub/a.txt"}, listNames(entries))
+
+	//a denied directory is refused the same whether it exists or not
+	_, baseResp = list("user2", "")
+	assert.Equal(t, ErrCodeUserDeny, baseResp.ErrCode)
+	_, baseResp = list("user2", "missing")
+	assert.Equal(t, ErrCodeUserDeny, baseResp.ErrCode)
+
+	_, baseResp = list("user1", "missing")
+	assert.Equal(t, ErrCodeListFail, baseResp.ErrCode)
+}
+
+func TestStatDenied(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, user2, domain1, /domain1/user1/pub/*, read")
+	defer cleanup()
+
+	writeTestFile(t, m.fs, "/domain1/user1/a.txt", "hello")
+	writeTestFile(t, m.fs, "/domain1/user1/pub/a.txt", "hello")
+
+	stat := func(file string) (*FileStat, BaseResponse) {
+		request := AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "user2", Domain: "domain1"}, Owner: "user1", FileName: file}
+		ctx, _ := testWorkerContext(RequestAlluxioStat, request, nil)
+
+		return m.alluxioStat(ctx)
+	}
+
+	result, baseResp := stat("pub/a.txt")
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+	if assert.NotNil(t, result) {
+		assert.Equal(t, "pub/a.txt", result.Path)
+		assert.Equal(t, int64(5), result.Size)
+	}
+
+	_, baseResp = stat("pub/missing.txt")
+	assert.Equal(t, ErrCodeStatFail, baseResp.ErrCode)
+
+	_, baseResp = stat("a.txt")
+	assert.Equal(t, ErrCodeUserDeny, baseResp.ErrCode)
+	_, baseResp = stat("missing.txt")
+	assert.Equal(t, ErrCodeUserDeny, baseResp.ErrCode)
+}
@@ -7,7 +7,6 @@ import (
 	"net/http"
 	"time"
 	"github.com/casbin/casbin"
-	alluxio "github.com/Alluxio/alluxio-go"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,7 +20,19 @@ type Manager struct {
 	waitgroup      sync.WaitGroup
 	httpClient     *http.Client
 	rbact          *casbin.Enforcer
-	fs             *alluxio.Client
+	fs             StorageBackend
+	uploads        *uploadSessionStore
+	handles        *handleTable
+	quotas         *quotaStore
+	usage          *usageTracker
+	ttls           *ttlStore
+	shares         *shareStore
+	preloads       *preloader
+	presignKey     []byte
+	bearer         Authenticator
+	accounts       *accountStore
+	trash          *tenantTrash
+	audit          *auditLog
 }
 
 // WorkerRequest request wrapper
@@ -56,12 +67,110 @@ func Run() {
 	//RBAC load model and policy
 	manager.rbact = casbin.NewEnforcer("./data/tenants.conf", "./data/tenants.csv")
 
-	//start alluxio agent
-	manager.fs = alluxio.NewClient("172.25.0.113", 39999, 10*time.Second)
+	//start storage backend, alluxio agent by default
+	fs, err := newStorageBackend(config)
+	if err != nil {
+		logger.Panicf("Run: create storage backend fail: %s", err)
+	}
+	manager.fs = fs
+
+	//the handle api hands out tokens instead of stream ids
+	manager.handles = newHandleTable(fs, time.Duration(config.HandleLease) * time.Second, logger.Named("handle"))
+
+	//the key of presigned urls
+	manager.presignKey, err = loadPresignKey(config.PresignSecret, logger)
+	if err != nil {
+		logger.Panicf("Run: create presign key fail: %s", err)
+	}
+
+	//bearer tokens instead of the user and domain of the body
+	var bearers authenticatorChain
+
+	if config.JWT.Enable {
+		verifier, err := newJWTVerifier(config.JWT)
+		if err != nil {
+			logger.Panicf("Run: load jwt keys fail: %s", err)
+		}
+		bearers = append(bearers, verifier)
+	}
+
+	if config.OIDC.Enable {
+		provider, err := newOIDCAuthenticator(config.OIDC, logger.Named("oidc"))
+		if err != nil {
+			logger.Panicf("Run: create oidc authenticator fail: %s", err)
+		}
+		bearers = append(bearers, provider)
+	}
+
+	if len(bearers) > 0 {
+		manager.bearer = bearers
+	}
+
+	//api keys of the services that sign their requests
+	manager.accounts, err = newAccountStore(config.ServiceAccountFile, time.Duration(config.SignatureWindow) * time.Second)
+	if err != nil {
+		logger.Panicf("Run: load service accounts fail: %s", err)
+	}
+
+	manager.quotas, err = newQuotaStore(config.QuotaFile)
+	if err != nil {
+		logger.Panicf("Run: load quotas fail: %s", err)
+	}
+
+	//ttls of the backends that have none
+	manager.ttls, err = newTTLStore(fs, config.TTLFile, logger.Named("ttl"))
+	if err != nil {
+		logger.Panicf("Run: load ttls fail: %s", err)
+	}
+
+	//the policies made by share, told apart from the rules of the admins
+	manager.shares, err = newShareStore(config.ShareFile)
+	if err != nil {
+		logger.Panicf("Run: load shares fail: %s", err)
+	}
+
+	//the actions of the domain admins on the users of their domains
+	manager.audit = newAuditLog(config.AuditFile, logger.Named("audit"))
+
+	//free-res moves the tenants to the trash, they are deleted when the retention is over
+	manager.trash = newTenantTrash(fs, time.Duration(config.Internal.TrashRetention) * time.Hour, logger.Named("trash"))
+
+	//preloads read files into the Alluxio cache in the background
+	manager.preloads = newPreloader(fs, config.PreloadQueue, logger.Named("preload"))
+
+	//usage figures for billing, scanned from the storage and counted by the handlers
+	manager.usage, err = newUsageTracker(fs, config.UsageFile, time.Duration(config.UsageScanInterval) * time.Minute,
+		config.UsageRetention, logger.Named("usage"))
+	if err != nil {
+		logger.Panicf("Run: load usage fail: %s", err)
+	}
+
+	//resumable upload sessions survive a restart, they hold their bytes in the quotas
+	manager.uploads, err = newUploadSessionStore(config.UploadSessionDir,
+		time.Duration(config.UploadSessionExpiry) * time.Minute, manager.quotas, manager.usage, logger.Named("upload-session"))
+	if err != nil {
+		logger.Panicf("Run: load upload sessions fail: %s", err)
+	}
 
 	//to select a free worker  to handle task
 	go manager.dispatch()
 
+	go manager.uploads.collect(manager.doneChan)
+
+	go manager.handles.expire(manager.doneChan)
+
+	go manager.usage.run(manager.doneChan)
+
+	go manager.ttls.sweep(manager.doneChan)
+
+	if config.Internal.TrashRetention > 0 {
+		go manager.trash.run(manager.doneChan)
+	}
+
+	for i := 0; i < config.PreloadWorkers; i++ {
+		go manager.preloads.run(manager.doneChan)
+	}
+
 	for i := 0; i < config.MaxWorker; i++ {
 		workerID := fmt.Sprintf("worker_%d", i)
 		go manager.work(workerID)
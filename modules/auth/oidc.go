@@ -0,0 +1,363 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+/*********************OIDC and OAuth2 access tokens of an identity provider****************************/
+
+// OIDC validation modes
+const (
+	OIDCModeJWKS          = "jwks"          //verify the signature with the keys published by the provider
+	OIDCModeIntrospection = "introspection" //ask the provider about each token, RFC 7662
+)
+
+// OIDCConfig provider and claim rules of the access tokens
+type OIDCConfig struct {
+	Enable           bool              `json:"enable"`
+	Mode             string            `json:"mode"`             //jwks or introspection
+	Issuer           string            `json:"issuer"`           //base of /.well-known/openid-configuration, iss of the tokens
+	JWKSURL          string            `json:"jwksurl"`          //jwks_uri of the discovery when empty
+	IntrospectionURL string            `json:"introspectionurl"` //introspection_endpoint of the discovery when empty
+	ClientID         string            `json:"clientid"`         //basic auth of the introspection
+	ClientSecret     string            `json:"clientsecret"`
+	Audience         string            `json:"audience"`      //aud the tokens must have, empty is any
+	UserClaim        string            `json:"userclaim"`     //claim of the casbin subject, a.b is claim b of object a
+	DomainClaim      string            `json:"domainclaim"`   //claim of the casbin domain
+	DefaultDomain    string            `json:"defaultdomain"` //domain of a token without the domain claim
+	DomainMap        map[string]string `json:"domainmap"`     //value of the domain claim -> casbin domain
+	CacheTTL         int               `json:"cachettl"`      //seconds a checked token is remembered, cut to its exp
+	Timeout          int               `json:"timeout"`       //milliseconds of a call to the provider
+	Leeway           int               `json:"leeway"`        //seconds of clock skew allowed on exp and nbf
+}
+
+type oidcCacheEntry struct {
+	identity Identity
+	expire   time.Time
+}
+
+// oidcAuthenticator checks the access tokens of a provider, the discovery and the keys are fetched on first use
+// so tuna starts while the provider is down
+type oidcAuthenticator struct {
+	config   OIDCConfig
+	client   *http.Client
+	logger   *logp.Logger
+	verifier *jwtVerifier
+
+	mutex  sync.Mutex
+	keys   map[string]*rsa.PublicKey
+	keysAt time.Time
+	cache  map[string]oidcCacheEntry
+}
+
+func newOIDCAuthenticator(config OIDCConfig, logger *logp.Logger) (*oidcAuthenticator, error) {
+	if config.Mode != OIDCModeJWKS && config.Mode != OIDCModeIntrospection {
+		return nil, errors.Errorf("oidc mode %q should be jwks or introspection", config.Mode)
+	}
+
+	if config.Issuer == "" && (config.Mode == OIDCModeJWKS && config.JWKSURL == "" ||
+		config.Mode == OIDCModeIntrospection && config.IntrospectionURL == "") {
+		return nil, errors.New("oidc issuer or the url of its mode should be set")
+	}
+
+	if config.UserClaim == "" {
+		config.UserClaim = "sub"
+	}
+
+	o := &oidcAuthenticator{
+		config: config,
+		client: &http.Client{Timeout: time.Duration(config.Timeout) * time.Millisecond},
+		logger: logger,
+		cache:  make(map[string]oidcCacheEntry),
+	}
+
+	o.verifier = &jwtVerifier{
+		config: JWTConfig{
+			Algorithm: JWTAlgRS256,
+			Issuer:    config.Issuer,
+			Audience:  config.Audience,
+			Leeway:    config.Leeway,
+		},
+		keyFunc: o.key,
+	}
+
+	return o, nil
+}
+
+// Authenticate the caller of an access token, a token checked before is taken from the cache
+func (o *oidcAuthenticator) Authenticate(token string) (Identity, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	o.mutex.Lock()
+	entry, ok := o.cache[key]
+	o.mutex.Unlock()
+
+	if ok && now.Before(entry.expire) {
+		return entry.identity, nil
+	}
+
+	var claims map[string]interface{}
+	var err error
+
+	if o.config.Mode == OIDCModeJWKS {
+		claims, err = o.verifier.claims(token, now)
+	} else {
+		claims, err = o.introspect(token, now)
+	}
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	identity, err := o.identity(claims)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	expire := now.Add(time.Duration(o.config.CacheTTL) * time.Second)
+	if exp, ok := claims["exp"].(float64); ok && time.Unix(int64(exp), 0).Before(expire) {
+		expire = time.Unix(int64(exp), 0)
+	}
+
+	o.mutex.Lock()
+	for k, e := range o.cache {
+		if now.After(e.expire) {
+			delete(o.cache, k)
+		}
+	}
+	o.cache[key] = oidcCacheEntry{identity: identity, expire: expire}
+	o.mutex.Unlock()
+
+	return identity, nil
+}
+
+// map the claims onto the casbin subject and domain
+func (o *oidcAuthenticator) identity(claims map[string]interface{}) (Identity, error) {
+	user := claimString(claims, o.config.UserClaim)
+
+	domain := ""
+	if o.config.DomainClaim != "" {
+		domain = claimString(claims, o.config.DomainClaim)
+	}
+	if domain == "" {
+		domain = o.config.DefaultDomain
+	}
+	if mapped, ok := o.config.DomainMap[domain]; ok {
+		domain = mapped
+	}
+
+	if checkTenantName(user) != nil || checkTenantName(domain) != nil {
+		return Identity{}, errors.Wrapf(ErrTokenInvalid, "claims map to user %q, domain %q", user, domain)
+	}
+
+	return Identity{User: user, Domain: domain}, nil
+}
+
+// the string at a dotted path of the claims, the first one of a list
+func claimString(claims map[string]interface{}, path string) string {
+	var value interface{} = claims
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[name]
+	}
+
+	if list, ok := value.([]interface{}); ok && len(list) > 0 {
+		value = list[0]
+	}
+
+	s, _ := value.(string)
+
+	return s
+}
+
+func (o *oidcAuthenticator) getJSON(u string, v interface{}) error {
+	resp, err := o.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("GET %s: %s", u, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// the endpoints of the provider, the config wins over the discovery
+func (o *oidcAuthenticator) endpoints() (string, string, error) {
+	jwksURL := o.config.JWKSURL
+	introspectionURL := o.config.IntrospectionURL
+
+	if o.config.Mode == OIDCModeJWKS && jwksURL != "" || o.config.Mode == OIDCModeIntrospection && introspectionURL != "" {
+		return jwksURL, introspectionURL, nil
+	}
+
+	var discovery struct {
+		JWKSURI               string `json:"jwks_uri"`
+		IntrospectionEndpoint string `json:"introspection_endpoint"`
+	}
+
+	err := o.getJSON(strings.TrimRight(o.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery)
+	if err != nil {
+		return "", "", errors.Wrap(err, "oidc discovery")
+	}
+
+	if jwksURL == "" {
+		jwksURL = discovery.JWKSURI
+	}
+
+	if introspectionURL == "" {
+		introspectionURL = discovery.IntrospectionEndpoint
+	}
+
+	return jwksURL, introspectionURL, nil
+}
+
+// the RSA key kid of the provider, the keys are fetched again for an unknown kid at most once a minute,
+// the mutex is not held while the provider is called so a slow provider does not hold up the cache
+func (o *oidcAuthenticator) key(kid string) (*rsa.PublicKey, error) {
+	o.mutex.Lock()
+	key, ok := o.keys[kid]
+	fetch := !ok && time.Since(o.keysAt) >= time.Minute
+	if fetch {
+		o.keysAt = time.Now()
+	}
+	o.mutex.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if !fetch {
+		return nil, errors.New("unknown key")
+	}
+
+	keys, err := o.fetchKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	o.mutex.Lock()
+	o.keys = keys
+	o.mutex.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, errors.New("unknown key")
+}
+
+// the RSA signing keys of the jwks of the provider
+func (o *oidcAuthenticator) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	jwksURL, _, err := o.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+
+	err = o.getJSON(jwksURL, &jwks)
+	if err != nil {
+		return nil, errors.Wrap(err, "oidc jwks")
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			o.logger.Warnf("Key %s of the jwks is not valid base64url", k.Kid)
+			continue
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	o.logger.Infof("Loaded %d keys from %s", len(keys), jwksURL)
+
+	return keys, nil
+}
+
+// ask the provider whether the token is active, its answer carries the claims
+func (o *oidcAuthenticator) introspect(token string, now time.Time) (map[string]interface{}, error) {
+	_, introspectionURL, err := o.endpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+
+	req, err := http.NewRequest(http.MethodPost, introspectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(o.config.ClientID, o.config.ClientSecret)
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "oidc introspection")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("oidc introspection: %s", resp.Status)
+	}
+
+	claims := make(map[string]interface{})
+
+	err = json.NewDecoder(resp.Body).Decode(&claims)
+	if err != nil {
+		return nil, errors.Wrap(err, "oidc introspection")
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return nil, errors.Wrap(ErrTokenInvalid, "token is not active")
+	}
+
+	if exp, ok := claims["exp"].(float64); ok && now.Unix() > int64(exp)+int64(o.config.Leeway) {
+		return nil, ErrTokenExpired
+	}
+
+	if o.config.Audience != "" && !hasAudience(claims["aud"], o.config.Audience) {
+		return nil, errors.Wrapf(ErrTokenInvalid, "audience %v", claims["aud"])
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+//mockIdP a local provider with discovery, jwks and introspection, tokens "active-<user>" are active
+type mockIdP struct {
+	server         *httptest.Server
+	key            *rsa.PrivateKey
+	jwksCalls      int
+	introspections int
+
+	hold    chan struct{} //a value in it holds the next jwks call until release is closed
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	idp := &mockIdP{key: key, hold: make(chan struct{}, 1), entered: make(chan struct{}), release: make(chan struct{})}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"jwks_uri":               idp.server.URL + "/jwks",
+			"introspection_endpoint": idp.server.URL + "/introspect",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.jwksCalls++
+
+		select {
+		case <-idp.hold:
+			close(idp.entered)
+			<-idp.release
+		default:
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		idp.introspections++
+		id, secret, _ := r.BasicAuth()
+		if id != "tuna" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		token := r.PostFormValue("token")
+		if len(token) <= len("active-") || token[:len("active-")] != "active-" {
+			json.NewEncoder(w).Encode(map[string]bool{"active": false})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+			"sub":    token[len("active-"):],
+			"ext":    map[string]interface{}{"tenants": []string{"acme"}},
+			"exp":    time.Now().Unix() + 600,
+		})
+	})
+
+	idp.server = httptest.NewServer(mux)
+
+	return idp
+}
+
+func TestOIDCJWKS(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+
+	o, err := newOIDCAuthenticator(OIDCConfig{Mode: OIDCModeJWKS, Issuer: idp.server.URL, Audience: "tuna",
+		UserClaim: "preferred_username", DomainClaim: "tenant", DomainMap: map[string]string{"acme": "domain1"},
+		CacheTTL: 60, Timeout: 1000}, logp.NewLogger("oidc"))
+	assert.NoError(t, err)
+
+	claims := map[string]interface{}{"iss": idp.server.URL, "aud": "tuna", "preferred_username": "user1",
+		"tenant": "acme", "exp": time.Now().Unix() + 600}
+	token := signJWTHeader(t, map[string]string{"alg": JWTAlgRS256, "kid": "key1"}, idp.key, claims)
+
+	identity, err := o.Authenticate(token)
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{User: "user1", Domain: "domain1"}, identity)
+
+	_, err = o.Authenticate(token)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, idp.jwksCalls)
+
+	//an unknown kid does not hammer the provider
+	_, err = o.Authenticate(signJWTHeader(t, map[string]string{"alg": JWTAlgRS256, "kid": "key2"}, idp.key, claims))
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+	assert.Equal(t, 1, idp.jwksCalls)
+
+	claims["iss"] = "other"
+	_, err = o.Authenticate(signJWTHeader(t, map[string]string{"alg": JWTAlgRS256, "kid": "key1"}, idp.key, claims))
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+
+	claims["iss"] = idp.server.URL
+	claims["exp"] = time.Now().Unix() - 600
+	_, err = o.Authenticate(signJWTHeader(t, map[string]string{"alg": JWTAlgRS256, "kid": "key1"}, idp.key, claims))
+	assert.Equal(t, ErrTokenExpired, err)
+}
+
+func TestOIDCSlowJWKS(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+
+	o, err := newOIDCAuthenticator(OIDCConfig{Mode: OIDCModeJWKS, Issuer: idp.server.URL, DefaultDomain: "domain1",
+		CacheTTL: 60, Timeout: 5000}, logp.NewLogger("oidc"))
+	assert.NoError(t, err)
+
+	sign := func(kid string, user string) string {
+		return signJWTHeader(t, map[string]string{"alg": JWTAlgRS256, "kid": kid}, idp.key,
+			map[string]interface{}{"iss": idp.server.URL, "sub": user, "exp": time.Now().Unix() + 600})
+	}
+
+	_, err = o.Authenticate(sign("key1", "user1"))
+	assert.NoError(t, err)
+
+	//a new kid makes tuna fetch the keys again, the provider hangs on it
+	o.mutex.Lock()
+	o.keysAt = time.Time{}
+	o.mutex.Unlock()
+	idp.hold <- struct{}{}
+
+	done := make(chan error)
+	go func() {
+		_, err := o.Authenticate(sign("key2", "user2"))
+		done <- err
+	}()
+	<-idp.entered
+
+	//the tokens of the known keys are still checked meanwhile
+	checked := make(chan error)
+	go func() {
+		_, err := o.Authenticate(sign("key1", "user1"))
+		if err == nil {
+			_, err = o.Authenticate(sign("key1", "user3"))
+		}
+		checked <- err
+	}()
+
+	select {
+	case err = <-checked:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Error("tokens of known keys wait for the jwks of the provider")
+	}
+
+	close(idp.release)
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(<-done))
+}
+
+func TestOIDCIntrospection(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+
+	o, err := newOIDCAuthenticator(OIDCConfig{Mode: OIDCModeIntrospection, Issuer: idp.server.URL,
+		ClientID: "tuna", ClientSecret: "secret", UserClaim: "sub", DomainClaim: "ext.tenants",
+		CacheTTL: 60, Timeout: 1000}, logp.NewLogger("oidc"))
+	assert.NoError(t, err)
+
+	identity, err := o.Authenticate("active-user1")
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{User: "user1", Domain: "acme"}, identity)
+
+	_, err = o.Authenticate("active-user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, idp.introspections)
+
+	_, err = o.Authenticate("revoked")
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+	assert.Equal(t, 2, idp.introspections)
+
+	o.config.ClientSecret = "wrong"
+	_, err = o.Authenticate("active-user2")
+	assert.Error(t, err)
+}
+
+func TestOIDCClaimMapping(t *testing.T) {
+	o := &oidcAuthenticator{config: OIDCConfig{UserClaim: "sub", DomainClaim: "org.name", DefaultDomain: "public"}}
+
+	identity, err := o.identity(map[string]interface{}{"sub": "user1", "org": map[string]interface{}{"name": "domain1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{User: "user1", Domain: "domain1"}, identity)
+
+	identity, err = o.identity(map[string]interface{}{"sub": "user1"})
+	assert.NoError(t, err)
+	assert.Equal(t, Identity{User: "user1", Domain: "public"}, identity)
+
+	_, err = o.identity(map[string]interface{}{"sub": "*"})
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+
+	_, err = o.identity(map[string]interface{}{"org": map[string]interface{}{"name": "domain1"}})
+	assert.Equal(t, ErrTokenInvalid, errors.Cause(err))
+
+	_, err = newOIDCAuthenticator(OIDCConfig{Mode: "saml"}, logp.NewLogger("oidc"))
+	assert.Error(t, err)
+
+	_, err = newOIDCAuthenticator(OIDCConfig{Mode: OIDCModeJWKS}, logp.NewLogger("oidc"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+/*********************Path resolution, every file operation builds its storage path here****************************/
+
+// ReservedPrefix names starting with it are kept for tuna itself
+const ReservedPrefix = ".tuna"
+
+// MaxNameLength longest file name accepted, in bytes
+const MaxNameLength = 1024
+
+// ErrInvalidPath a name from a request that cannot be used as a path
+var ErrInvalidPath = errors.New("invalid path")
+
+//check a user or domain name, it becomes one segment of the path
+func checkSegment(segment string) error {
+	switch {
+	case segment == "":
+		return errors.Wrap(ErrInvalidPath, "empty segment")
+	case segment == "." || segment == "..":
+		return errors.Wrapf(ErrInvalidPath, "segment %q is not allowed", segment)
+	case strings.HasPrefix(segment, ReservedPrefix):
+		return errors.Wrapf(ErrInvalidPath, "segment %q is reserved", segment)
+	case strings.Contains(segment, "/"):
+		return errors.Wrapf(ErrInvalidPath, "segment %q contains a slash", segment)
+	}
+
+	for _, r := range segment {
+		if unicode.IsControl(r) {
+			return errors.Wrapf(ErrInvalidPath, "segment %q contains a control character", segment)
+		}
+	}
+
+	return nil
+}
+
+//check a tenant name, the user and domain of every request are checked before they are used in a path
+func checkTenantName(name string) error {
+	if !utf8.ValidString(name) {
+		return errors.Wrap(ErrInvalidPath, "name is not valid UTF-8")
+	}
+
+	//a * would match other tenants in the casbin policies
+	if strings.Contains(name, "*") {
+		return errors.Wrapf(ErrInvalidPath, "name %q contains a *", name)
+	}
+
+	return checkSegment(name)
+}
+
+//clean a file name from a request into a relative path like reports/2026/q3.csv,
+//the result is in Unicode NFC so the same name always maps to the same path
+func cleanName(name string) (string, error) {
+	if len(name) > MaxNameLength {
+		return "", errors.Wrapf(ErrInvalidPath, "name is longer than %d bytes", MaxNameLength)
+	}
+
+	if !utf8.ValidString(name) {
+		return "", errors.Wrap(ErrInvalidPath, "name is not valid UTF-8")
+	}
+
+	if strings.HasPrefix(name, "/") {
+		return "", errors.Wrapf(ErrInvalidPath, "absolute name %q is not allowed", name)
+	}
+
+	name = norm.NFC.String(name)
+
+	var segments []string
+	for _, segment := range strings.Split(name, "/") {
+		//"a//b" and "a/" are the same as "a/b" and "a"
+		if segment == "" {
+			continue
+		}
+
+		err := checkSegment(segment)
+		if err != nil {
+			return "", err
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+//the folder of a user, or of the whole domain when user is the domain
+func resolveTenantRoot(domain string, user string) (string, error) {
+	if err := checkTenantName(domain); err != nil {
+		return "", err
+	}
+
+	if user == domain {
+		return "/" + domain + "/", nil
+	}
+
+	if err := checkTenantName(user); err != nil {
+		return "", err
+	}
+
+	return "/" + domain + "/" + user + "/", nil
+}
+
+//the storage path of name in the folder of user, name may be a sub path like reports/2026/q3.csv,
+//an empty name is the folder itself
+func resolveObject(domain string, user string, name string) (string, error) {
+	if err := checkTenantName(domain); err != nil {
+		return "", err
+	}
+
+	if err := checkTenantName(user); err != nil {
+		return "", err
+	}
+
+	cleaned, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+
+	return "/" + domain + "/" + user + "/" + cleaned, nil
+}
+
+//fill the response of a name that could not be resolved
+func pathError(baseResp *BaseResponse, err error) {
+	baseResp.ErrCode = ErrCodeInvalidPath
+	baseResp.ErrInfo = ErrInfoInvalidPath
+	baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+}
+
+//create the missing directories above object
+func (m Manager) ensureParent(object string) error {
+	parent := path.Dir(strings.TrimRight(object, "/"))
+
+	return m.fs.CreateDirectory(parent, &DirectoryOption{
+		WriteType:   WriteTypeCacheThrough,
+		Recursive:   true,
+		AllowExists: true,
+	})
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveObject(t *testing.T) {
+	cases := []struct {
+		user string
+		name string
+		want string
+	}{
+		{"alice", "", "/hexmeet/alice/"},
+		{"alice", "a.txt", "/hexmeet/alice/a.txt"},
+		{"alice", "reports/2026/q3.csv", "/hexmeet/alice/reports/2026/q3.csv"},
+		{"alice", "reports//q3.csv", "/hexmeet/alice/reports/q3.csv"},
+		{"alice", "reports/", "/hexmeet/alice/reports"},
+		{"alice", "..a", "/hexmeet/alice/..a"},
+		{"alice", "café.txt", "/hexmeet/alice/café.txt"},
+	}
+
+	for _, c := range cases {
+		got, err := resolveObject("hexmeet", c.user, c.name)
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.want, got, c.name)
+	}
+}
+
+func TestResolveObjectRejects(t *testing.T) {
+	cases := []struct {
+		user string
+		name string
+	}{
+		{"alice", "../bob/a.txt"},
+		{"alice", "reports/../../bob/a.txt"},
+		{"alice", "./a.txt"},
+		{"alice", "/hexmeet/bob/a.txt"},
+		{"alice", "a\x00.txt"},
+		{"alice", "a\n.txt"},
+		{"alice", "\xff.txt"},
+		{"alice", ".tuna-trash/a.txt"},
+		{"alice", string(make([]byte, MaxNameLength+1))},
+		{"..", "a.txt"},
+		{"", "a.txt"},
+		{"alice/../bob", "a.txt"},
+	}
+
+	for _, c := range cases {
+		_, err := resolveObject("hexmeet", c.user, c.name)
+		assert.Equal(t, ErrInvalidPath, errors.Cause(err), "%q %q", c.user, c.name)
+	}
+}
+
+func TestResolveTenantRoot(t *testing.T) {
+	root, err := resolveTenantRoot("hexmeet", "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "/hexmeet/alice/", root)
+
+	root, err = resolveTenantRoot("hexmeet", "hexmeet")
+	assert.NoError(t, err)
+	assert.Equal(t, "/hexmeet/", root)
+
+	_, err = resolveTenantRoot("..", "alice")
+	assert.Equal(t, ErrInvalidPath, errors.Cause(err))
+}
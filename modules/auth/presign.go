@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"hexmeet.com/haishen/tuna/logp"
+	"hexmeet.com/haishen/tuna/utils"
+)
+
+/*********************Presigned urls, a download or upload link of one file that expires****************************/
+
+// PresignedPrefix path of the presigned urls, the file_name follows it
+const PresignedPrefix = "/presigned/"
+
+// Presigned url errors
+var (
+	ErrSignatureInvalid = errors.New("signature does not match")
+	ErrSignatureExpired = errors.New("url has expired")
+	ErrPresignMethod    = errors.New("method should be GET or PUT")
+)
+
+//the secret of the signatures, a random one when none is configured, the urls then die with a restart
+func loadPresignKey(secret string, logger *logp.Logger) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Warn("PresignSecret is not set, presigned urls will not survive a restart")
+
+	return key, nil
+}
+
+func presignSignature(key []byte, method string, domain string, user string, fileName string, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%d", method, domain, user, fileName, expires)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//the url of method on file_name of the tenant, valid until expires in unix seconds,
+//file_name is the cleaned name of the file in the folder of the tenant
+func presignURL(key []byte, method string, domain string, user string, fileName string, expires int64) string {
+	fileName = strings.Trim(fileName, "/")
+
+	segments := strings.Split(fileName, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	query := url.Values{}
+	query.Set("user", user)
+	query.Set("domain", domain)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", presignSignature(key, method, domain, user, fileName, expires))
+
+	return PresignedPrefix + strings.Join(segments, "/") + "?" + query.Encode()
+}
+
+//check the signature of a presigned url, the request it stands for is returned
+func verifyPresigned(key []byte, method string, u *url.URL, now time.Time) (AlluxioWebRequest, error) {
+	var inReq AlluxioWebRequest
+
+	query := u.Query()
+
+	//the signature covers the cleaned name, any spelling of the same file checks the same
+	fileName, err := cleanName(strings.TrimLeft(strings.TrimPrefix(u.Path, PresignedPrefix), "/"))
+	if err != nil {
+		return inReq, errors.Wrapf(ErrSignatureInvalid, "path: %s", err)
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return inReq, errors.Wrap(ErrSignatureInvalid, "expires is not set")
+	}
+
+	expected := presignSignature(key, method, query.Get("domain"), query.Get("user"), fileName, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return inReq, ErrSignatureInvalid
+	}
+
+	if now.Unix() > expires {
+		return inReq, ErrSignatureExpired
+	}
+
+	inReq.User = query.Get("user")
+	inReq.Domain = query.Get("domain")
+	inReq.FileName = fileName
+
+	return inReq, nil
+}
+
+//sign a url to GET or PUT file_name, the rights are checked now and again when the url is used
+func (m Manager) alluxioPresign (workerCtx *WorkerContext) (string, int64, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	object, pathErr := resolveObject(domain, user, webRequst.FileName)
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return "", 0, baseResp
+	}
+
+	method := strings.ToUpper(webRequst.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	expires := webRequst.Expires
+	if expires == 0 {
+		expires = int64(m.config.PresignExpires)
+	}
+
+	var err error
+
+	switch {
+	case method != http.MethodGet && method != http.MethodPut:
+		err = ErrPresignMethod
+	case strings.HasSuffix(object, "/"):
+		err = errors.Errorf("%s is not a file", object)
+	case expires < 0 || expires > int64(m.config.PresignMaxExpires):
+		err = errors.Errorf("expires should be 1 to %d seconds", m.config.PresignMaxExpires)
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeFailedToParseBody
+		baseResp.ErrInfo = ErrInfoFailedToParseBody
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		return "", 0, baseResp
+	}
+
+	right := "read"
+	if method == http.MethodPut {
+		right = "write"
+	}
+
+	logger.Infof("User:%s, domain:%s will presign %s %s for %d seconds", user, domain, method, object, expires)
+
+	if m.rbactCheckRights(user, domain, object, right) {
+		logger.Infof("User:%s, domain:%s was permitted to presign %s %s", user, domain, method, object)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to presign %s %s", user, domain, method, object)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return "", 0, baseResp
+	}
+
+	expiresAt := time.Now().Unix() + expires
+	fileName  := strings.TrimPrefix(object, "/" + domain + "/" + user + "/")
+
+	return presignURL(m.presignKey, method, domain, user, fileName, expiresAt), expiresAt, baseResp
+}
+
+//GET or PUT of a presigned url, a valid signature stands for the json body of read-file or upload
+func (m Manager) onPresigned(c *gin.Context) {
+	logger := m.logger.Named("presigned")
+
+	inReq, err := verifyPresigned(m.presignKey, c.Request.Method, c.Request.URL, time.Now())
+
+	if err != nil {
+		logger.Infof("Presigned %s %s from client %s is rejected: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+		c.JSON(http.StatusForbidden, BaseResponse{ErrCode: ErrCodeSignatureInvalid,
+			ErrInfo: ErrInfoSignatureInvalid,
+			MoreInfo: fmt.Sprintf("Err: %s", err)})
+		return
+	}
+
+	logger.Infof("User:%s, domain:%s presigned %s %s from client %s", inReq.User, inReq.Domain, c.Request.Method,
+		inReq.FileName, c.ClientIP())
+
+	inReq.GUID = utils.NewUUID()
+	inReq.ClientIP = c.ClientIP()
+
+	requestType := RequestAlluxioReadFile
+	if c.Request.Method == http.MethodPut {
+		requestType = RequestPresignedPut
+	}
+
+	m.dispatchRequest(c, requestType, inReq, time.After(time.Duration(m.config.ReqTimeout) * time.Minute))
+}
+
+//store the body of a presigned PUT as file_name, with the default storage class and ttl of the domain
+func (m Manager) alluxioPresignedPut (workerCtx *WorkerContext) ([]UploadFileResult, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	object, pathErr := resolveObject(domain, user, webRequst.FileName)
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return nil, baseResp
+	}
+
+	if m.rbactCheckRights(user, domain, object, "write") {
+		logger.Infof("User:%s, domain:%s was permitted to put %s", user, domain, object)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to put %s", user, domain, object)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return nil, baseResp
+	}
+
+	writeType, err := m.resolveWriteType(user, domain, "")
+	if err != nil {
+		storageClassError(&baseResp, err)
+		return nil, baseResp
+	}
+
+	ttl, ttlAction, err := m.resolveTTL(domain, 0, "")
+	if err != nil {
+		ttlError(&baseResp, err)
+		return nil, baseResp
+	}
+
+	err = m.ensureParent(object)
+	if err != nil {
+		baseResp.ErrCode = ErrCodeUploadFileFail
+		baseResp.ErrInfo = ErrInfoUploadFileFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Create parent of %s fail: %+v", object, err)
+		return nil, baseResp
+	}
+
+	dir, name := path.Split(object)
+
+	result := m.alluxioUploadStream(workerCtx, dir, name, workerCtx.workerRequest.GinContext.Request.Body, writeType)
+
+	if result.ErrCode == ErrCodeOk {
+		err = m.applyTTL(object, ttl, ttlAction)
+		if err != nil {
+			m.fs.Delete(object, &DeleteOption{})
+			ttlError(&result.BaseResponse, err)
+			logger.Errorf("Set ttl of %s fail: %+v", object, err)
+		}
+	}
+
+	m.usage.uploaded(domain, user, result.Size)
+
+	return []UploadFileResult{result}, result.BaseResponse
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresignedURL(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1700000000, 0)
+
+	raw := presignURL(key, "GET", "d1", "alice", "/docs/a b.txt", now.Unix()+60)
+
+	u, err := url.Parse(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, "/presigned/docs/a b.txt", u.Path)
+
+	inReq, err := verifyPresigned(key, "GET", u, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", inReq.User)
+	assert.Equal(t, "d1", inReq.Domain)
+	assert.Equal(t, "docs/a b.txt", inReq.FileName)
+
+	//the signature covers the method, the path, the tenant and the expiry
+	_, err = verifyPresigned(key, "PUT", u, now)
+	assert.Equal(t, ErrSignatureInvalid, err)
+
+	_, err = verifyPresigned([]byte("other"), "GET", u, now)
+	assert.Equal(t, ErrSignatureInvalid, err)
+
+	forged := *u
+	forged.Path = "/presigned/docs/b.txt"
+	_, err = verifyPresigned(key, "GET", &forged, now)
+	assert.Equal(t, ErrSignatureInvalid, err)
+
+	query := u.Query()
+	query.Set("user", "bob")
+	forged = *u
+	forged.RawQuery = query.Encode()
+	_, err = verifyPresigned(key, "GET", &forged, now)
+	assert.Equal(t, ErrSignatureInvalid, err)
+
+	_, err = verifyPresigned(key, "GET", u, now.Add(61*time.Second))
+	assert.Equal(t, ErrSignatureExpired, err)
+}
+
+func TestPresignCleanedName(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, alice, d1, /d1/alice/*, *")
+	defer cleanup()
+	m.presignKey = []byte("secret")
+
+	request := AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "alice", Domain: "d1"}, FileName: "docs//caf\u00e9.txt"}
+	ctx, _ := testWorkerContext(RequestAlluxioPresign, request, nil)
+	raw, _, baseResp := m.alluxioPresign(ctx)
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+
+	//the url names the file like the storage does
+	u, err := url.Parse(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, "/presigned/docs/caf\u00e9.txt", u.Path)
+
+	inReq, err := verifyPresigned(m.presignKey, "GET", u, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "docs/caf\u00e9.txt", inReq.FileName)
+
+	//another spelling of the same file checks the same
+	for _, spelling := range []string{"/presigned/docs//caf\u00e9.txt", "/presigned//docs/caf\u00e9.txt/", "/presigned/docs/cafe\u0301.txt"} {
+		other := *u
+		other.Path = spelling
+		inReq, err = verifyPresigned(m.presignKey, "GET", &other, time.Now())
+		assert.NoError(t, err, spelling)
+		assert.Equal(t, "docs/caf\u00e9.txt", inReq.FileName)
+	}
+
+	other := *u
+	other.Path = "/presigned/docs/../docs/caf\u00e9.txt"
+	_, err = verifyPresigned(m.presignKey, "GET", &other, time.Now())
+	assert.Equal(t, ErrSignatureInvalid, errors.Cause(err))
+}
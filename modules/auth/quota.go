@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+/*********************Storage quotas of users and domains****************************/
+
+// DefaultQuota quota of allocate-res when size is not set, 1G
+const DefaultQuota = int64(1) << 30
+
+// Quota errors
+var (
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	ErrInvalidSize   = errors.New("size should be a number of bytes or xxK, xxM, xxG, xxT")
+)
+
+var sizeUnits = map[byte]int64{
+	'K': 1 << 10,
+	'M': 1 << 20,
+	'G': 1 << 30,
+	'T': 1 << 40,
+}
+
+//parse the size field like 500M or 2G, an empty size is the default quota
+func parseSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	if size == "" {
+		return DefaultQuota, nil
+	}
+
+	unit := int64(1)
+	if u, ok := sizeUnits[size[len(size)-1]]; ok {
+		unit = u
+		size = size[:len(size)-1]
+	}
+
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/unit {
+		return 0, errors.Wrapf(ErrInvalidSize, "size %q", size)
+	}
+
+	return n * unit, nil
+}
+
+// QuotaUsage usage of a user or domain against its quota
+type QuotaUsage struct {
+	Limit     int64 `json:"limit"`     //bytes, 0 is no quota
+	Usage     int64 `json:"usage"`     //bytes
+	Available int64 `json:"available"` //bytes, -1 is no quota
+}
+
+//quotaStore keeps the quota of each tenant folder like /domain/user/ or /domain/ in a json file,
+//the writes in progress hold a reservation so concurrent writes cannot overshoot a quota together
+type quotaStore struct {
+	file     string
+	mutex    sync.Mutex
+	limits   map[string]int64
+	reserved map[string]int64 //bytes of the writes in progress by tenant folder
+}
+
+func newQuotaStore(file string) (*quotaStore, error) {
+	store := &quotaStore{
+		file:     file,
+		limits:   make(map[string]int64),
+		reserved: make(map[string]int64),
+	}
+
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &store.limits)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", file)
+	}
+
+	return store, nil
+}
+
+//the caller must hold the mutex
+func (s *quotaStore) save() error {
+	data, err := json.MarshalIndent(s.limits, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.file)
+}
+
+//set the quota of a tenant folder, 0 removes it
+func (s *quotaStore) set(root string, limit int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if limit == 0 {
+		delete(s.limits, root)
+	} else {
+		s.limits[root] = limit
+	}
+
+	return s.save()
+}
+
+//forget the quotas of a freed tenant folder and of the folders under it, a tenant allocated later
+//under the same name gets the quota of its own allocate-res
+func (s *quotaStore) remove(root string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for folder := range s.limits {
+		if strings.HasPrefix(folder, root) {
+			delete(s.limits, folder)
+		}
+	}
+
+	return s.save()
+}
+
+func (s *quotaStore) get(root string) (int64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	limit, ok := s.limits[root]
+
+	return limit, ok
+}
+
+//bytes used by a file, or by all the files under a folder
+func (m Manager) pathUsage(object string) (int64, error) {
+	status, err := m.fs.GetStatus(object)
+	if err != nil {
+		return 0, err
+	}
+
+	if !status.Folder {
+		return status.Length, nil
+	}
+
+	statuses, err := m.listStatus(object, true)
+	if err != nil {
+		return 0, err
+	}
+
+	usage := int64(0)
+	for _, status := range statuses {
+		if !status.Folder {
+			usage += status.Length
+		}
+	}
+
+	return usage, nil
+}
+
+//the tenant folders an object is counted in, the domain and the user
+func quotaRoots(object string) []string {
+	segments := strings.SplitN(strings.TrimPrefix(object, "/"), "/", 3)
+
+	roots := []string{"/" + segments[0] + "/"}
+	if len(segments) > 2 {
+		roots = append(roots, "/"+segments[0]+"/"+segments[1]+"/")
+	}
+
+	return roots
+}
+
+//the innermost tenant folder of object
+func tenantOf(object string) string {
+	roots := quotaRoots(object)
+
+	return roots[len(roots)-1]
+}
+
+//the bytes of root counted against its quota, the caller must hold the mutex
+func (s *quotaStore) used(usage *usageTracker, root string) int64 {
+	return usage.used(root) + s.reserved[root]
+}
+
+//the bytes counted against the quota of root and its limit, read together so they belong to the same moment,
+//false when root has no quota
+func (s *quotaStore) state(usage *usageTracker, root string) (int64, int64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	limit, ok := s.limits[root]
+
+	return s.used(usage, root), limit, ok
+}
+
+//fail with ErrQuotaExceeded when size more bytes do not fit in the quotas of object, the caller must hold the mutex
+func (s *quotaStore) exceeded(usage *usageTracker, object string, size int64) error {
+	for _, root := range quotaRoots(object) {
+		limit, ok := s.limits[root]
+		if !ok {
+			continue
+		}
+
+		used := s.used(usage, root)
+		if used+size > limit {
+			return errors.Wrapf(ErrQuotaExceeded, "%d of %d bytes of %s are used, %d bytes needed", used, limit, root, size)
+		}
+	}
+
+	return nil
+}
+
+//hold size bytes of a write to object in the quotas of its tenant folders
+func (s *quotaStore) reserve(usage *usageTracker, object string, size int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := s.exceeded(usage, object, size)
+	if err != nil {
+		return err
+	}
+
+	for _, root := range quotaRoots(object) {
+		s.reserved[root] += size
+	}
+
+	return nil
+}
+
+//hold size bytes of object in the quotas without a check, for a write admitted before tuna restarted
+func (s *quotaStore) hold(object string, size int64) {
+	if size <= 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, root := range quotaRoots(object) {
+		s.reserved[root] += size
+	}
+}
+
+//end the reservation of a write, the written bytes count as stored until a scan finds them
+func (s *quotaStore) release(usage *usageTracker, object string, size int64, written int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usage.stored(object, written)
+
+	for _, root := range quotaRoots(object) {
+		s.reserved[root] -= size
+		if s.reserved[root] <= 0 {
+			delete(s.reserved, root)
+		}
+	}
+}
+
+//fail with ErrQuotaExceeded when size more bytes do not fit in the quotas of object
+func (m Manager) checkQuota(object string, size int64) error {
+	m.quotas.mutex.Lock()
+	defer m.quotas.mutex.Unlock()
+
+	return m.quotas.exceeded(m.usage, object, size)
+}
+
+func (m Manager) reserveQuota(object string, size int64) error {
+	return m.quotas.reserve(m.usage, object, size)
+}
+
+func (m Manager) releaseQuota(object string, size int64, written int64) {
+	m.quotas.release(m.usage, object, size, written)
+}
+
+//fill the response of a write stopped by a quota
+func quotaError(baseResp *BaseResponse, err error) {
+	baseResp.ErrCode = ErrCodeQuotaExceeded
+	baseResp.ErrInfo = ErrInfoQuotaExceeded
+	baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+}
+
+//usage of the user, or of the whole domain when user is the domain
+func (m Manager) alluxioQuota (workerCtx *WorkerContext) (*QuotaUsage, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	root, err := resolveTenantRoot(domain, user)
+
+	if err != nil {
+		pathError(&baseResp, err)
+		return nil, baseResp
+	}
+
+	//the same figures the writes are checked against
+	usage, limit, ok := m.quotas.state(m.usage, root)
+
+	logger.Infof("User:%s, domain:%s uses %d bytes of %s", user, domain, usage, root)
+
+	quota := &QuotaUsage{Usage: usage, Available: -1}
+
+	if ok {
+		quota.Limit = limit
+		quota.Available = limit - usage
+		if quota.Available < 0 {
+			quota.Available = 0
+		}
+	}
+
+	return quota, baseResp
+}
+
+//change the quota of a user or domain, size 0 removes it
+func (m Manager) alluxioSetQuota (workerCtx *WorkerContext) BaseResponse {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	root, err := resolveTenantRoot(domain, user)
+
+	if err != nil {
+		pathError(&baseResp, err)
+		return baseResp
+	}
+
+	if webRequst.Size == "" {
+		baseResp.ErrCode = ErrCodeFailedToParseBody
+		baseResp.ErrInfo = ErrInfoFailedToParseBody
+		baseResp.MoreInfo = "size is not set"
+		return baseResp
+	}
+
+	limit, err := parseSize(webRequst.Size)
+
+	if err == nil {
+		err = m.quotas.set(root, limit)
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeQuotaFail
+		baseResp.ErrInfo = ErrInfoQuotaFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Set quota of %s fail: %+v", root, err)
+		return baseResp
+	}
+
+	logger.Infof("Quota of User:%s, domain:%s was set to %d bytes", user, domain, limit)
+
+	return baseResp
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		size string
+		want int64
+	}{
+		{"", DefaultQuota},
+		{"1G", 1 << 30},
+		{"500M", 500 << 20},
+		{"2t", 2 << 40},
+		{"64K", 64 << 10},
+		{"1024", 1024},
+		{"0", 0},
+	}
+
+	for _, c := range cases {
+		got, err := parseSize(c.size)
+		assert.NoError(t, err, c.size)
+		assert.Equal(t, c.want, got, c.size)
+	}
+
+	for _, size := range []string{"G", "1.5G", "-1G", "1P", "99999999999T"} {
+		_, err := parseSize(size)
+		assert.Equal(t, ErrInvalidSize, errors.Cause(err), size)
+	}
+}
+
+func TestQuotaRoots(t *testing.T) {
+	assert.Equal(t, []string{"/hexmeet/", "/hexmeet/alice/"}, quotaRoots("/hexmeet/alice/a/b.txt"))
+	assert.Equal(t, []string{"/hexmeet/", "/hexmeet/alice/"}, quotaRoots("/hexmeet/alice/"))
+	assert.Equal(t, []string{"/hexmeet/"}, quotaRoots("/hexmeet/a.txt"))
+}
+
+//gatedReader gives its first chunk, then waits at the gate before giving the rest
+type gatedReader struct {
+	chunks  []string
+	arrived chan bool
+	gate    chan bool
+}
+
+func (g *gatedReader) Read(p []byte) (int, error) {
+	if len(g.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	if len(g.chunks) == 1 {
+		g.arrived <- true
+		<-g.gate
+	}
+
+	n := copy(p, g.chunks[0])
+	g.chunks = g.chunks[1:]
+
+	return n, nil
+}
+
+func TestQuotaConcurrentUploads(t *testing.T) {
+	m, cleanup := newTestManager(t)
+	defer cleanup()
+
+	assert.NoError(t, m.fs.CreateDirectory("/domain1/user1/", &DirectoryOption{Recursive: true}))
+	assert.NoError(t, m.quotas.set("/domain1/user1/", 14))
+
+	ctx := &WorkerContext{logger: logp.NewLogger("test")}
+	arrived := make(chan bool)
+	gate := make(chan bool)
+
+	//each upload fits alone, both together do not
+	var wg sync.WaitGroup
+	results := make([]UploadFileResult, 2)
+	for i, name := range []string{"a.txt", "b.txt"} {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			body := &gatedReader{chunks: []string{"1234", "5678"}, arrived: arrived, gate: gate}
+			results[i] = m.alluxioUploadStream(ctx, "/domain1/user1/", name, body, "")
+		}(i, name)
+	}
+
+	//both hold the reservation of their first chunk before either sends the second
+	<-arrived
+	<-arrived
+	close(gate)
+	wg.Wait()
+
+	codes := []int{results[0].ErrCode, results[1].ErrCode}
+	assert.ElementsMatch(t, []int{ErrCodeOk, ErrCodeQuotaExceeded}, codes)
+
+	failed := results[0]
+	if failed.ErrCode == ErrCodeOk {
+		failed = results[1]
+	}
+	_, err := m.fs.GetStatus("/domain1/user1/" + failed.FileName)
+	assert.Equal(t, ErrStorageNotFound, err)
+
+	//the written file counts before any scan, the reservations are gone
+	assert.Empty(t, m.quotas.reserved)
+	assert.Equal(t, int64(8), m.usage.used("/domain1/user1/"))
+	assert.Equal(t, int64(8), m.usage.used("/domain1/"))
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(m.checkQuota("/domain1/user1/c.txt", 7)))
+	assert.NoError(t, m.checkQuota("/domain1/user1/c.txt", 6))
+}
+
+func TestQuotaReport(t *testing.T) {
+	m, cleanup := newTestManager(t)
+	defer cleanup()
+
+	assert.NoError(t, m.quotas.set("/domain1/user1/", 10))
+	m.usage.stored("/domain1/user1/a.txt", 3)
+	assert.NoError(t, m.reserveQuota("/domain1/user1/b.txt", 4))
+
+	//the stored bytes and the writes in progress are reported against the limit of the same moment
+	used, limit, ok := m.quotas.state(m.usage, "/domain1/user1/")
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), used)
+	assert.Equal(t, int64(10), limit)
+
+	ctx, _ := testWorkerContext(RequestAlluxioQuota, AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "user1", Domain: "domain1"}}, nil)
+	quota, baseResp := m.alluxioQuota(ctx)
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+	assert.Equal(t, &QuotaUsage{Limit: 10, Usage: 7, Available: 3}, quota)
+
+	ctx, _ = testWorkerContext(RequestAlluxioQuota, AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "user2", Domain: "domain1"}}, nil)
+	quota, _ = m.alluxioQuota(ctx)
+	assert.Equal(t, int64(-1), quota.Available)
+}
+
+func TestQuotaOfFreedTenant(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, user1, domain1, /domain1/user1/*, *")
+	defer cleanup()
+
+	writeTestFile(t, m.fs, "/domain1/user1/a.txt", "hello")
+	assert.NoError(t, m.quotas.set("/domain1/", 100))
+	assert.NoError(t, m.quotas.set("/domain1/user1/", 10))
+
+	ctx, _ := testWorkerContext(RequestAlluxioDeleteUser, AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: "user1", Domain: "domain1"}}, nil)
+	_, err := m.alluxioDeleteUser(ctx)
+	assert.NoError(t, err)
+
+	//the quota entry of the freed tenant is gone, the one of its domain is kept
+	_, ok := m.quotas.get("/domain1/user1/")
+	assert.False(t, ok)
+	limit, ok := m.quotas.get("/domain1/")
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), limit)
+
+	store, err := newQuotaStore(m.quotas.file)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"/domain1/": 100}, store.limits)
+}
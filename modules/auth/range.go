@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*********************HTTP Range support of read-file****************************/
+
+// ErrRangeNotSatisfiable the range starts after the end of the file
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// ByteRange the part of a file to send
+type ByteRange struct {
+	Start   int64
+	Length  int64
+	Partial bool //false means the whole file, no Content-Range
+}
+
+// ContentRange value of the Content-Range header
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+//parse a Range header against a file of size bytes, only a single range is served,
+//a header we do not understand is ignored and the whole file is sent as RFC 7233 allows
+func parseByteRange(header string, size int64) (ByteRange, error) {
+	full := ByteRange{Start: 0, Length: size}
+
+	if !strings.HasPrefix(header, "bytes=") {
+		return full, nil
+	}
+
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	if strings.Contains(spec, ",") {
+		return full, nil
+	}
+
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return full, nil
+	}
+
+	first := strings.TrimSpace(spec[:dash])
+	last := strings.TrimSpace(spec[dash+1:])
+
+	//"-n" is the last n bytes
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return full, nil
+		}
+		if n == 0 || size == 0 {
+			return full, ErrRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return ByteRange{Start: size - n, Length: n, Partial: true}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return full, nil
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return full, nil
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return full, ErrRangeNotSatisfiable
+	}
+
+	return ByteRange{Start: start, Length: end - start + 1, Partial: true}, nil
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteRange(t *testing.T) {
+	cases := []struct {
+		header string
+		size   int64
+		want   ByteRange
+		err    error
+	}{
+		{"", 100, ByteRange{Start: 0, Length: 100}, nil},
+		{"bytes=0-9", 100, ByteRange{Start: 0, Length: 10, Partial: true}, nil},
+		{"bytes=90-", 100, ByteRange{Start: 90, Length: 10, Partial: true}, nil},
+		{"bytes=90-200", 100, ByteRange{Start: 90, Length: 10, Partial: true}, nil},
+		{"bytes=-10", 100, ByteRange{Start: 90, Length: 10, Partial: true}, nil},
+		{"bytes=-200", 100, ByteRange{Start: 0, Length: 100, Partial: true}, nil},
+		{"bytes=0-1,5-6", 100, ByteRange{Start: 0, Length: 100}, nil},
+		{"bytes=9-1", 100, ByteRange{Start: 0, Length: 100}, nil},
+		{"items=0-1", 100, ByteRange{Start: 0, Length: 100}, nil},
+		{"bytes=100-", 100, ByteRange{Start: 0, Length: 100}, ErrRangeNotSatisfiable},
+		{"bytes=-0", 100, ByteRange{Start: 0, Length: 100}, ErrRangeNotSatisfiable},
+	}
+
+	for _, c := range cases {
+		got, err := parseByteRange(c.header, c.size)
+		assert.Equal(t, c.err, err, c.header)
+		assert.Equal(t, c.want, got, c.header)
+	}
+
+	assert.Equal(t, "bytes 90-99/100", ByteRange{Start: 90, Length: 10}.ContentRange(100))
+}
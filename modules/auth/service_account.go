@@ -0,0 +1,470 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+/*********************Service accounts, api keys of scripts and services that sign their requests with hmac****************************/
+
+// Headers of a signed request
+const (
+	HeaderKey           = "X-Tuna-Key"
+	HeaderTimestamp     = "X-Tuna-Timestamp"      //unix seconds
+	HeaderNonce         = "X-Tuna-Nonce"          //used once within the signature window
+	HeaderContentSHA256 = "X-Tuna-Content-Sha256" //hex sha256 of the body, or UNSIGNED-PAYLOAD
+	HeaderSignature     = "X-Tuna-Signature"      //hex hmac-sha256 of the canonical request
+)
+
+// UnsignedPayload content hash of a body left out of the signature, for large uploads
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// SignedBodyLimit largest body hashed by tuna, bigger bodies must be sent as UNSIGNED-PAYLOAD
+const SignedBodyLimit = 32 << 20
+
+// Request signature errors
+var (
+	ErrAccountUnknown    = errors.New("api key is unknown")
+	ErrSignatureMissing  = errors.New("signature headers are not set")
+	ErrSignatureReplayed = errors.New("nonce was used already")
+	ErrSignatureTime     = errors.New("timestamp is outside of the signature window")
+	ErrAccountForbidden  = errors.New("service account may not call the internal api")
+	ErrInternalAccount   = errors.New("internal service accounts are created on the internal api")
+)
+
+// ServiceAccount an api key and secret, it acts as its user and domain on the /auth api
+type ServiceAccount struct {
+	Key      string `json:"key"`
+	Secret   string `json:"secret,omitempty"` //only returned when the account is created
+	User     string `json:"user"`
+	Domain   string `json:"domain"`
+	Internal bool   `json:"internal"` //may call allocate-res, free-res, set-quota and usage-report
+	Created  int64  `json:"created"`  //unix seconds
+}
+
+//the string a client signs, the body is represented by its hash
+func canonicalRequest(method string, path string, query string, timestamp string, nonce string, contentHash string) string {
+	return method + "\n" + path + "\n" + query + "\n" + timestamp + "\n" + nonce + "\n" + contentHash
+}
+
+func signCanonical(secret string, canonical string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+//accountStore keeps the service accounts in a json file readable by tuna only,
+//and the nonces seen within the signature window
+type accountStore struct {
+	file      string
+	window    time.Duration
+	mutex     sync.Mutex
+	accounts  map[string]ServiceAccount
+	nonces    map[string]int64 //key and nonce -> unix seconds it may be forgotten
+	lastPurge int64
+}
+
+func newAccountStore(file string, window time.Duration) (*accountStore, error) {
+	store := &accountStore{
+		file:     file,
+		window:   window,
+		accounts: make(map[string]ServiceAccount),
+		nonces:   make(map[string]int64),
+	}
+
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &store.accounts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", file)
+	}
+
+	return store, nil
+}
+
+//the caller must hold the mutex
+func (s *accountStore) save() error {
+	data, err := json.MarshalIndent(s.accounts, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.file)
+}
+
+//a new account with a random key and secret
+func (s *accountStore) create(user string, domain string, internal bool) (ServiceAccount, error) {
+	key, err := randomHex(8)
+	if err != nil {
+		return ServiceAccount{}, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return ServiceAccount{}, err
+	}
+
+	account := ServiceAccount{
+		Key:      "tk_" + key,
+		Secret:   secret,
+		User:     user,
+		Domain:   domain,
+		Internal: internal,
+		Created:  time.Now().Unix(),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.accounts[account.Key] = account
+
+	return account, s.save()
+}
+
+func (s *accountStore) remove(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.accounts[key]; !ok {
+		return errors.Wrapf(ErrAccountUnknown, "key %s", key)
+	}
+	delete(s.accounts, key)
+
+	return s.save()
+}
+
+//the accounts sorted by key, without their secrets
+func (s *accountStore) list() []ServiceAccount {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	accounts := []ServiceAccount{}
+	for _, account := range s.accounts {
+		account.Secret = ""
+		accounts = append(accounts, account)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Key < accounts[j].Key })
+
+	return accounts
+}
+
+//check the signature headers of r, contentHash is the hash of the body read by the caller
+func (s *accountStore) verify(r *http.Request, contentHash string, now time.Time) (ServiceAccount, error) {
+	key := r.Header.Get(HeaderKey)
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	signature := r.Header.Get(HeaderSignature)
+
+	if key == "" || timestamp == "" || nonce == "" || signature == "" {
+		return ServiceAccount{}, ErrSignatureMissing
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || ts < now.Add(-s.window).Unix() || ts > now.Add(s.window).Unix() {
+		return ServiceAccount{}, ErrSignatureTime
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	account, ok := s.accounts[key]
+	if !ok {
+		return ServiceAccount{}, errors.Wrapf(ErrAccountUnknown, "key %s", key)
+	}
+
+	expected := signCanonical(account.Secret, canonicalRequest(r.Method, r.URL.Path, r.URL.RawQuery, timestamp, nonce, contentHash))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ServiceAccount{}, ErrSignatureInvalid
+	}
+
+	//forget the nonces that are out of the window, a timestamp that old is refused anyway
+	if now.Unix()-s.lastPurge > int64(s.window/time.Second) {
+		for n, expire := range s.nonces {
+			if expire < now.Unix() {
+				delete(s.nonces, n)
+			}
+		}
+		s.lastPurge = now.Unix()
+	}
+
+	if _, ok := s.nonces[key+"\x00"+nonce]; ok {
+		return ServiceAccount{}, ErrSignatureReplayed
+	}
+	s.nonces[key+"\x00"+nonce] = ts + int64(2*s.window/time.Second)
+
+	return account, nil
+}
+
+//hash the body for the signature, the body is put back for the handlers
+func signedContentHash(c *gin.Context) (string, error) {
+	claimed := c.GetHeader(HeaderContentSHA256)
+	if claimed == "" {
+		return "", ErrSignatureMissing
+	}
+
+	if claimed == UnsignedPayload {
+		return claimed, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, SignedBodyLimit+1))
+	if err != nil {
+		return "", err
+	}
+
+	if len(body) > SignedBodyLimit {
+		return "", errors.Wrapf(ErrSignatureInvalid, "a body over %d bytes should be sent as %s", SignedBodyLimit, UnsignedPayload)
+	}
+
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.Sum256(body)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+//the service account of a signed request
+func (m Manager) signedAccount(c *gin.Context) (ServiceAccount, error) {
+	contentHash, err := signedContentHash(c)
+	if err != nil {
+		return ServiceAccount{}, err
+	}
+
+	return m.accounts.verify(c.Request, contentHash, time.Now())
+}
+
+func signatureError(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, BaseResponse{ErrCode: ErrCodeSignatureInvalid,
+		ErrInfo: ErrInfoSignatureInvalid,
+		MoreInfo: fmt.Sprintf("Err: %s", err)})
+}
+
+//authenticate the /auth and /admin apis, a signed request acts as its service account,
+//any other one needs a bearer token when jwt or oidc is enabled
+func (m Manager) authenticate() gin.HandlerFunc {
+	logger := m.logger.Named("authenticate")
+
+	var bearerAuth gin.HandlerFunc
+	if m.bearer != nil {
+		bearerAuth = m.bearerAuth()
+	}
+
+	return func(c *gin.Context) {
+		if c.GetHeader(HeaderKey) == "" {
+			if bearerAuth != nil {
+				bearerAuth(c)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		account, err := m.signedAccount(c)
+
+		if err == nil {
+			err = bindIdentity(Identity{User: account.User, Domain: account.Domain},
+				&RbactBaseRequest{User: c.Query("user"), Domain: c.Query("domain")})
+		}
+
+		if err != nil {
+			logger.Infof("Signed %s %s from client %s is rejected: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+			signatureError(c, err)
+			return
+		}
+
+		c.Set(ContextIdentity, Identity{User: account.User, Domain: account.Domain})
+		c.Next()
+	}
+}
+
+//the /admin api acts on the rights of its caller, a caller without a token or signature is refused
+//even when jwt and oidc are off, so that no body can name an admin
+func (m Manager) requireIdentity() gin.HandlerFunc {
+	logger := m.logger.Named("authenticate")
+
+	return func(c *gin.Context) {
+		if _, ok := identityOf(c); !ok {
+			logger.Infof("%s %s from client %s is unauthorized: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), ErrTokenMissing)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, BaseResponse{ErrCode: ErrCodeUnauthorized,
+				ErrInfo: ErrInfoUnauthorized,
+				MoreInfo: fmt.Sprintf("Err: %s", ErrTokenMissing)})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+//the log level is changed by the admins of the config only, the caller is the one of the token or signature,
+//requireIdentity runs before it
+func (m Manager) requireAdmin() gin.HandlerFunc {
+	logger := m.logger.Named("authenticate")
+
+	return func(c *gin.Context) {
+		identity, _ := identityOf(c)
+
+		if !m.isAdmin(identity.User) {
+			logger.Infof("%s %s of User:%s, domain:%s from client %s is denied", c.Request.Method, c.Request.URL.Path,
+				identity.User, identity.Domain, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusForbidden, BaseResponse{ErrCode: ErrCodeUserDeny,
+				ErrInfo: ErrInfoUserDeny})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+//the internal api is called by services, a signed request must come from an internal account,
+//an unsigned one is refused when RequireSignedInternal is set, or needs a token when internal tokens are set
+func (m Manager) internalAuth() gin.HandlerFunc {
+	logger := m.logger.Named("authenticate")
+
+	return func(c *gin.Context) {
+		//an unsigned request needs one of the tokens of the config, if there are any
+		if c.GetHeader(HeaderKey) == "" && !m.config.RequireSignedInternal {
+			if len(m.config.Internal.Tokens) > 0 && !m.internalToken(c) {
+				logger.Infof("Internal %s %s from client %s is rejected: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), ErrTokenInvalid)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, BaseResponse{ErrCode: ErrCodeUnauthorized,
+					ErrInfo: ErrInfoUnauthorized,
+					MoreInfo: fmt.Sprintf("Err: %s", ErrTokenInvalid)})
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		account, err := m.signedAccount(c)
+
+		if err == nil && !account.Internal {
+			err = errors.Wrapf(ErrAccountForbidden, "key %s", account.Key)
+		}
+
+		if err != nil {
+			logger.Infof("Internal %s %s from client %s is rejected: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+			signatureError(c, err)
+			return
+		}
+
+		logger.Infof("Internal %s %s was signed by %s", c.Request.Method, c.Request.URL.Path, account.Key)
+		c.Next()
+	}
+}
+
+//create, remove or list the service accounts, only an administrator proven by a token or signature may call it,
+//the internal accounts are created on the internal api only
+func (m Manager) alluxioServiceAccount (workerCtx *WorkerContext) ([]ServiceAccount, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	account   := webRequst.Account
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	internal  := workerCtx.workerRequest.Type == RequestInternalAccountCreate
+
+	if internal {
+		logger.Infof("User:%s, domain:%s was permitted to create service accounts on the internal api", user, domain)
+	} else if verifiedCaller(workerCtx, user, domain) && m.isAdmin(user) {
+		logger.Infof("User:%s, domain:%s was permitted to administer service accounts", user, domain)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to administer service accounts", user, domain)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return nil, baseResp
+	}
+
+	var err error
+
+	switch workerCtx.workerRequest.Type {
+	case RequestServiceAccountList:
+		return m.accounts.list(), baseResp
+
+	case RequestServiceAccountCreate, RequestInternalAccountCreate:
+		if account.Internal && !internal {
+			logger.Infof("User:%s, domain:%s was denied to create an internal service account", user, domain)
+			baseResp.ErrCode = ErrCodeUserDeny
+			baseResp.MoreInfo = fmt.Sprintf("Err: %s", ErrInternalAccount)
+			return nil, baseResp
+		}
+
+		_, err = resolveTenantRoot(account.Domain, account.User)
+		if err != nil {
+			pathError(&baseResp, err)
+			return nil, baseResp
+		}
+
+		account, err = m.accounts.create(account.User, account.Domain, account.Internal)
+		if err == nil {
+			logger.Infof("User:%s, domain:%s created service account %s of User:%s, domain:%s, internal %v",
+				user, domain, account.Key, account.User, account.Domain, account.Internal)
+			return []ServiceAccount{account}, baseResp
+		}
+
+	default:
+		err = m.accounts.remove(account.Key)
+		if err == nil {
+			logger.Infof("User:%s, domain:%s removed service account %s", user, domain, account.Key)
+			return nil, baseResp
+		}
+	}
+
+	baseResp.ErrCode = ErrCodeServiceAccountFail
+	baseResp.ErrInfo = ErrInfoServiceAccountFail
+	baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+	logger.Errorf("%s of %s fail: %+v", workerCtx.workerRequest.Type, account.Key, err)
+
+	return nil, baseResp
+}
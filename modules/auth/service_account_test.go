@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func signedRequest(account ServiceAccount, method string, target string, body string, nonce string, ts time.Time) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+
+	sum := sha256.Sum256([]byte(body))
+	contentHash := hex.EncodeToString(sum[:])
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+
+	req.Header.Set(HeaderKey, account.Key)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderContentSHA256, contentHash)
+	req.Header.Set(HeaderSignature, signCanonical(account.Secret,
+		canonicalRequest(method, req.URL.Path, req.URL.RawQuery, timestamp, nonce, contentHash)))
+
+	return req
+}
+
+func TestServiceAccountSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-accounts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "service-accounts.json")
+	store, err := newAccountStore(file, 5*time.Minute)
+	assert.NoError(t, err)
+
+	account, err := store.create("user1", "domain1", false)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, account.Secret)
+
+	//the accounts survive a restart, the listing hides the secrets
+	store, err = newAccountStore(file, 5*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "", store.list()[0].Secret)
+
+	internal, err := store.create("svc", "domain1", true)
+	assert.NoError(t, err)
+
+	m := Manager{accounts: store, logger: logp.NewLogger("accounts"), config: DefaultConfig()}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/whoami", m.authenticate(), func(c *gin.Context) {
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		identity, _ := identityOf(c)
+		c.String(http.StatusOK, identity.User+"@"+identity.Domain+" "+string(body))
+	})
+	router.POST("/allocate-res", m.internalAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	now := time.Now()
+
+	w := serve(signedRequest(account, "POST", "/auth/whoami", `{"guid":"1"}`, "n1", now))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `user1@domain1 {"guid":"1"}`, w.Body.String())
+
+	//a replayed nonce, an old timestamp, a changed body and an unknown key are refused
+	assert.Equal(t, http.StatusUnauthorized, serve(signedRequest(account, "POST", "/auth/whoami", `{"guid":"1"}`, "n1", now)).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(signedRequest(account, "POST", "/auth/whoami", "", "n2", now.Add(-6*time.Minute))).Code)
+
+	req := signedRequest(account, "POST", "/auth/whoami", `{"guid":"1"}`, "n3", now)
+	req.Body = ioutil.NopCloser(strings.NewReader(`{"guid":"2"}`))
+	assert.Equal(t, http.StatusUnauthorized, serve(req).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(signedRequest(ServiceAccount{Key: "tk_none", Secret: "x"}, "POST", "/auth/whoami", "", "n4", now)).Code)
+
+	//the query may not name another user
+	assert.Equal(t, http.StatusUnauthorized, serve(signedRequest(account, "POST", "/auth/whoami?user=root", "", "n5", now)).Code)
+
+	//an unsigned body is allowed when the client says so
+	req = signedRequest(account, "POST", "/auth/whoami", "", "n6", now)
+	req.Header.Set(HeaderContentSHA256, UnsignedPayload)
+	req.Header.Set(HeaderSignature, signCanonical(account.Secret,
+		canonicalRequest("POST", "/auth/whoami", "", req.Header.Get(HeaderTimestamp), "n6", UnsignedPayload)))
+	req.Body = ioutil.NopCloser(strings.NewReader("big upload"))
+	w = serve(req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user1@domain1 big upload", w.Body.String())
+
+	//the internal api needs an internal account
+	assert.Equal(t, http.StatusUnauthorized, serve(signedRequest(account, "POST", "/allocate-res", "{}", "n7", now)).Code)
+	assert.Equal(t, http.StatusOK, serve(signedRequest(internal, "POST", "/allocate-res", "{}", "n8", now)).Code)
+	assert.Equal(t, http.StatusOK, serve(httptest.NewRequest("POST", "/allocate-res", strings.NewReader("{}"))).Code)
+
+	m.config.RequireSignedInternal = true
+	router.POST("/free-res", m.internalAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	assert.Equal(t, http.StatusUnauthorized, serve(httptest.NewRequest("POST", "/free-res", strings.NewReader("{}"))).Code)
+	assert.Equal(t, http.StatusOK, serve(signedRequest(internal, "POST", "/free-res", "{}", "n9", now)).Code)
+
+	assert.NoError(t, store.remove(account.Key))
+	assert.Equal(t, ErrAccountUnknown, errors.Cause(store.remove(account.Key)))
+}
+
+func TestServiceAccountAdmin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-accounts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := newAccountStore(filepath.Join(dir, "service-accounts.json"), 5*time.Minute)
+	assert.NoError(t, err)
+
+	m := Manager{accounts: store, logger: logp.NewLogger("accounts"), config: DefaultConfig()}
+	m.config.Admins = []string{"root"}
+
+	request := AlluxioWebRequest{Account: ServiceAccount{User: "user1", Domain: "domain1"}}
+	request.User = "root"
+	request.Domain = "domain1"
+
+	//an unsigned request naming an admin is refused
+	ctx, _ := testWorkerContext(RequestServiceAccountCreate, request, nil)
+	_, baseResp := m.alluxioServiceAccount(ctx)
+	assert.Equal(t, ErrCodeUserDeny, baseResp.ErrCode)
+	assert.Empty(t, store.list())
+
+	ctx, _ = testWorkerContext(RequestServiceAccountCreate, request, nil)
+	ctx.workerRequest.GinContext.Set(ContextIdentity, Identity{User: "root", Domain: "domain1"})
+	accounts, baseResp := m.alluxioServiceAccount(ctx)
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+	if assert.Len(t, accounts, 1) {
+		assert.False(t, accounts[0].Internal)
+	}
+
+	//an internal account is never minted on the /admin api, even by an admin
+	request.Account.Internal = true
+	ctx, _ = testWorkerContext(RequestServiceAccountCreate, request, nil)
+	ctx.workerRequest.GinContext.Set(ContextIdentity, Identity{User: "root", Domain: "domain1"})
+	_, baseResp = m.alluxioServiceAccount(ctx)
+	assert.Equal(t, ErrCodeUserDeny, baseResp.ErrCode)
+	assert.Len(t, store.list(), 1)
+
+	ctx, _ = testWorkerContext(RequestInternalAccountCreate, request, nil)
+	accounts, baseResp = m.alluxioServiceAccount(ctx)
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+	if assert.Len(t, accounts, 1) {
+		assert.True(t, accounts[0].Internal)
+	}
+}
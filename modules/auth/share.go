@@ -0,0 +1,490 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+/*********************Sharing, an owner grants read or write on a file or folder of their space****************************/
+
+// Share access, a write grant can read too
+const (
+	ShareRead  = "read"
+	ShareWrite = "write"
+)
+
+// Grantee prefixes, a grantee without one is a user
+const (
+	GranteeRole   = "role:"
+	GranteeDomain = "domain:"
+)
+
+// ShareEveryone policy subject of a share with a whole domain, the matcher of tenants.conf lets it match any user
+const ShareEveryone = "*"
+
+// ErrInvalidGrantee the grantee of a share is not a user, role:<role> or domain:<domain>
+var ErrInvalidGrantee = errors.New("grantee should be a user, role:<role> or domain:<domain>")
+
+// ShareEntry one grant on a shared file or folder
+type ShareEntry struct {
+	Owner         string `json:"owner"`
+	OwnerDomain   string `json:"owner_domain"`
+	Path          string `json:"path"`           //relative to the folder of the owner, usable as file_name with owner
+	Type          string `json:"type"`           //file or directory
+	Grantee       string `json:"grantee"`        //a user or role, domain:<domain> for the whole domain
+	GranteeDomain string `json:"grantee_domain"`
+	Access        string `json:"access"`         //read or write
+}
+
+//shareStore remembers the policies made by share in a json file, the read and write rules an admin wrote
+//in tenants.csv look the same and are never taken for shares
+type shareStore struct {
+	file   string
+	mutex  sync.Mutex
+	grants map[string][]string //sub, dom, obj and act by their key
+}
+
+func newShareStore(file string) (*shareStore, error) {
+	store := &shareStore{
+		file:   file,
+		grants: make(map[string][]string),
+	}
+
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var grants [][]string
+
+	err = json.Unmarshal(data, &grants)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", file)
+	}
+
+	for _, grant := range grants {
+		store.grants[shareKey(grant)] = grant
+	}
+
+	return store, nil
+}
+
+func shareKey(policy []string) string {
+	return strings.Join(policy, "\x00")
+}
+
+//the caller must hold the mutex
+func (s *shareStore) save() error {
+	keys := make([]string, 0, len(s.grants))
+	for key := range s.grants {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	grants := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		grants = append(grants, s.grants[key])
+	}
+
+	data, err := json.MarshalIndent(grants, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.file)
+}
+
+//whether the policy was made by share
+func (s *shareStore) has(policy []string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.grants[shareKey(policy)]
+
+	return ok
+}
+
+func (s *shareStore) add(policies [][]string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, policy := range policies {
+		s.grants[shareKey(policy)] = policy
+	}
+
+	return s.save()
+}
+
+func (s *shareStore) remove(policies [][]string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, policy := range policies {
+		delete(s.grants, shareKey(policy))
+	}
+
+	return s.save()
+}
+
+//the policies among policies that were made by share
+func (m Manager) sharePolicies(policies [][]string) [][]string {
+	var shares [][]string
+
+	for _, policy := range policies {
+		if m.shares.has(policy) {
+			shares = append(shares, policy)
+		}
+	}
+
+	return shares
+}
+
+//the tenant whose space the request works in, owner and owner_domain are set to use a shared file
+func requestOwner(webRequst AlluxioWebRequest) (string, string) {
+	return tenantOrCaller(webRequst.Owner, webRequst.OwnerDomain, webRequst)
+}
+
+//resolve name in the space of the owner of the request
+func resolveRequestObject(webRequst AlluxioWebRequest, name string) (string, error) {
+	owner, ownerDomain := requestOwner(webRequst)
+
+	return resolveObject(ownerDomain, owner, name)
+}
+
+//the policy subject and domain of a grantee, grantee_domain defaults to the domain of the owner
+func parseGrantee(grantee string, granteeDomain string, domain string) (string, string, error) {
+	if granteeDomain == "" {
+		granteeDomain = domain
+	}
+
+	sub := grantee
+	var err error
+
+	switch {
+	case strings.HasPrefix(grantee, GranteeDomain):
+		granteeDomain = strings.TrimPrefix(grantee, GranteeDomain)
+		sub = ShareEveryone
+	case strings.HasPrefix(grantee, GranteeRole):
+		sub = strings.TrimPrefix(grantee, GranteeRole)
+		err = checkTenantName(sub)
+	default:
+		err = checkTenantName(sub)
+	}
+
+	if err != nil || checkTenantName(granteeDomain) != nil {
+		return "", "", errors.Wrapf(ErrInvalidGrantee, "grantee %q of domain %q", grantee, granteeDomain)
+	}
+
+	return sub, granteeDomain, nil
+}
+
+//the policy objects of a share, a folder is granted itself and everything under it
+func shareObjects(object string, folder bool) []string {
+	object = strings.TrimRight(object, "/")
+	if !folder {
+		return []string{object}
+	}
+
+	return []string{object, object + "/*"}
+}
+
+//the access of a grant, a write grant adds read
+func shareActions(access string) []string {
+	if access == ShareWrite {
+		return []string{ShareRead, ShareWrite}
+	}
+
+	return []string{ShareRead}
+}
+
+//the share a policy stands for, false for the policies of tenants and storage classes,
+//the caller keeps to the policies made by share
+func newShareEntry(policy []string) (ShareEntry, bool) {
+	if len(policy) < 4 || policy[3] != ShareRead && policy[3] != ShareWrite {
+		return ShareEntry{}, false
+	}
+
+	sub, dom, obj, act := policy[0], policy[1], policy[2], policy[3]
+
+	entry := ShareEntry{Type: "file", Grantee: sub, GranteeDomain: dom, Access: act}
+
+	if strings.HasSuffix(obj, "/*") {
+		entry.Type = "directory"
+		obj = strings.TrimSuffix(obj, "/*")
+	}
+
+	segments := strings.SplitN(strings.TrimPrefix(obj, "/"), "/", 3)
+	if len(segments) < 2 {
+		return ShareEntry{}, false
+	}
+
+	entry.OwnerDomain = segments[0]
+	entry.Owner = segments[1]
+	if len(segments) == 3 {
+		entry.Path = segments[2]
+	}
+
+	if sub == ShareEveryone {
+		entry.Grantee = GranteeDomain + dom
+	}
+
+	return entry, true
+}
+
+//fold the policies into one entry per path and grantee, keep picks the shares to report
+func collectShares(policies [][]string, keep func(ShareEntry) bool) []ShareEntry {
+	merged := make(map[string]*ShareEntry)
+	keys := []string{}
+
+	for _, policy := range policies {
+		entry, ok := newShareEntry(policy)
+		if !ok || !keep(entry) {
+			continue
+		}
+
+		key := strings.Join([]string{entry.OwnerDomain, entry.Owner, entry.Path, entry.GranteeDomain, entry.Grantee}, "\x00")
+
+		found, ok := merged[key]
+		if !ok {
+			merged[key] = &entry
+			keys = append(keys, key)
+			continue
+		}
+
+		if entry.Type == "directory" {
+			found.Type = entry.Type
+		}
+		if entry.Access == ShareWrite {
+			found.Access = entry.Access
+		}
+	}
+
+	sort.Strings(keys)
+
+	shares := []ShareEntry{}
+	for _, key := range keys {
+		shares = append(shares, *merged[key])
+	}
+
+	return shares
+}
+
+//drop the shares under root and every rule and role of user in domain, called when the space is freed
+//so a tenant of the same name later starts without the access of the old one, the dropped rules are returned
+func (m Manager) revokeShares(root string, user string, domain string) (tenantState, error) {
+	var state tenantState
+
+	for _, policy := range m.rbact.GetPolicy() {
+		share := m.shares.has(policy)
+
+		if share && strings.HasPrefix(policy[2] + "/", root) || policy[0] == user && policy[1] == domain {
+			m.rbact.RemovePolicy(policy[0], policy[1], policy[2], policy[3])
+			state.Policies = append(state.Policies, policy)
+			if share {
+				state.Shares = append(state.Shares, policy)
+			}
+		}
+	}
+
+	for _, rule := range m.rbact.GetGroupingPolicy() {
+		if rule[0] == user && rule[2] == domain {
+			m.rbact.RemoveGroupingPolicy(rule[0], rule[1], rule[2])
+			state.Groupings = append(state.Groupings, rule)
+		}
+	}
+
+	m.rbact.SavePolicy()
+
+	return state, m.shares.remove(state.Shares)
+}
+
+//drop every grant of sub on object made by share, the caller saves the policies
+func (m Manager) removeShare(sub string, subDomain string, object string) error {
+	var shares [][]string
+
+	for _, obj := range shareObjects(object, true) {
+		for _, act := range shareActions(ShareWrite) {
+			policy := []string{sub, subDomain, obj, act}
+			if m.shares.has(policy) {
+				m.rbact.RemovePolicy(sub, subDomain, obj, act)
+				shares = append(shares, policy)
+			}
+		}
+	}
+
+	return m.shares.remove(shares)
+}
+
+//grant or revoke access to file_name of the caller, a share replaces the access the grantee had,
+//unshare revokes both read and write
+func (m Manager) alluxioShare (workerCtx *WorkerContext) BaseResponse {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	object, pathErr := resolveObject(domain, user, webRequst.FileName)
+	share     := workerCtx.workerRequest.Type == RequestAlluxioShare
+	verb      := "unshare"
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return baseResp
+	}
+
+	sub, subDomain, err := parseGrantee(webRequst.Grantee, webRequst.GranteeDomain, domain)
+
+	access := webRequst.Access
+	if access == "" {
+		access = ShareRead
+	}
+
+	if err == nil && access != ShareRead && access != ShareWrite {
+		err = errors.Errorf("access %q should be read or write", access)
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeFailedToParseBody
+		baseResp.ErrInfo = ErrInfoFailedToParseBody
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		return baseResp
+	}
+
+	if share {
+		verb = "share"
+	}
+
+	logger.Infof("User:%s, domain:%s will %s %s to %s of domain %s", user, domain, verb, object, sub, subDomain)
+
+	if m.rbactCheckRights(user, domain, object, "write") {
+		logger.Infof("User:%s, domain:%s was permitted to %s %s", user, domain, verb, object)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to %s %s", user, domain, verb, object)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return baseResp
+	}
+
+	if !share {
+		err = m.removeShare(sub, subDomain, object)
+		m.rbact.SavePolicy()
+
+		if err != nil {
+			baseResp.ErrCode = ErrCodeShareFail
+			baseResp.ErrInfo = ErrInfoShareFail
+			baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+			logger.Errorf("Unshare %s fail: %+v", object, err)
+			return baseResp
+		}
+
+		logger.Infof("User:%s, domain:%s unshared %s to %s of domain %s", user, domain, object, sub, subDomain)
+		return baseResp
+	}
+
+	status, err := m.fs.GetStatus(object)
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeShareFail
+		baseResp.ErrInfo = ErrInfoShareFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Get status of %s fail: %+v", object, err)
+		return baseResp
+	}
+
+	err = m.removeShare(sub, subDomain, object)
+
+	//a rule the grantee had from an admin is left to the admins, only the grants made here are shares
+	var shares [][]string
+	for _, obj := range shareObjects(object, status.Folder) {
+		for _, act := range shareActions(access) {
+			if m.rbact.AddPolicy(sub, subDomain, obj, act) {
+				shares = append(shares, []string{sub, subDomain, obj, act})
+			}
+		}
+	}
+	m.rbact.SavePolicy()
+
+	if err == nil {
+		err = m.shares.add(shares)
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeShareFail
+		baseResp.ErrInfo = ErrInfoShareFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Share %s fail: %+v", object, err)
+		return baseResp
+	}
+
+	logger.Infof("User:%s, domain:%s shared %s to %s of domain %s with %s", user, domain, object, sub, subDomain, access)
+
+	return baseResp
+}
+
+//the shares the caller granted, or was granted directly, by a role or by their domain
+func (m Manager) alluxioListShares (workerCtx *WorkerContext) ([]ShareEntry, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	root, err := resolveTenantRoot(domain, user)
+
+	if err != nil {
+		pathError(&baseResp, err)
+		return nil, baseResp
+	}
+
+	var shares []ShareEntry
+
+	if workerCtx.workerRequest.Type == RequestAlluxioSharedByMe {
+		shares = collectShares(m.sharePolicies(m.rbact.GetPolicy()), func(entry ShareEntry) bool {
+			return strings.HasPrefix("/" + entry.OwnerDomain + "/" + entry.Owner + "/", root)
+		})
+	} else {
+		subjects := map[string]bool{user: true, GranteeDomain + domain: true}
+		for _, role := range m.rbact.GetRolesForUserInDomain(user, domain) {
+			subjects[role] = true
+		}
+
+		shares = collectShares(m.sharePolicies(m.rbact.GetFilteredPolicy(1, domain)), func(entry ShareEntry) bool {
+			return subjects[entry.Grantee] && !strings.HasPrefix("/" + entry.OwnerDomain + "/" + entry.Owner + "/", root)
+		})
+	}
+
+	logger.Infof("User:%s, domain:%s listed %d shares", user, domain, len(shares))
+
+	return shares, baseResp
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGrantee(t *testing.T) {
+	sub, dom, err := parseGrantee("user2", "", "domain1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user2", "domain1"}, []string{sub, dom})
+
+	sub, dom, err = parseGrantee("role:auditors", "domain2", "domain1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"auditors", "domain2"}, []string{sub, dom})
+
+	sub, dom, err = parseGrantee("domain:domain3", "", "domain1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ShareEveryone, "domain3"}, []string{sub, dom})
+
+	for _, grantee := range []string{"", "*", "role:", "domain:", "a/b", "role:.."} {
+		_, _, err = parseGrantee(grantee, "", "domain1")
+		assert.Equal(t, ErrInvalidGrantee, errors.Cause(err), grantee)
+	}
+}
+
+func TestCollectShares(t *testing.T) {
+	policies := [][]string{
+		{"user1", "domain1", "/domain1/user1/*", "*"},
+		{"user1", "domain1", StorageClassObject + "archive", "use"},
+		{"user2", "domain1", "/domain1/user1/reports", "read"},
+		{"user2", "domain1", "/domain1/user1/reports/*", "read"},
+		{"user2", "domain1", "/domain1/user1/reports", "write"},
+		{"user2", "domain1", "/domain1/user1/reports/*", "write"},
+		{"*", "domain2", "/domain1/user1/a.txt", "read"},
+		{"user1", "domain1", "/domain1/user2/b.txt", "read"},
+	}
+
+	byUser1 := collectShares(policies, func(entry ShareEntry) bool {
+		return entry.OwnerDomain == "domain1" && entry.Owner == "user1"
+	})
+
+	assert.Equal(t, []ShareEntry{
+		{Owner: "user1", OwnerDomain: "domain1", Path: "a.txt", Type: "file",
+			Grantee: "domain:domain2", GranteeDomain: "domain2", Access: ShareRead},
+		{Owner: "user1", OwnerDomain: "domain1", Path: "reports", Type: "directory",
+			Grantee: "user2", GranteeDomain: "domain1", Access: ShareWrite},
+	}, byUser1)
+
+	withUser1 := collectShares(policies, func(entry ShareEntry) bool {
+		return entry.Grantee == "user1"
+	})
+
+	assert.Equal(t, []ShareEntry{
+		{Owner: "user2", OwnerDomain: "domain1", Path: "b.txt", Type: "file",
+			Grantee: "user1", GranteeDomain: "domain1", Access: ShareRead},
+	}, withUser1)
+}
+
+func TestRevokeShares(t *testing.T) {
+	m, cleanup := newTestManager(t,
+		"p, user1, domain1, /domain1/user1/*, *",
+		"p, user2, domain1, /domain1/user2/*, *",
+		"p, auditor, domain1, /domain1/user1/logs/*, read",
+		"g, user1, user1, domain1")
+	defer cleanup()
+
+	writeTestFile(t, m.fs, "/domain1/user1/a.txt", "hello")
+	writeTestFile(t, m.fs, "/domain1/user2/b.txt", "world")
+
+	share := func(requestType string, user string, file string, grantee string) {
+		ctx, _ := testWorkerContext(requestType, AlluxioWebRequest{
+			RbactBaseRequest: RbactBaseRequest{User: user, Domain: "domain1"},
+			FileName:         file,
+			Grantee:          grantee,
+		}, nil)
+		assert.Equal(t, ErrCodeOk, m.alluxioShare(ctx).ErrCode)
+	}
+
+	share(RequestAlluxioShare, "user1", "a.txt", "user2")
+	share(RequestAlluxioShare, "user2", "b.txt", "user1")
+
+	//the rule of an admin is not a share, unshare leaves it
+	share(RequestAlluxioUnshare, "user1", "logs", "auditor")
+	assert.True(t, m.rbact.HasPolicy("auditor", "domain1", "/domain1/user1/logs/*", "read"))
+
+	shares := collectShares(m.sharePolicies(m.rbact.GetPolicy()), func(entry ShareEntry) bool { return true })
+	assert.Len(t, shares, 2)
+
+	//the shares of user1 and every rule of user1 go, the admin rule under its folder stays
+	state, err := m.revokeShares("/domain1/user1/", "user1", "domain1")
+	assert.NoError(t, err)
+	assert.Len(t, state.Shares, 2)
+
+	assert.False(t, m.rbact.HasPolicy("user2", "domain1", "/domain1/user1/a.txt", "read"))
+	assert.False(t, m.rbact.HasPolicy("user1", "domain1", "/domain1/user2/b.txt", "read"))
+	assert.False(t, m.rbact.HasPolicy("user1", "domain1", "/domain1/user1/*", "*"))
+	assert.False(t, m.rbact.HasGroupingPolicy("user1", "user1", "domain1"))
+	assert.True(t, m.rbact.HasPolicy("auditor", "domain1", "/domain1/user1/logs/*", "read"))
+	assert.True(t, m.rbact.HasPolicy("user2", "domain1", "/domain1/user2/*", "*"))
+
+	//a new user1 is not granted what the old one was
+	assert.False(t, m.rbactCheckRights("user1", "domain1", "/domain1/user2/b.txt", "read"))
+	assert.Empty(t, m.shares.grants)
+}
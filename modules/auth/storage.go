@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+/*********************Storage backend of Tenants****************************/
+
+// Storage backend names, selected by "storage" in the manager section of tuna.json
+const (
+	StorageAlluxio = "alluxio"
+	StorageMemory  = "memory"
+	StorageLocal   = "local"
+)
+
+// Write types, the same values as Alluxio uses
+const (
+	WriteTypeMustCache    = "MUST_CACHE"
+	WriteTypeCacheThrough = "CACHE_THROUGH"
+	WriteTypeThrough      = "THROUGH"
+	WriteTypeAsyncThrough = "ASYNC_THROUGH"
+)
+
+// Read types, the same values as Alluxio uses
+const (
+	ReadTypeNoCache      = "NO_CACHE"
+	ReadTypeCache        = "CACHE"
+	ReadTypeCachePromote = "CACHE_PROMOTE"
+)
+
+// TTL actions, the same values as Alluxio uses
+const (
+	TTLActionDelete = "DELETE"
+	TTLActionFree   = "FREE"
+)
+
+// Storage errors shared by all backends
+var (
+	ErrStorageNotFound     = errors.New("path does not exist")
+	ErrStorageExists       = errors.New("path already exists")
+	ErrStorageNotEmpty     = errors.New("directory is not empty")
+	ErrStorageNotDirectory = errors.New("parent is not a directory")
+	ErrStorageBadStream    = errors.New("stream id is invalid")
+	ErrStorageNotSupported = errors.New("operation is not supported by the storage backend")
+)
+
+// DirectoryOption options of CreateDirectory
+type DirectoryOption struct {
+	WriteType   string
+	Recursive   bool
+	AllowExists bool
+}
+
+// FileOption options of CreateFile
+type FileOption struct {
+	WriteType string
+}
+
+// OpenOption options of OpenFile
+type OpenOption struct {
+	Offset   int64  //the first Read of the stream starts here
+	ReadType string //how the read is cached, empty is the default of the storage
+}
+
+// DeleteOption options of Delete
+type DeleteOption struct {
+	Recursive bool
+}
+
+// AttributeOption options of SetAttribute, a nil field is left as it is
+type AttributeOption struct {
+	TTL       *int64 //milliseconds after creation, -1 removes the ttl
+	TTLAction string
+	Pinned    *bool
+	Recursive bool
+}
+
+// FreeOption options of Free
+type FreeOption struct {
+	Recursive bool
+}
+
+// FileStatus file or directory information returned by a backend
+type FileStatus struct {
+	Name                   string
+	Path                   string
+	Length                 int64
+	BlockSizeBytes         int64
+	Folder                 bool
+	CreationTimeMs         int64
+	LastModificationTimeMs int64
+	InMemoryPercentage     int32
+	Persisted              bool
+	PersistenceState       string
+	Pinned                 bool
+	TTL                    int64
+	TTLAction              string
+}
+
+// StorageBackend is the file system behind Manager.fs, files are accessed by stream id like the Alluxio proxy
+type StorageBackend interface {
+	CreateDirectory(path string, opt *DirectoryOption) error
+	CreateFile(path string, opt *FileOption) (int, error)
+	OpenFile(path string, opt *OpenOption) (int, error)
+	Read(id int) (io.ReadCloser, error)
+	Write(id int, input io.Reader) (int, error)
+	Close(id int) error
+	Delete(path string, opt *DeleteOption) error
+	Rename(src string, dst string) error
+	ListStatus(path string) ([]FileStatus, error)
+	GetStatus(path string) (FileStatus, error)
+	SetAttribute(path string, opt *AttributeOption) error
+	Free(path string, opt *FreeOption) error
+}
+
+//create the storage backend configured in tuna.json
+func newStorageBackend(config Config) (StorageBackend, error) {
+	switch config.Storage {
+	case StorageAlluxio:
+		if len(config.Clusters) == 0 {
+			return newAlluxioBackend(config.Alluxio.Host, config.Alluxio.Port, config.Alluxio.Timeout), nil
+		}
+		return newRouterBackend(config)
+	case StorageMemory:
+		return newMemoryBackend(), nil
+	case StorageLocal:
+		return newLocalBackend(config.LocalRoot)
+	}
+
+	return nil, errors.Errorf("unknown storage backend %q", config.Storage)
+}
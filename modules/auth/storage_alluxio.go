@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	alluxio "github.com/Alluxio/alluxio-go"
+	"github.com/Alluxio/alluxio-go/option"
+	"github.com/Alluxio/alluxio-go/wire"
+	"github.com/pkg/errors"
+)
+
+/*********************Alluxio storage backend, talks to the Alluxio REST proxy****************************/
+
+type alluxioBackend struct {
+	client *alluxio.Client
+	s3     string //s3 api of the proxy, the streams of the paths api cannot seek but a ranged GET can
+	http   *http.Client
+	mutex  sync.Mutex
+	ranges map[int]io.ReadCloser //streams opened at an offset, their ids are negative not to clash with the proxy
+	lastID int
+}
+
+//timeout is in milliseconds
+func newAlluxioBackend(host string, port int, timeout int) *alluxioBackend {
+	return &alluxioBackend{
+		client: alluxio.NewClient(host, port, time.Duration(timeout)*time.Millisecond),
+		s3:     "http://" + net.JoinHostPort(host, strconv.Itoa(port)) + "/api/v1/s3",
+		//the timeout bounds the wait for the headers, not the transfer of the body
+		http:   &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: time.Duration(timeout) * time.Millisecond}},
+		ranges: make(map[int]io.ReadCloser),
+	}
+}
+
+func alluxioWriteType(writeType string) *wire.WriteType {
+	if writeType == "" {
+		return nil
+	}
+
+	wt := new(wire.WriteType)
+	*wt = wire.WriteType(writeType)
+
+	return wt
+}
+
+func (a *alluxioBackend) CreateDirectory(path string, opt *DirectoryOption) error {
+	allowExists := opt.AllowExists
+	recursive := opt.Recursive
+
+	return a.client.CreateDirectory(path, &option.CreateDirectory{
+		AllowExists: &allowExists,
+		Recursive:   &recursive,
+		WriteType:   alluxioWriteType(opt.WriteType),
+	})
+}
+
+func (a *alluxioBackend) CreateFile(path string, opt *FileOption) (int, error) {
+	return a.client.CreateFile(path, &option.CreateFile{WriteType: alluxioWriteType(opt.WriteType)})
+}
+
+func (a *alluxioBackend) OpenFile(path string, opt *OpenOption) (int, error) {
+	openFile := &option.OpenFile{}
+	if opt.ReadType != "" {
+		readType := wire.ReadType(opt.ReadType)
+		openFile.ReadType = &readType
+	}
+
+	if opt.Offset > 0 {
+		return a.openRange(path, opt.Offset)
+	}
+
+	return a.client.OpenFile(path, openFile)
+}
+
+//open path at offset with a ranged GET on the s3 api, the first directory is the bucket
+func (a *alluxioBackend) openRange(path string, offset int64) (int, error) {
+	u := &url.URL{Path: path}
+
+	req, err := http.NewRequest(http.MethodGet, a.s3+u.EscapedPath(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			return 0, ErrStorageNotFound
+		}
+
+		return 0, errors.Errorf("ranged read of %s from %d: %s", path, offset, resp.Status)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.lastID--
+	a.ranges[a.lastID] = resp.Body
+
+	return a.lastID, nil
+}
+
+func (a *alluxioBackend) Read(id int) (io.ReadCloser, error) {
+	if id >= 0 {
+		return a.client.Read(id)
+	}
+
+	a.mutex.Lock()
+	body, ok := a.ranges[id]
+	a.mutex.Unlock()
+
+	if !ok {
+		return nil, ErrStorageBadStream
+	}
+
+	return body, nil
+}
+
+func (a *alluxioBackend) Write(id int, input io.Reader) (int, error) {
+	return a.client.Write(id, input)
+}
+
+func (a *alluxioBackend) Close(id int) error {
+	if id >= 0 {
+		return a.client.Close(id)
+	}
+
+	a.mutex.Lock()
+	body, ok := a.ranges[id]
+	delete(a.ranges, id)
+	a.mutex.Unlock()
+
+	if !ok {
+		return ErrStorageBadStream
+	}
+
+	return body.Close()
+}
+
+func (a *alluxioBackend) Delete(path string, opt *DeleteOption) error {
+	recursive := opt.Recursive
+
+	return a.client.Delete(path, &option.Delete{Recursive: &recursive})
+}
+
+func (a *alluxioBackend) SetAttribute(path string, opt *AttributeOption) error {
+	recursive := opt.Recursive
+	attribute := &option.SetAttribute{TTL: opt.TTL, Pinned: opt.Pinned, Recursive: &recursive}
+
+	if opt.TTLAction != "" {
+		action := wire.TTLAction(opt.TTLAction)
+		attribute.TTLAction = &action
+	}
+
+	return a.client.SetAttribute(path, attribute)
+}
+
+func (a *alluxioBackend) Free(path string, opt *FreeOption) error {
+	recursive := opt.Recursive
+
+	return a.client.Free(path, &option.Free{Recursive: &recursive})
+}
+
+func (a *alluxioBackend) Rename(src string, dst string) error {
+	return a.client.Rename(src, dst, &option.Rename{})
+}
+
+func (a *alluxioBackend) ListStatus(path string) ([]FileStatus, error) {
+	infos, err := a.client.ListStatus(path, &option.ListStatus{})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]FileStatus, 0, len(infos))
+	for _, info := range infos {
+		statuses = append(statuses, alluxioFileStatus(info))
+	}
+
+	return statuses, nil
+}
+
+func (a *alluxioBackend) GetStatus(path string) (FileStatus, error) {
+	info, err := a.client.GetStatus(path, &option.GetStatus{})
+	if err != nil {
+		return FileStatus{}, err
+	}
+
+	return alluxioFileStatus(info), nil
+}
+
+func alluxioFileStatus(info wire.FileInfo) FileStatus {
+	return FileStatus{
+		Name:                   info.Name,
+		Path:                   info.Path,
+		Length:                 info.Length,
+		BlockSizeBytes:         info.BlockSizeBytes,
+		Folder:                 info.Folder,
+		CreationTimeMs:         info.CreationTimeMs,
+		LastModificationTimeMs: info.LastModificationTimeMs,
+		InMemoryPercentage:     info.InMemoryPercentage,
+		Persisted:              info.Persisted,
+		PersistenceState:       info.PersistenceState,
+		Pinned:                 info.Pinned,
+		TTL:                    info.Ttl,
+		TTLAction:              string(info.TtlAction),
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlluxioBackendRangedRead(t *testing.T) {
+	content := "0123456789"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/s3/domain1/user1/a b.txt" {
+			http.NotFound(w, r)
+			return
+		}
+
+		//the proxy serves the object from the offset, the file is never read from its start
+		http.ServeContent(w, r, "a b.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	assert.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	assert.NoError(t, err)
+
+	fs := newAlluxioBackend(host, portNum, 1000)
+
+	id, err := fs.OpenFile("/domain1/user1/a b.txt", &OpenOption{Offset: 6})
+	assert.NoError(t, err)
+	assert.True(t, id < 0)
+
+	r, err := fs.Read(id)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "6789", string(data))
+
+	assert.NoError(t, fs.Close(id))
+	assert.Equal(t, ErrStorageBadStream, fs.Close(id))
+
+	_, err = fs.OpenFile("/domain1/user1/missing.txt", &OpenOption{Offset: 6})
+	assert.Equal(t, ErrStorageNotFound, err)
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*********************Storage classes, the client or the domain chooses how a file is written to Alluxio****************************/
+
+// Storage classes of a file
+const (
+	StorageClassCache    = "cache"    //MUST_CACHE, kept in Alluxio only, for scratch data
+	StorageClassStandard = "standard" //CACHE_THROUGH, cached and persisted
+	StorageClassArchive  = "archive"  //THROUGH, straight to the under-store
+	StorageClassAsync    = "async"    //ASYNC_THROUGH, cached now and persisted later
+)
+
+// StorageClassObject casbin object of a storage class, p user domain /storage-class/archive use
+// lets the user write archive files
+const StorageClassObject = "/storage-class/"
+
+// Storage class errors
+var (
+	ErrStorageClassUnknown = errors.New("unknown storage class")
+	ErrStorageClassDenied  = errors.New("storage class is not allowed")
+)
+
+var storageClassWriteTypes = map[string]string{
+	StorageClassCache:    WriteTypeMustCache,
+	StorageClassStandard: WriteTypeCacheThrough,
+	StorageClassArchive:  WriteTypeThrough,
+	StorageClassAsync:    WriteTypeAsyncThrough,
+}
+
+func validStorageClass(class string) bool {
+	_, ok := storageClassWriteTypes[class]
+
+	return ok
+}
+
+//the write type a file was most likely written with, guessed from how it is persisted and cached,
+//empty when the backend does not tell
+func statusWriteType(status FileStatus) string {
+	switch status.PersistenceState {
+	case "NOT_PERSISTED":
+		return WriteTypeMustCache
+	case "TO_BE_PERSISTED":
+		return WriteTypeAsyncThrough
+	case "PERSISTED":
+		if status.InMemoryPercentage == 0 {
+			return WriteTypeThrough
+		}
+		return WriteTypeCacheThrough
+	}
+
+	return ""
+}
+
+//the class used when a request does not choose one, viper lower-cases the map keys
+func (m Manager) defaultStorageClass(domain string) string {
+	if class, ok := m.config.DomainStorageClasses[strings.ToLower(domain)]; ok {
+		return class
+	}
+
+	return m.config.StorageClass
+}
+
+//the write type of class for the user, the default class of the domain is always allowed,
+//any other class needs a policy on /storage-class/<class>
+func (m Manager) resolveWriteType(user string, domain string, class string) (string, error) {
+	if class == "" {
+		class = m.defaultStorageClass(domain)
+	}
+
+	writeType, ok := storageClassWriteTypes[class]
+	if !ok {
+		return "", errors.Wrapf(ErrStorageClassUnknown, "storage class %q", class)
+	}
+
+	if class != m.defaultStorageClass(domain) && !m.rbactCheckRights(user, domain, StorageClassObject + class, "use") {
+		return "", errors.Wrapf(ErrStorageClassDenied, "storage class %q", class)
+	}
+
+	return writeType, nil
+}
+
+//the storage class given to a tenant by allocate-res, the default class needs no policy
+func (m Manager) grantStorageClass(user string, domain string, class string) {
+	if class == m.defaultStorageClass(domain) {
+		return
+	}
+
+	m.rbact.AddPolicy(user, domain, StorageClassObject + class, "use")
+	m.rbact.SavePolicy()
+}
+
+//drop the storage classes of a tenant removed by free-res
+func (m Manager) revokeStorageClasses(user string, domain string) {
+	for class := range storageClassWriteTypes {
+		m.rbact.RemovePolicy(user, domain, StorageClassObject + class, "use")
+	}
+	m.rbact.SavePolicy()
+}
+
+//fill the response of a storage class that cannot be used
+func storageClassError(baseResp *BaseResponse, err error) {
+	if errors.Cause(err) == ErrStorageClassDenied {
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.ErrInfo = ErrInfoUserDeny
+	} else {
+		baseResp.ErrCode = ErrCodeInvalidStorageClass
+		baseResp.ErrInfo = ErrInfoInvalidStorageClass
+	}
+	baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+}
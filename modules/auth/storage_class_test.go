@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultStorageClass(t *testing.T) {
+	m := Manager{config: DefaultConfig()}
+	m.config.StorageClass = StorageClassStandard
+	//as viper loads it, the keys are lower case
+	m.config.DomainStorageClasses = map[string]string{"hexmeet": StorageClassArchive}
+
+	assert.Equal(t, StorageClassArchive, m.defaultStorageClass("hexmeet"))
+	assert.Equal(t, StorageClassArchive, m.defaultStorageClass("HexMeet"))
+	assert.Equal(t, StorageClassStandard, m.defaultStorageClass("other"))
+}
+
+func TestResolveWriteType(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, user1, domain1, /storage-class/cache, use")
+	defer cleanup()
+
+	m.config.StorageClass = StorageClassStandard
+	m.config.DomainStorageClasses = map[string]string{"domain2": StorageClassArchive}
+
+	//the default class of the domain needs no rule
+	writeType, err := m.resolveWriteType("user2", "domain1", "")
+	assert.NoError(t, err)
+	assert.Equal(t, WriteTypeCacheThrough, writeType)
+
+	writeType, err = m.resolveWriteType("user2", "Domain2", StorageClassArchive)
+	assert.NoError(t, err)
+	assert.Equal(t, WriteTypeThrough, writeType)
+
+	//any other class needs the use rule of /storage-class/<class>
+	writeType, err = m.resolveWriteType("user1", "domain1", StorageClassCache)
+	assert.NoError(t, err)
+	assert.Equal(t, WriteTypeMustCache, writeType)
+
+	_, err = m.resolveWriteType("user2", "domain1", StorageClassCache)
+	assert.Equal(t, ErrStorageClassDenied, errors.Cause(err))
+	_, err = m.resolveWriteType("user1", "domain1", StorageClassArchive)
+	assert.Equal(t, ErrStorageClassDenied, errors.Cause(err))
+
+	_, err = m.resolveWriteType("user1", "domain1", "gold")
+	assert.Equal(t, ErrStorageClassUnknown, errors.Cause(err))
+
+	//the class given by allocate-res is a use rule
+	m.grantStorageClass("user2", "domain1", StorageClassArchive)
+	_, err = m.resolveWriteType("user2", "domain1", StorageClassArchive)
+	assert.NoError(t, err)
+
+	m.revokeStorageClasses("user2", "domain1")
+	_, err = m.resolveWriteType("user2", "domain1", StorageClassArchive)
+	assert.Equal(t, ErrStorageClassDenied, errors.Cause(err))
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+/*********************Local storage backend, maps /domain/user/ onto a directory tree****************************/
+
+type localStream struct {
+	file  *os.File
+	write bool
+}
+
+type localBackend struct {
+	root    string
+	mutex   sync.Mutex
+	streams map[int]*localStream
+	nextID  int
+}
+
+func newLocalBackend(root string) (*localBackend, error) {
+	err := os.MkdirAll(root, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localBackend{
+		root:    root,
+		streams: make(map[int]*localStream),
+	}, nil
+}
+
+//cleaning against "/" keeps ".." from climbing out of the root
+func (lb *localBackend) localPath(p string) string {
+	return filepath.Join(lb.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+func localError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case os.IsNotExist(err):
+		return ErrStorageNotFound
+	case os.IsExist(err):
+		return ErrStorageExists
+	}
+
+	return err
+}
+
+func (lb *localBackend) addStream(file *os.File, write bool) int {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	lb.nextID++
+	lb.streams[lb.nextID] = &localStream{file: file, write: write}
+
+	return lb.nextID
+}
+
+func (lb *localBackend) stream(id int, write bool) (*localStream, error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	stream, ok := lb.streams[id]
+	if !ok || stream.write != write {
+		return nil, ErrStorageBadStream
+	}
+
+	return stream, nil
+}
+
+func (lb *localBackend) CreateDirectory(p string, opt *DirectoryOption) error {
+	local := lb.localPath(p)
+
+	if info, err := os.Stat(local); err == nil {
+		if info.IsDir() && opt.AllowExists {
+			return nil
+		}
+		return ErrStorageExists
+	}
+
+	if opt.Recursive {
+		return localError(os.MkdirAll(local, 0755))
+	}
+
+	return localError(os.Mkdir(local, 0755))
+}
+
+func (lb *localBackend) CreateFile(p string, opt *FileOption) (int, error) {
+	file, err := os.OpenFile(lb.localPath(p), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, localError(err)
+	}
+
+	return lb.addStream(file, true), nil
+}
+
+func (lb *localBackend) OpenFile(p string, opt *OpenOption) (int, error) {
+	local := lb.localPath(p)
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return 0, localError(err)
+	}
+	if info.IsDir() {
+		return 0, ErrStorageNotFound
+	}
+
+	file, err := os.Open(local)
+	if err != nil {
+		return 0, localError(err)
+	}
+
+	if opt.Offset > 0 {
+		_, err = file.Seek(opt.Offset, io.SeekStart)
+		if err != nil {
+			file.Close()
+			return 0, err
+		}
+	}
+
+	return lb.addStream(file, false), nil
+}
+
+//the file stays open until Close(id), so the reader must not close it
+func (lb *localBackend) Read(id int) (io.ReadCloser, error) {
+	stream, err := lb.stream(id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(stream.file), nil
+}
+
+func (lb *localBackend) Write(id int, input io.Reader) (int, error) {
+	stream, err := lb.stream(id, true)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(stream.file, input)
+
+	return int(n), err
+}
+
+func (lb *localBackend) Close(id int) error {
+	lb.mutex.Lock()
+	stream, ok := lb.streams[id]
+	delete(lb.streams, id)
+	lb.mutex.Unlock()
+
+	if !ok {
+		return ErrStorageBadStream
+	}
+
+	return stream.file.Close()
+}
+
+func (lb *localBackend) Delete(p string, opt *DeleteOption) error {
+	local := lb.localPath(p)
+
+	if local == filepath.Clean(lb.root) {
+		return ErrStorageNotFound
+	}
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return localError(err)
+	}
+
+	if info.IsDir() && !opt.Recursive {
+		names, err := ioutil.ReadDir(local)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			return ErrStorageNotEmpty
+		}
+	}
+
+	return localError(os.RemoveAll(local))
+}
+
+//a local disk has no ttl, the sweeper of tuna expires the files
+func (lb *localBackend) SetAttribute(p string, opt *AttributeOption) error {
+	return ErrStorageNotSupported
+}
+
+//a local disk is not a cache in front of another storage, there is nothing to free
+func (lb *localBackend) Free(p string, opt *FreeOption) error {
+	return ErrStorageNotSupported
+}
+
+func (lb *localBackend) Rename(src string, dst string) error {
+	localSrc := lb.localPath(src)
+	localDst := lb.localPath(dst)
+
+	if _, err := os.Stat(localSrc); err != nil {
+		return localError(err)
+	}
+
+	if _, err := os.Stat(localDst); err == nil {
+		return ErrStorageExists
+	}
+
+	return localError(os.Rename(localSrc, localDst))
+}
+
+func (lb *localBackend) status(p string, info os.FileInfo) FileStatus {
+	modified := info.ModTime().UnixNano() / int64(1000000)
+
+	status := FileStatus{
+		Name:                   info.Name(),
+		Path:                   p,
+		Folder:                 info.IsDir(),
+		CreationTimeMs:         modified,
+		LastModificationTimeMs: modified,
+		Persisted:              true,
+		PersistenceState:       "PERSISTED",
+		TTL:                    -1,
+	}
+
+	if !info.IsDir() {
+		status.Length = info.Size()
+	}
+
+	return status
+}
+
+func (lb *localBackend) ListStatus(p string) ([]FileStatus, error) {
+	p = path.Clean("/" + p)
+	local := lb.localPath(p)
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return nil, localError(err)
+	}
+
+	if !info.IsDir() {
+		return []FileStatus{lb.status(p, info)}, nil
+	}
+
+	infos, err := ioutil.ReadDir(local)
+	if err != nil {
+		return nil, localError(err)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	statuses := make([]FileStatus, 0, len(infos))
+	for _, child := range infos {
+		statuses = append(statuses, lb.status(path.Join(p, child.Name()), child))
+	}
+
+	return statuses, nil
+}
+
+func (lb *localBackend) GetStatus(p string) (FileStatus, error) {
+	p = path.Clean("/" + p)
+
+	info, err := os.Stat(lb.localPath(p))
+	if err != nil {
+		return FileStatus{}, localError(err)
+	}
+
+	return lb.status(p, info), nil
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalBackendFileLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-local")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fs, err := newLocalBackend(filepath.Join(dir, "storage"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, fs.CreateDirectory("/domain1/user1/", &DirectoryOption{Recursive: true}))
+	assert.Equal(t, ErrStorageExists, fs.CreateDirectory("/domain1/", &DirectoryOption{}))
+	assert.NoError(t, fs.CreateDirectory("/domain1/", &DirectoryOption{AllowExists: true}))
+
+	id, err := fs.CreateFile("/domain1/user1/a.txt", &FileOption{})
+	assert.NoError(t, err)
+	n, err := fs.Write(id, strings.NewReader("hello world"))
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+	assert.NoError(t, fs.Close(id))
+
+	_, err = fs.CreateFile("/domain1/user1/a.txt", &FileOption{})
+	assert.Equal(t, ErrStorageExists, err)
+
+	assert.NoError(t, fs.Rename("/domain1/user1/a.txt", "/domain1/user1/b.txt"))
+	_, err = fs.GetStatus("/domain1/user1/a.txt")
+	assert.Equal(t, ErrStorageNotFound, err)
+
+	//a read from an offset seeks the file
+	id, err = fs.OpenFile("/domain1/user1/b.txt", &OpenOption{Offset: 6})
+	assert.NoError(t, err)
+	r, err := fs.Read(id)
+	assert.NoError(t, err)
+	content, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "world", string(content))
+	assert.NoError(t, fs.Close(id))
+	assert.Equal(t, ErrStorageBadStream, fs.Close(id))
+
+	statuses, err := fs.ListStatus("/domain1/user1/")
+	assert.NoError(t, err)
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, "b.txt", statuses[0].Name)
+		assert.Equal(t, "/domain1/user1/b.txt", statuses[0].Path)
+		assert.Equal(t, int64(11), statuses[0].Length)
+	}
+
+	assert.Equal(t, ErrStorageNotEmpty, fs.Delete("/domain1/user1/", &DeleteOption{}))
+	assert.NoError(t, fs.Delete("/domain1/user1/", &DeleteOption{Recursive: true}))
+
+	_, err = fs.GetStatus("/domain1/user1/b.txt")
+	assert.Equal(t, ErrStorageNotFound, err)
+}
+
+func TestLocalBackendStaysInRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-local")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "storage")
+	fs, err := newLocalBackend(root)
+	assert.NoError(t, err)
+
+	//".." is cleaned against the root, it never reaches the directory above
+	id, err := fs.CreateFile("/../../escape.txt", &FileOption{})
+	assert.NoError(t, err)
+	assert.NoError(t, fs.Close(id))
+
+	_, err = os.Stat(filepath.Join(dir, "escape.txt"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "escape.txt"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644))
+	_, err = fs.OpenFile("/domain1/../../secret.txt", &OpenOption{})
+	assert.Equal(t, ErrStorageNotFound, err)
+
+	assert.Equal(t, ErrStorageExists, fs.Rename("/escape.txt", "/.."))
+
+	//the root itself cannot be deleted
+	assert.Equal(t, ErrStorageNotFound, fs.Delete("/..", &DeleteOption{Recursive: true}))
+	assert.Equal(t, ErrStorageNotFound, fs.Delete("/", &DeleteOption{Recursive: true}))
+	_, err = os.Stat(root)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,354 @@
+package auth
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*********************Memory storage backend, for tests and running without Alluxio****************************/
+
+type memoryNode struct {
+	folder   bool
+	data     []byte
+	created  int64
+	modified int64
+}
+
+type memoryStream struct {
+	path   string
+	write  bool
+	offset int
+}
+
+type memoryBackend struct {
+	mutex   sync.Mutex
+	nodes   map[string]*memoryNode
+	streams map[int]*memoryStream
+	nextID  int
+}
+
+func newMemoryBackend() *memoryBackend {
+	now := nowMs()
+
+	return &memoryBackend{
+		nodes:   map[string]*memoryNode{"/": {folder: true, created: now, modified: now}},
+		streams: make(map[int]*memoryStream),
+	}
+}
+
+func nowMs() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+//"/domain/user/" and "/domain/user" are the same node
+func memoryCleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+//the caller must hold the mutex
+func (mb *memoryBackend) checkParent(p string, recursive bool) error {
+	parent := path.Dir(p)
+
+	node, ok := mb.nodes[parent]
+	if ok {
+		if !node.folder {
+			return ErrStorageNotDirectory
+		}
+		return nil
+	}
+
+	if !recursive {
+		return ErrStorageNotFound
+	}
+
+	err := mb.checkParent(parent, recursive)
+	if err != nil {
+		return err
+	}
+
+	now := nowMs()
+	mb.nodes[parent] = &memoryNode{folder: true, created: now, modified: now}
+
+	return nil
+}
+
+func (mb *memoryBackend) CreateDirectory(p string, opt *DirectoryOption) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	p = memoryCleanPath(p)
+
+	if node, ok := mb.nodes[p]; ok {
+		if node.folder && opt.AllowExists {
+			return nil
+		}
+		return ErrStorageExists
+	}
+
+	err := mb.checkParent(p, opt.Recursive)
+	if err != nil {
+		return err
+	}
+
+	now := nowMs()
+	mb.nodes[p] = &memoryNode{folder: true, created: now, modified: now}
+
+	return nil
+}
+
+func (mb *memoryBackend) CreateFile(p string, opt *FileOption) (int, error) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	p = memoryCleanPath(p)
+
+	if _, ok := mb.nodes[p]; ok {
+		return 0, ErrStorageExists
+	}
+
+	err := mb.checkParent(p, false)
+	if err != nil {
+		return 0, err
+	}
+
+	now := nowMs()
+	mb.nodes[p] = &memoryNode{created: now, modified: now}
+
+	mb.nextID++
+	mb.streams[mb.nextID] = &memoryStream{path: p, write: true}
+
+	return mb.nextID, nil
+}
+
+func (mb *memoryBackend) OpenFile(p string, opt *OpenOption) (int, error) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	p = memoryCleanPath(p)
+
+	node, ok := mb.nodes[p]
+	if !ok || node.folder {
+		return 0, ErrStorageNotFound
+	}
+
+	mb.nextID++
+	mb.streams[mb.nextID] = &memoryStream{path: p, offset: int(opt.Offset)}
+
+	return mb.nextID, nil
+}
+
+//like the Alluxio proxy, a read returns the rest of the stream
+func (mb *memoryBackend) Read(id int) (io.ReadCloser, error) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	stream, ok := mb.streams[id]
+	if !ok || stream.write {
+		return nil, ErrStorageBadStream
+	}
+
+	node, ok := mb.nodes[stream.path]
+	if !ok {
+		return nil, ErrStorageNotFound
+	}
+
+	offset := stream.offset
+	if offset > len(node.data) {
+		offset = len(node.data)
+	}
+	stream.offset = len(node.data)
+
+	return ioutil.NopCloser(bytes.NewReader(node.data[offset:])), nil
+}
+
+func (mb *memoryBackend) Write(id int, input io.Reader) (int, error) {
+	mb.mutex.Lock()
+	stream, ok := mb.streams[id]
+	mb.mutex.Unlock()
+
+	if !ok || !stream.write {
+		return 0, ErrStorageBadStream
+	}
+
+	//read outside the lock, the input may be a slow network stream
+	data, err := ioutil.ReadAll(input)
+
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	node, ok := mb.nodes[stream.path]
+	if !ok {
+		return 0, ErrStorageNotFound
+	}
+
+	node.data = append(node.data, data...)
+	node.modified = nowMs()
+
+	return len(data), err
+}
+
+func (mb *memoryBackend) Close(id int) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	if _, ok := mb.streams[id]; !ok {
+		return ErrStorageBadStream
+	}
+
+	delete(mb.streams, id)
+
+	return nil
+}
+
+//the caller must hold the mutex
+func (mb *memoryBackend) children(p string) []string {
+	prefix := p + "/"
+	if p == "/" {
+		prefix = p
+	}
+
+	var children []string
+	for name := range mb.nodes {
+		if name != p && strings.HasPrefix(name, prefix) {
+			children = append(children, name)
+		}
+	}
+
+	sort.Strings(children)
+
+	return children
+}
+
+func (mb *memoryBackend) Delete(p string, opt *DeleteOption) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	p = memoryCleanPath(p)
+
+	if _, ok := mb.nodes[p]; !ok || p == "/" {
+		return ErrStorageNotFound
+	}
+
+	children := mb.children(p)
+	if len(children) > 0 && !opt.Recursive {
+		return ErrStorageNotEmpty
+	}
+
+	for _, child := range children {
+		delete(mb.nodes, child)
+	}
+	delete(mb.nodes, p)
+
+	return nil
+}
+
+//there is no ttl in memory, the sweeper of tuna expires the files
+func (mb *memoryBackend) SetAttribute(p string, opt *AttributeOption) error {
+	return ErrStorageNotSupported
+}
+
+//memory is not a cache in front of another storage, there is nothing to free
+func (mb *memoryBackend) Free(p string, opt *FreeOption) error {
+	return ErrStorageNotSupported
+}
+
+func (mb *memoryBackend) Rename(src string, dst string) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	src = memoryCleanPath(src)
+	dst = memoryCleanPath(dst)
+
+	node, ok := mb.nodes[src]
+	if !ok || src == "/" {
+		return ErrStorageNotFound
+	}
+
+	if _, ok := mb.nodes[dst]; ok {
+		return ErrStorageExists
+	}
+
+	if strings.HasPrefix(dst, src+"/") {
+		return ErrStorageExists
+	}
+
+	err := mb.checkParent(dst, false)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range mb.children(src) {
+		mb.nodes[dst+strings.TrimPrefix(child, src)] = mb.nodes[child]
+		delete(mb.nodes, child)
+	}
+	mb.nodes[dst] = node
+	delete(mb.nodes, src)
+
+	for _, stream := range mb.streams {
+		if stream.path == src || strings.HasPrefix(stream.path, src+"/") {
+			stream.path = dst + strings.TrimPrefix(stream.path, src)
+		}
+	}
+
+	return nil
+}
+
+//the caller must hold the mutex
+func (mb *memoryBackend) status(p string, node *memoryNode) FileStatus {
+	return FileStatus{
+		Name:                   path.Base(p),
+		Path:                   p,
+		Length:                 int64(len(node.data)),
+		Folder:                 node.folder,
+		CreationTimeMs:         node.created,
+		LastModificationTimeMs: node.modified,
+		InMemoryPercentage:     100,
+		PersistenceState:       "NOT_PERSISTED",
+		TTL:                    -1,
+	}
+}
+
+func (mb *memoryBackend) ListStatus(p string) ([]FileStatus, error) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	p = memoryCleanPath(p)
+
+	node, ok := mb.nodes[p]
+	if !ok {
+		return nil, ErrStorageNotFound
+	}
+
+	if !node.folder {
+		return []FileStatus{mb.status(p, node)}, nil
+	}
+
+	var statuses []FileStatus
+	for _, child := range mb.children(p) {
+		if path.Dir(child) == p {
+			statuses = append(statuses, mb.status(child, mb.nodes[child]))
+		}
+	}
+
+	return statuses, nil
+}
+
+func (mb *memoryBackend) GetStatus(p string) (FileStatus, error) {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	p = memoryCleanPath(p)
+
+	node, ok := mb.nodes[p]
+	if !ok {
+		return FileStatus{}, ErrStorageNotFound
+	}
+
+	return mb.status(p, node), nil
+}
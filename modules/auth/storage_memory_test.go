@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBackendFileLifecycle(t *testing.T) {
+	fs := newMemoryBackend()
+
+	assert.NoError(t, fs.CreateDirectory("/domain1/", &DirectoryOption{}))
+	assert.NoError(t, fs.CreateDirectory("/domain1/user1/", &DirectoryOption{}))
+	assert.Equal(t, ErrStorageExists, fs.CreateDirectory("/domain1/", &DirectoryOption{}))
+
+	id, err := fs.CreateFile("/domain1/user1/a.txt", &FileOption{})
+	assert.NoError(t, err)
+	n, err := fs.Write(id, strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.NoError(t, fs.Close(id))
+
+	assert.NoError(t, fs.Rename("/domain1/user1/a.txt", "/domain1/user1/b.txt"))
+
+	id, err = fs.OpenFile("/domain1/user1/b.txt", &OpenOption{})
+	assert.NoError(t, err)
+	r, err := fs.Read(id)
+	assert.NoError(t, err)
+	content, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "hello", string(content))
+	assert.NoError(t, fs.Close(id))
+
+	statuses, err := fs.ListStatus("/domain1/user1/")
+	assert.NoError(t, err)
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, "b.txt", statuses[0].Name)
+		assert.Equal(t, int64(5), statuses[0].Length)
+	}
+
+	assert.Equal(t, ErrStorageNotEmpty, fs.Delete("/domain1/user1/", &DeleteOption{}))
+	assert.NoError(t, fs.Delete("/domain1/user1/", &DeleteOption{Recursive: true}))
+
+	_, err = fs.GetStatus("/domain1/user1/b.txt")
+	assert.Equal(t, ErrStorageNotFound, err)
+}
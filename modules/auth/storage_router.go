@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+/*********************Router storage backend, sends each domain to its own Alluxio cluster****************************/
+
+// DefaultCluster name of the cluster in the "alluxio" section
+const DefaultCluster = "default"
+
+// ErrStorageCrossCluster rename between two clusters
+var ErrStorageCrossCluster = errors.New("source and destination are on different clusters")
+
+type routedStream struct {
+	backend StorageBackend
+	id      int
+}
+
+type routerBackend struct {
+	backends map[string]StorageBackend //cluster name -> backend
+	domains  map[string]string         //domain -> cluster name
+	mutex    sync.Mutex
+	streams  map[int]routedStream
+	nextID   int
+}
+
+func newRouterBackend(config Config) (*routerBackend, error) {
+	rb := &routerBackend{
+		backends: make(map[string]StorageBackend),
+		domains:  make(map[string]string),
+		streams:  make(map[int]routedStream),
+	}
+
+	rb.backends[DefaultCluster] = newAlluxioBackend(config.Alluxio.Host, config.Alluxio.Port, config.Alluxio.Timeout)
+
+	for name, cluster := range config.Clusters {
+		if name == DefaultCluster {
+			return nil, errors.Errorf("cluster name %q is reserved", DefaultCluster)
+		}
+		rb.backends[name] = newAlluxioBackend(cluster.Host, cluster.Port, cluster.Timeout)
+	}
+
+	for domain, name := range config.DomainClusters {
+		if _, ok := rb.backends[name]; !ok {
+			return nil, errors.Errorf("domain %s is mapped to unknown cluster %s", domain, name)
+		}
+		rb.domains[strings.ToLower(domain)] = name
+	}
+
+	return rb, nil
+}
+
+//the first segment of "/domain/user/file" picks the cluster, viper lower-cases the map keys
+//the trash of a domain, "/.tuna-trash/domain/...", is kept on the cluster of the domain so free-res is a rename
+func (rb *routerBackend) route(p string) StorageBackend {
+	segments := strings.SplitN(strings.TrimLeft(p, "/"), "/", 3)
+	domain := segments[0]
+
+	if "/"+domain+"/" == TrashRoot && len(segments) > 1 {
+		domain = segments[1]
+	}
+
+	if name, ok := rb.domains[strings.ToLower(domain)]; ok {
+		return rb.backends[name]
+	}
+
+	return rb.backends[DefaultCluster]
+}
+
+func (rb *routerBackend) addStream(backend StorageBackend, id int) int {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	rb.nextID++
+	rb.streams[rb.nextID] = routedStream{backend: backend, id: id}
+
+	return rb.nextID
+}
+
+func (rb *routerBackend) stream(id int) (routedStream, error) {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	stream, ok := rb.streams[id]
+	if !ok {
+		return stream, ErrStorageBadStream
+	}
+
+	return stream, nil
+}
+
+func (rb *routerBackend) CreateDirectory(p string, opt *DirectoryOption) error {
+	return rb.route(p).CreateDirectory(p, opt)
+}
+
+func (rb *routerBackend) CreateFile(p string, opt *FileOption) (int, error) {
+	backend := rb.route(p)
+
+	id, err := backend.CreateFile(p, opt)
+	if err != nil {
+		return 0, err
+	}
+
+	return rb.addStream(backend, id), nil
+}
+
+func (rb *routerBackend) OpenFile(p string, opt *OpenOption) (int, error) {
+	backend := rb.route(p)
+
+	id, err := backend.OpenFile(p, opt)
+	if err != nil {
+		return 0, err
+	}
+
+	return rb.addStream(backend, id), nil
+}
+
+func (rb *routerBackend) Read(id int) (io.ReadCloser, error) {
+	stream, err := rb.stream(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream.backend.Read(stream.id)
+}
+
+func (rb *routerBackend) Write(id int, input io.Reader) (int, error) {
+	stream, err := rb.stream(id)
+	if err != nil {
+		return 0, err
+	}
+
+	return stream.backend.Write(stream.id, input)
+}
+
+func (rb *routerBackend) Close(id int) error {
+	rb.mutex.Lock()
+	stream, ok := rb.streams[id]
+	delete(rb.streams, id)
+	rb.mutex.Unlock()
+
+	if !ok {
+		return ErrStorageBadStream
+	}
+
+	return stream.backend.Close(stream.id)
+}
+
+func (rb *routerBackend) Delete(p string, opt *DeleteOption) error {
+	return rb.route(p).Delete(p, opt)
+}
+
+func (rb *routerBackend) Rename(src string, dst string) error {
+	backend := rb.route(src)
+
+	if backend != rb.route(dst) {
+		return ErrStorageCrossCluster
+	}
+
+	return backend.Rename(src, dst)
+}
+
+func (rb *routerBackend) SetAttribute(p string, opt *AttributeOption) error {
+	return rb.route(p).SetAttribute(p, opt)
+}
+
+func (rb *routerBackend) Free(p string, opt *FreeOption) error {
+	return rb.route(p).Free(p, opt)
+}
+
+func (rb *routerBackend) ListStatus(p string) ([]FileStatus, error) {
+	dir := strings.TrimRight(p, "/") + "/"
+	if dir != "/" && dir != TrashRoot {
+		return rb.route(p).ListStatus(p)
+	}
+
+	//the root and the trash hold the domains of every cluster, an entry is taken from the cluster
+	//its domain is routed to and a cluster without the folder is skipped
+	var statuses []FileStatus
+	found := false
+	err := ErrStorageNotFound
+
+	for _, backend := range rb.backends {
+		list, listErr := backend.ListStatus(p)
+		if listErr != nil {
+			err = listErr
+			continue
+		}
+
+		for _, status := range list {
+			if rb.route(status.Path) == backend {
+				statuses = append(statuses, status)
+			}
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+func (rb *routerBackend) GetStatus(p string) (FileStatus, error) {
+	return rb.route(p).GetStatus(p)
+}
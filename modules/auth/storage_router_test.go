@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter() (*routerBackend, *memoryBackend, *memoryBackend) {
+	def := newMemoryBackend()
+	other := newMemoryBackend()
+
+	rb := &routerBackend{
+		backends: map[string]StorageBackend{DefaultCluster: def, "other": other},
+		domains:  map[string]string{"domain2": "other"},
+		streams:  make(map[int]routedStream),
+	}
+
+	return rb, def, other
+}
+
+func TestRouterBackendRoutes(t *testing.T) {
+	rb, def, other := newTestRouter()
+
+	assert.NoError(t, rb.CreateDirectory("/domain1/user1", &DirectoryOption{Recursive: true}))
+	assert.NoError(t, rb.CreateDirectory("/domain2/user1", &DirectoryOption{Recursive: true}))
+
+	//a mapped domain goes to its cluster, any other one to the default cluster
+	_, err := def.GetStatus("/domain1/user1")
+	assert.NoError(t, err)
+	_, err = other.GetStatus("/domain1/user1")
+	assert.Equal(t, ErrStorageNotFound, err)
+
+	_, err = other.GetStatus("/domain2/user1")
+	assert.NoError(t, err)
+	_, err = def.GetStatus("/domain2/user1")
+	assert.Equal(t, ErrStorageNotFound, err)
+
+	//the stream ids of the clusters do not clash
+	id1, err := rb.CreateFile("/domain1/user1/a.txt", &FileOption{})
+	assert.NoError(t, err)
+	id2, err := rb.CreateFile("/domain2/user1/a.txt", &FileOption{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+	assert.NoError(t, rb.Close(id1))
+	assert.NoError(t, rb.Close(id2))
+	assert.Equal(t, ErrStorageBadStream, rb.Close(id2))
+
+	assert.Equal(t, ErrStorageCrossCluster, rb.Rename("/domain1/user1/a.txt", "/domain2/user1/b.txt"))
+	assert.NoError(t, rb.Rename("/domain2/user1/a.txt", "/domain2/user1/b.txt"))
+}
+
+func TestRouterBackendTrash(t *testing.T) {
+	rb, def, other := newTestRouter()
+
+	assert.NoError(t, rb.CreateDirectory(TrashRoot+"domain1/user1-1", &DirectoryOption{Recursive: true}))
+	assert.NoError(t, rb.CreateDirectory(TrashRoot+"domain2/user1-1", &DirectoryOption{Recursive: true}))
+
+	//the trash of a domain is kept on the cluster of the domain
+	_, err := def.GetStatus(TrashRoot + "domain1/user1-1")
+	assert.NoError(t, err)
+	_, err = other.GetStatus(TrashRoot + "domain2/user1-1")
+	assert.NoError(t, err)
+
+	//the listing of the trash merges the clusters
+	statuses, err := rb.ListStatus(TrashRoot)
+	assert.NoError(t, err)
+
+	names := []string{}
+	for _, status := range statuses {
+		names = append(names, status.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"domain1", "domain2"}, names)
+
+	rb, _, _ = newTestRouter()
+	_, err = rb.ListStatus(TrashRoot)
+	assert.Equal(t, ErrStorageNotFound, err)
+}
@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+/*********************Time to live of files and directories****************************/
+
+// ErrInvalidTTLAction the ttl_action of a request is not delete or free
+var ErrInvalidTTLAction = errors.New("ttl_action should be delete or free")
+
+//check a ttl action, the default is delete
+func normalizeTTLAction(action string) (string, error) {
+	if action == "" {
+		return TTLActionDelete, nil
+	}
+
+	action = strings.ToUpper(action)
+	if action != TTLActionDelete && action != TTLActionFree {
+		return "", errors.Wrapf(ErrInvalidTTLAction, "ttl_action %q", action)
+	}
+
+	return action, nil
+}
+
+//ttlEntry a ttl kept by tuna for a backend without ttl, it is keyed by path and dropped when tuna deletes the path,
+//the creation time of the backend is not compared as the local backend can only tell the modification time
+type ttlEntry struct {
+	Created int64  `json:"created"` //milliseconds, the ttl counts from here
+	TTL     int64  `json:"ttl"`     //milliseconds after creation
+	Action  string `json:"action"`
+}
+
+func (e ttlEntry) expire() int64 {
+	return e.Created + e.TTL
+}
+
+//ttlStore is the fallback for backends that return ErrStorageNotSupported from SetAttribute,
+//the entries are saved in a json file and swept every minute
+type ttlStore struct {
+	fs      StorageBackend
+	file    string
+	logger  *logp.Logger
+	mutex   sync.Mutex
+	entries map[string]ttlEntry
+}
+
+func newTTLStore(fs StorageBackend, file string, logger *logp.Logger) (*ttlStore, error) {
+	store := &ttlStore{
+		fs:      fs,
+		file:    file,
+		logger:  logger,
+		entries: make(map[string]ttlEntry),
+	}
+
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &store.entries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", file)
+	}
+
+	return store, nil
+}
+
+//the caller must hold the mutex
+func (s *ttlStore) save() error {
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.file)
+}
+
+func (s *ttlStore) set(object string, entry ttlEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries[object] = entry
+
+	return s.save()
+}
+
+func (s *ttlStore) remove(object string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.entries[object]; !ok {
+		return nil
+	}
+	delete(s.entries, object)
+
+	return s.save()
+}
+
+//forget the ttls of object and of everything under it once it is deleted
+func (s *ttlStore) drop(object string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	object = strings.TrimRight(object, "/")
+	dropped := 0
+
+	for path := range s.entries {
+		if path == object || strings.HasPrefix(path, object+"/") {
+			delete(s.entries, path)
+			dropped++
+		}
+	}
+
+	if dropped == 0 {
+		return nil
+	}
+
+	return s.save()
+}
+
+//keep the ttls of src and of everything under it after a rename
+func (s *ttlStore) rename(src string, dst string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	src = strings.TrimRight(src, "/")
+	dst = strings.TrimRight(dst, "/")
+	moved := 0
+
+	for object, entry := range s.entries {
+		if object != src && !strings.HasPrefix(object, src+"/") {
+			continue
+		}
+
+		delete(s.entries, object)
+		s.entries[dst+strings.TrimPrefix(object, src)] = entry
+		moved++
+	}
+
+	if moved == 0 {
+		return nil
+	}
+
+	return s.save()
+}
+
+//add the ttl kept by tuna to a status from the backend
+func (s *ttlStore) fill(status *FileStatus) {
+	if status.TTL > 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	entry, ok := s.entries[strings.TrimRight(status.Path, "/")]
+	s.mutex.Unlock()
+
+	//the creation time of a local file is its modification time, the ttl is given against it
+	//so that the expiry stays the one of the entry
+	if ok {
+		status.TTL = entry.expire() - status.CreationTimeMs
+		if status.TTL < 1 {
+			status.TTL = 1
+		}
+		status.TTLAction = entry.Action
+	}
+}
+
+//run the ttl actions every minute
+func (s *ttlStore) sweep(doneChan chan bool) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-doneChan:
+			return
+		case <-ticker.C:
+		}
+
+		s.expire(nowMs())
+	}
+}
+
+//run the action of the entries whose ttl is over at now
+func (s *ttlStore) expire(now int64) {
+	expired := make(map[string]ttlEntry)
+
+	s.mutex.Lock()
+	for object, entry := range s.entries {
+		if entry.expire() <= now {
+			expired[object] = entry
+		}
+	}
+	s.mutex.Unlock()
+
+	for object, entry := range expired {
+		_, err := s.fs.GetStatus(object)
+
+		switch {
+		case errors.Cause(err) == ErrStorageNotFound:
+			s.logger.Infof("%s is gone, its ttl is dropped", object)
+		case err != nil:
+			s.logger.Errorf("Get status of expired %s fail: %+v", object, err)
+			continue
+		case entry.Action == TTLActionDelete:
+			err = s.fs.Delete(object, &DeleteOption{Recursive: true})
+			if err != nil {
+				s.logger.Errorf("Delete expired %s fail: %+v", object, err)
+				continue
+			}
+			s.logger.Infof("%s expired and was deleted", object)
+		default:
+			//the backend keeps no cache, there is nothing to free
+			s.logger.Infof("%s expired, nothing to free", object)
+		}
+
+		s.remove(object)
+	}
+}
+
+//the ttl in seconds and action of a new file or directory, ttl 0 is the default of the domain,
+//a negative ttl or 0 without a domain default is no ttl
+func (m Manager) resolveTTL(domain string, ttl int64, action string) (int64, string, error) {
+	//viper lower-cases the map keys
+	if ttl == 0 {
+		def := m.config.DomainTTLs[strings.ToLower(domain)]
+		ttl = def.TTL
+		if action == "" {
+			action = def.Action
+		}
+	}
+
+	if ttl <= 0 {
+		return 0, "", nil
+	}
+
+	action, err := normalizeTTLAction(action)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return ttl, action, nil
+}
+
+//set the ttl of object in seconds, counted from its creation like Alluxio does,
+//ttl <= 0 does nothing
+func (m Manager) applyTTL(object string, ttl int64, action string) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	ms := ttl * 1000
+
+	err := m.fs.SetAttribute(object, &AttributeOption{TTL: &ms, TTLAction: action})
+	if errors.Cause(err) != ErrStorageNotSupported {
+		return err
+	}
+
+	status, err := m.fs.GetStatus(object)
+	if err != nil {
+		return err
+	}
+
+	return m.ttls.set(strings.TrimRight(object, "/"), ttlEntry{Created: status.CreationTimeMs, TTL: ms, Action: action})
+}
+
+func (m Manager) removeTTL(object string) error {
+	ms := int64(-1)
+
+	err := m.fs.SetAttribute(object, &AttributeOption{TTL: &ms})
+	if errors.Cause(err) != ErrStorageNotSupported {
+		return err
+	}
+
+	return m.ttls.remove(strings.TrimRight(object, "/"))
+}
+
+//fill the response of a ttl that could not be set
+func ttlError(baseResp *BaseResponse, err error) {
+	if errors.Cause(err) == ErrInvalidTTLAction {
+		baseResp.ErrCode = ErrCodeFailedToParseBody
+		baseResp.ErrInfo = ErrInfoFailedToParseBody
+	} else {
+		baseResp.ErrCode = ErrCodeTTLFail
+		baseResp.ErrInfo = ErrInfoTTLFail
+	}
+	baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+}
+
+//change the ttl of an existing file or directory, a negative ttl removes it
+func (m Manager) alluxioSetTTL (workerCtx *WorkerContext) BaseResponse {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	object, pathErr := resolveObject(domain, user, webRequst.FileName)
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return baseResp
+	}
+
+	if webRequst.TTL == 0 {
+		baseResp.ErrCode = ErrCodeFailedToParseBody
+		baseResp.ErrInfo = ErrInfoFailedToParseBody
+		baseResp.MoreInfo = "ttl should be set, a negative ttl removes it"
+		return baseResp
+	}
+
+	logger.Infof("User:%s, domain:%s will set ttl of %s to %d seconds", user, domain, object, webRequst.TTL)
+
+	if m.rbactCheckRights(user, domain, object, "write") {
+		logger.Infof("User:%s, domain:%s was permitted to set ttl of %s", user, domain, object)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to set ttl of %s", user, domain, object)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return baseResp
+	}
+
+	var err error
+
+	if webRequst.TTL < 0 {
+		err = m.removeTTL(object)
+	} else {
+		var action string
+		action, err = normalizeTTLAction(webRequst.TTLAction)
+		if err == nil {
+			err = m.applyTTL(object, webRequst.TTL, action)
+		}
+	}
+
+	if err != nil {
+		ttlError(&baseResp, err)
+		logger.Errorf("Set ttl of %s fail: %+v", object, err)
+	}
+
+	return baseResp
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func TestTTLStoreFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-ttl")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fs := newMemoryBackend()
+	assert.NoError(t, fs.CreateDirectory("/d1/alice/", &DirectoryOption{Recursive: true}))
+	id, err := fs.CreateFile("/d1/alice/a.txt", &FileOption{})
+	assert.NoError(t, err)
+	_, err = fs.Write(id, strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, fs.Close(id))
+
+	store, err := newTTLStore(fs, filepath.Join(dir, "ttl.json"), logp.NewLogger("ttl"))
+	assert.NoError(t, err)
+	m := Manager{fs: fs, ttls: store}
+
+	//the memory backend has no ttl, tuna keeps it
+	assert.NoError(t, m.applyTTL("/d1/alice/a.txt", 60, TTLActionDelete))
+
+	status, err := fs.GetStatus("/d1/alice/a.txt")
+	assert.NoError(t, err)
+	store.fill(&status)
+	assert.Equal(t, int64(60000), status.TTL)
+	assert.Equal(t, TTLActionDelete, status.TTLAction)
+
+	entry := newFileEntry(status, "/d1/alice/")
+	if assert.NotNil(t, entry.TTLRemaining) {
+		assert.InDelta(t, 60, *entry.TTLRemaining, 1)
+	}
+
+	//the ttl follows a rename and survives a restart
+	assert.NoError(t, fs.Rename("/d1/alice/a.txt", "/d1/alice/b.txt"))
+	assert.NoError(t, store.rename("/d1/alice/a.txt", "/d1/alice/b.txt"))
+
+	store, err = newTTLStore(fs, filepath.Join(dir, "ttl.json"), logp.NewLogger("ttl"))
+	assert.NoError(t, err)
+
+	store.expire(status.CreationTimeMs + 59000)
+	_, err = fs.GetStatus("/d1/alice/b.txt")
+	assert.NoError(t, err)
+
+	store.expire(status.CreationTimeMs + 60000)
+	_, err = fs.GetStatus("/d1/alice/b.txt")
+	assert.Equal(t, ErrStorageNotFound, err)
+	assert.Empty(t, store.entries)
+}
+
+func TestNormalizeTTLAction(t *testing.T) {
+	action, err := normalizeTTLAction("")
+	assert.NoError(t, err)
+	assert.Equal(t, TTLActionDelete, action)
+
+	action, err = normalizeTTLAction("free")
+	assert.NoError(t, err)
+	assert.Equal(t, TTLActionFree, action)
+
+	_, err = normalizeTTLAction("archive")
+	assert.Error(t, err)
+}
+
+func TestTTLStoreLocalBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-ttl")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fs, err := newLocalBackend(filepath.Join(dir, "storage"))
+	assert.NoError(t, err)
+	writeTestFile(t, fs, "/d1/alice/a.txt", "hello")
+
+	store, err := newTTLStore(fs, filepath.Join(dir, "ttl.json"), logp.NewLogger("ttl"))
+	assert.NoError(t, err)
+	m := Manager{fs: fs, ttls: store}
+
+	assert.NoError(t, m.applyTTL("/d1/alice/a.txt", 60, TTLActionDelete))
+	expiry := store.entries["/d1/alice/a.txt"].expire()
+
+	//the local backend reports the modification time, a later write keeps the ttl and its expiry
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "storage", "d1", "alice", "a.txt"), later, later))
+
+	status, err := fs.GetStatus("/d1/alice/a.txt")
+	assert.NoError(t, err)
+	store.fill(&status)
+	assert.Equal(t, TTLActionDelete, status.TTLAction)
+	assert.True(t, status.TTL > 0)
+
+	store.expire(expiry - 1)
+	_, err = fs.GetStatus("/d1/alice/a.txt")
+	assert.NoError(t, err)
+
+	store.expire(expiry)
+	_, err = fs.GetStatus("/d1/alice/a.txt")
+	assert.Equal(t, ErrStorageNotFound, err)
+	assert.Empty(t, store.entries)
+}
+
+func TestTTLStoreDrop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-ttl")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fs := newMemoryBackend()
+	writeTestFile(t, fs, "/d1/alice/docs/a.txt", "hello")
+	writeTestFile(t, fs, "/d1/alice/b.txt", "hello")
+
+	store, err := newTTLStore(fs, filepath.Join(dir, "ttl.json"), logp.NewLogger("ttl"))
+	assert.NoError(t, err)
+	m := Manager{fs: fs, ttls: store}
+
+	assert.NoError(t, m.applyTTL("/d1/alice/docs/a.txt", 60, TTLActionDelete))
+	assert.NoError(t, m.applyTTL("/d1/alice/b.txt", 60, TTLActionDelete))
+
+	//a deleted directory takes the ttls under it, a file created again later starts without one
+	assert.NoError(t, fs.Delete("/d1/alice/docs", &DeleteOption{Recursive: true}))
+	assert.NoError(t, store.drop("/d1/alice/docs/"))
+	writeTestFile(t, fs, "/d1/alice/docs/a.txt", "hello")
+
+	status, err := fs.GetStatus("/d1/alice/docs/a.txt")
+	assert.NoError(t, err)
+	store.fill(&status)
+	assert.True(t, status.TTL <= 0)
+
+	_, ok := store.entries["/d1/alice/b.txt"]
+	assert.True(t, ok)
+}
+
+func TestResolveTTL(t *testing.T) {
+	m := Manager{config: DefaultConfig()}
+	m.config.DomainTTLs = map[string]TTLConfig{"domain1": {TTL: 3600, Action: TTLActionFree}}
+
+	//the keys of the config are lower-cased, the domain of a request may not be
+	ttl, action, err := m.resolveTTL("Domain1", 0, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3600), ttl)
+	assert.Equal(t, TTLActionFree, action)
+
+	ttl, action, err = m.resolveTTL("DOMAIN1", 60, "delete")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(60), ttl)
+	assert.Equal(t, TTLActionDelete, action)
+
+	ttl, _, err = m.resolveTTL("domain1", -1, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), ttl)
+
+	ttl, _, err = m.resolveTTL("domain2", 0, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), ttl)
+}
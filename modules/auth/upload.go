@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+/*********************helpers of upload-file****************************/
+
+// ErrUploadTooLarge the upload is larger than allowed
+var ErrUploadTooLarge = errors.New("upload exceeds the maximum size")
+
+// UploadFileResult result of one file in an upload-file request
+type UploadFileResult struct {
+	FileName string `json:"file_name"`
+	Size     int64  `json:"size"`
+	BaseResponse
+}
+
+//uploadLimitReader counts the bytes read and fails as soon as there are more than limit,
+//so a too large file is stopped while it is being streamed, limit <= 0 means no limit
+type uploadLimitReader struct {
+	reader io.Reader
+	limit  int64
+	count  int64
+	err    error
+}
+
+func newUploadLimitReader(reader io.Reader, limit int64) *uploadLimitReader {
+	return &uploadLimitReader{reader: reader, limit: limit, err: ErrUploadTooLarge}
+}
+
+func (l *uploadLimitReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	l.count += int64(n)
+
+	if l.limit > 0 && l.count > l.limit {
+		return 0, l.err
+	}
+
+	return n, err
+}
+
+//quotaReader reserves the bytes of a write in the quotas as they are read,
+//so the writes running at the same time share what is left of a quota
+type quotaReader struct {
+	reader   io.Reader
+	quotas   *quotaStore
+	usage    *usageTracker
+	object   string
+	reserved int64
+}
+
+func (m Manager) newQuotaReader(reader io.Reader, object string) *quotaReader {
+	return &quotaReader{reader: reader, quotas: m.quotas, usage: m.usage, object: object}
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.reader.Read(p)
+
+	if n > 0 {
+		quotaErr := q.quotas.reserve(q.usage, q.object, int64(n))
+		if quotaErr != nil {
+			return 0, quotaErr
+		}
+		q.reserved += int64(n)
+	}
+
+	return n, err
+}
+
+//end the reservation once the write is over, written is 0 when the file was removed
+func (q *quotaReader) release(written int64) {
+	q.quotas.release(q.usage, q.object, q.reserved, written)
+}
@@ -0,0 +1,607 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"hexmeet.com/haishen/tuna/logp"
+	"hexmeet.com/haishen/tuna/utils"
+)
+
+/*********************Resumable upload sessions, chunks are staged on local disk until finish****************************/
+
+// Upload session errors
+var (
+	ErrUploadSessionNotFound = errors.New("upload session does not exist")
+	ErrUploadSessionBusy     = errors.New("another chunk of the upload session is being written")
+)
+
+// UploadSession a resumable upload, saved as <id>.json next to the staged data <id>.part
+type UploadSession struct {
+	ID      string `json:"id"`
+	User    string `json:"user"`
+	Domain  string `json:"domain"`
+	Object  string `json:"object"`
+	Length  int64  `json:"length"` //declared size of the file, 0 is unknown
+	WriteType string `json:"write_type"` //of the storage class chosen at create
+	TTL       int64  `json:"ttl"`        //seconds, chosen at create
+	TTLAction string `json:"ttl_action"`
+	Offset  int64  `json:"offset"` //bytes received so far
+	Created int64  `json:"created"`
+	Updated int64  `json:"updated"` //unix seconds of the last chunk
+}
+
+//the bytes held in the quotas while the session is open, the declared size or what was received of an unknown one
+func (s UploadSession) reserved() int64 {
+	if s.Length > 0 {
+		return s.Length
+	}
+
+	return s.Offset
+}
+
+//uploadSessionStore keeps the sessions and their staged data, an open session holds its bytes in the quotas
+//so the sessions of a tenant cannot stage more than its quota together
+type uploadSessionStore struct {
+	dir      string
+	expiry   time.Duration
+	quotas   *quotaStore
+	usage    *usageTracker
+	logger   *logp.Logger
+	mutex    sync.Mutex
+	sessions map[string]*UploadSession
+	busy     map[string]bool
+}
+
+//load the sessions left by the last run of tuna, their bytes are held in the quotas again
+func newUploadSessionStore(dir string, expiry time.Duration, quotas *quotaStore, usage *usageTracker,
+	logger *logp.Logger) (*uploadSessionStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &uploadSessionStore{
+		dir:      dir,
+		expiry:   expiry,
+		quotas:   quotas,
+		usage:    usage,
+		logger:   logger,
+		sessions: make(map[string]*UploadSession),
+		busy:     make(map[string]bool),
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			logger.Errorf("Load upload session %s fail: %+v", name, err)
+			continue
+		}
+
+		var session UploadSession
+		err = json.Unmarshal(data, &session)
+		if err != nil || session.ID == "" {
+			logger.Errorf("Parse upload session %s fail: %+v", name, err)
+			continue
+		}
+
+		store.sessions[session.ID] = &session
+		quotas.hold(session.Object, session.reserved())
+	}
+
+	logger.Infof("%d upload sessions were loaded from %s", len(store.sessions), dir)
+
+	return store, nil
+}
+
+func (s *uploadSessionStore) metaPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *uploadSessionStore) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".part")
+}
+
+//the caller must hold the mutex
+func (s *uploadSessionStore) save(session *UploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.metaPath(session.ID) + ".tmp"
+
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.metaPath(session.ID))
+}
+
+//start a session of the file described by proto, the id and times are filled in here,
+//the declared size is reserved in the quotas until the session is finished, aborted or expired
+func (s *uploadSessionStore) create(proto UploadSession) (*UploadSession, error) {
+	now := time.Now().Unix()
+	session := &proto
+	session.ID = utils.NewUUID()
+	session.Offset = 0
+	session.Created = now
+	session.Updated = now
+
+	err := s.quotas.reserve(s.usage, session.Object, session.reserved())
+	if err != nil {
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(s.dataPath(session.ID), nil, 0644)
+	if err != nil {
+		s.quotas.release(s.usage, session.Object, session.reserved(), 0)
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err = s.save(session)
+	if err != nil {
+		os.Remove(s.dataPath(session.ID))
+		s.quotas.release(s.usage, session.Object, session.reserved(), 0)
+		return nil, err
+	}
+
+	s.sessions[session.ID] = session
+
+	return session, nil
+}
+
+//a copy, the session may change under the caller
+func (s *uploadSessionStore) get(id string) (UploadSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return UploadSession{}, ErrUploadSessionNotFound
+	}
+
+	return *session, nil
+}
+
+//mark the session busy so only one chunk or finish runs at a time
+func (s *uploadSessionStore) acquire(id string) (UploadSession, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return UploadSession{}, ErrUploadSessionNotFound
+	}
+
+	if s.busy[id] {
+		return UploadSession{}, ErrUploadSessionBusy
+	}
+	s.busy[id] = true
+
+	return *session, nil
+}
+
+func (s *uploadSessionStore) release(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.busy, id)
+}
+
+//append the chunk at offset, what was received is kept even if the client goes away,
+//the chunks of a session of unknown size are reserved in the quotas as they are read
+func (s *uploadSessionStore) appendChunk(session UploadSession, offset int64, chunk io.Reader, limit int64) (int64, error) {
+	file, err := os.OpenFile(s.dataPath(session.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		return session.Offset, err
+	}
+	defer file.Close()
+
+	//drop the tail of a chunk that was cut before it was recorded
+	err = file.Truncate(offset)
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		return session.Offset, err
+	}
+
+	reader := &quotaReader{reader: newUploadLimitReader(chunk, limit), quotas: s.quotas, usage: s.usage, object: session.Object}
+
+	var n int64
+	var copyErr error
+
+	if session.Length > 0 {
+		n, copyErr = io.Copy(file, reader.reader)
+	} else {
+		n, copyErr = io.Copy(file, reader)
+	}
+
+	if errors.Cause(copyErr) == ErrUploadTooLarge {
+		file.Truncate(offset)
+		reader.release(0)
+		return session.Offset, copyErr
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.sessions[session.ID]
+	if !ok {
+		reader.release(0)
+		return session.Offset, ErrUploadSessionNotFound
+	}
+
+	//what the session holds follows the received bytes, a chunk sent again from an earlier offset gives some back
+	held := stored.reserved() + reader.reserved
+	stored.Offset = offset + n
+	s.quotas.release(s.usage, stored.Object, held - stored.reserved(), 0)
+	stored.Updated = time.Now().Unix()
+
+	err = s.save(stored)
+	if err == nil {
+		err = copyErr
+	}
+
+	return stored.Offset, err
+}
+
+//drop the session and its data, written is the size of the file it was finished as, 0 when it was not
+func (s *uploadSessionStore) remove(id string, written int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if session, ok := s.sessions[id]; ok {
+		s.quotas.release(s.usage, session.Object, session.reserved(), written)
+	}
+
+	delete(s.sessions, id)
+	delete(s.busy, id)
+	os.Remove(s.metaPath(id))
+	os.Remove(s.dataPath(id))
+}
+
+//garbage-collect the sessions without a chunk for longer than expiry
+func (s *uploadSessionStore) collect(doneChan chan bool) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-doneChan:
+			return
+		case <-ticker.C:
+		}
+
+		s.expire(time.Now())
+	}
+}
+
+//remove the sessions idle for longer than expiry at now, a session with a chunk being written is kept
+func (s *uploadSessionStore) expire(now time.Time) {
+	deadline := now.Add(-s.expiry).Unix()
+	var expired []string
+
+	s.mutex.Lock()
+	for id, session := range s.sessions {
+		if session.Updated < deadline && !s.busy[id] {
+			expired = append(expired, id)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, id := range expired {
+		s.logger.Infof("Upload session %s was abandoned, remove it", id)
+		s.remove(id, 0)
+	}
+}
+
+/*****************************upload session requests*********************************************/
+
+func uploadSessionError(baseResp *BaseResponse, err error) {
+	switch errors.Cause(err) {
+	case ErrUploadSessionNotFound, ErrUploadSessionBusy:
+		baseResp.ErrCode = ErrCodeUploadSessionFail
+		baseResp.ErrInfo = ErrInfoUploadSessionFail
+	case ErrUploadTooLarge:
+		baseResp.ErrCode = ErrCodeUploadTooLarge
+		baseResp.ErrInfo = ErrInfoUploadTooLarge
+	case ErrQuotaExceeded:
+		baseResp.ErrCode = ErrCodeQuotaExceeded
+		baseResp.ErrInfo = ErrInfoQuotaExceeded
+	default:
+		baseResp.ErrCode = ErrCodeUploadFileFail
+		baseResp.ErrInfo = ErrInfoUploadFileFail
+	}
+	baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+}
+
+func (m Manager) uploadSessionCreate (workerCtx *WorkerContext) (*UploadSession, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	object, pathErr := resolveObject(domain, user, webRequst.FileName)
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	if pathErr != nil {
+		pathError(&baseResp, pathErr)
+		return nil, baseResp
+	}
+
+	logger.Infof("User:%s, domain:%s will start an upload session of %s", user, domain, object)
+
+	if webRequst.FileName == "" || webRequst.Length < 0 {
+		baseResp.ErrCode = ErrCodeFailedToParseBody
+		baseResp.ErrInfo = ErrInfoFailedToParseBody
+		baseResp.MoreInfo = "file_name should be set and length should not be negative"
+		return nil, baseResp
+	}
+
+	if m.rbactCheckRights(user, domain, object, "write") {
+		logger.Infof("User:%s, domain:%s was permitted to create %s", user, domain, object)
+	} else {
+		logger.Infof("User:%s, domain:%s was denied to create %s", user, domain, object)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return nil, baseResp
+	}
+
+	if m.config.MaxUploadSize > 0 && webRequst.Length > m.config.MaxUploadSize {
+		uploadSessionError(&baseResp, ErrUploadTooLarge)
+		return nil, baseResp
+	}
+
+	writeType, err := m.resolveWriteType(user, domain, webRequst.StorageClass)
+
+	if err != nil {
+		storageClassError(&baseResp, err)
+		return nil, baseResp
+	}
+
+	ttl, ttlAction, err := m.resolveTTL(domain, webRequst.TTL, webRequst.TTLAction)
+
+	if err != nil {
+		ttlError(&baseResp, err)
+		return nil, baseResp
+	}
+
+	session, err := m.uploads.create(UploadSession{
+		User:      user,
+		Domain:    domain,
+		Object:    object,
+		Length:    webRequst.Length,
+		WriteType: writeType,
+		TTL:       ttl,
+		TTLAction: ttlAction,
+	})
+
+	if err != nil {
+		uploadSessionError(&baseResp, err)
+		logger.Errorf("Create upload session fail: %+v", err)
+		return nil, baseResp
+	}
+
+	logger.Infof("Upload session %s of %s was created", session.ID, object)
+
+	return session, baseResp
+}
+
+//PATCH /auth/upload-session/chunk?session_id=&user=&domain= with the Upload-Offset header and the chunk as body
+func (m Manager) uploadSessionChunk (workerCtx *WorkerContext) (*UploadSession, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	c         := workerCtx.workerRequest.GinContext
+	logger    := workerCtx.logger
+	user      := webRequst.User
+	domain    := webRequst.Domain
+	id        := c.Query("session_id")
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	session, err := m.uploads.acquire(id)
+	if err != nil {
+		uploadSessionError(&baseResp, err)
+		return nil, baseResp
+	}
+	defer m.uploads.release(id)
+
+	if session.User != user || session.Domain != domain {
+		logger.Infof("User:%s, domain:%s was denied to write upload session %s", user, domain, id)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return nil, baseResp
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+
+	if err != nil || offset != session.Offset {
+		baseResp.ErrCode = ErrCodeUploadOffsetMismatch
+		baseResp.ErrInfo = ErrInfoUploadOffsetMismatch
+		baseResp.MoreInfo = fmt.Sprintf("Upload-Offset should be %d", session.Offset)
+		return &session, baseResp
+	}
+
+	limit := m.config.MaxUploadSize - offset
+	if session.Length > 0 {
+		limit = session.Length - offset
+	}
+	if limit <= 0 && (session.Length > 0 || m.config.MaxUploadSize > 0) {
+		uploadSessionError(&baseResp, ErrUploadTooLarge)
+		return &session, baseResp
+	}
+
+	session.Offset, err = m.uploads.appendChunk(session, offset, c.Request.Body, limit)
+
+	m.usage.uploaded(session.Domain, session.User, session.Offset - offset)
+
+	if err != nil {
+		uploadSessionError(&baseResp, err)
+		logger.Errorf("Write chunk of upload session %s fail: %+v", id, err)
+		return &session, baseResp
+	}
+
+	logger.Debugf("Upload session %s is at offset %d", id, session.Offset)
+
+	return &session, baseResp
+}
+
+func (m Manager) uploadSessionOffset (workerCtx *WorkerContext) (*UploadSession, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	session, err := m.uploads.get(webRequst.SessionID)
+	if err != nil {
+		uploadSessionError(&baseResp, err)
+		return nil, baseResp
+	}
+
+	if session.User != webRequst.User || session.Domain != webRequst.Domain {
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return nil, baseResp
+	}
+
+	return &session, baseResp
+}
+
+//move the staged data into the storage and drop the session
+func (m Manager) uploadSessionFinish (workerCtx *WorkerContext) (*UploadSession, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	logger    := workerCtx.logger
+	id        := webRequst.SessionID
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	session, err := m.uploads.acquire(id)
+	if err != nil {
+		uploadSessionError(&baseResp, err)
+		return nil, baseResp
+	}
+	defer m.uploads.release(id)
+
+	if session.User != webRequst.User || session.Domain != webRequst.Domain ||
+		!m.rbactCheckRights(session.User, session.Domain, session.Object, "write") {
+		logger.Infof("User:%s, domain:%s was denied to finish upload session %s", webRequst.User, webRequst.Domain, id)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return nil, baseResp
+	}
+
+	if session.Length > 0 && session.Offset != session.Length {
+		baseResp.ErrCode = ErrCodeUploadOffsetMismatch
+		baseResp.ErrInfo = ErrInfoUploadOffsetMismatch
+		baseResp.MoreInfo = fmt.Sprintf("%d of %d bytes were received", session.Offset, session.Length)
+		return &session, baseResp
+	}
+
+	//the bytes of the session are held in the quotas since it was created, they are counted as stored once it is removed
+	staged, err := os.Open(m.uploads.dataPath(id))
+	if err != nil {
+		uploadSessionError(&baseResp, err)
+		return &session, baseResp
+	}
+	defer staged.Close()
+
+	err = m.ensureParent(session.Object)
+
+	fileID := 0
+	if err == nil {
+		fileID, err = m.fs.CreateFile(session.Object, &FileOption{WriteType: session.WriteType})
+	}
+
+	if err != nil {
+		baseResp.ErrCode = ErrCodeCreateFileFail
+		baseResp.ErrInfo = ErrInfoCreateFileFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Create %s of upload session %s fail: %+v", session.Object, id, err)
+		return &session, baseResp
+	}
+
+	_, err = m.fs.Write(fileID, staged)
+	m.fs.Close(fileID)
+
+	if err != nil {
+		m.fs.Delete(session.Object, &DeleteOption{})
+		baseResp.ErrCode = ErrCodeWriteFail
+		baseResp.ErrInfo = ErrInfoWriteFail
+		baseResp.MoreInfo = fmt.Sprintf("Err: %s", err)
+		logger.Errorf("Write %s of upload session %s fail: %+v", session.Object, id, err)
+		return &session, baseResp
+	}
+
+	err = m.applyTTL(session.Object, session.TTL, session.TTLAction)
+
+	if err != nil {
+		m.fs.Delete(session.Object, &DeleteOption{})
+		ttlError(&baseResp, err)
+		logger.Errorf("Set ttl of %s of upload session %s fail: %+v", session.Object, id, err)
+		return &session, baseResp
+	}
+
+	m.uploads.remove(id, session.Offset)
+
+	logger.Infof("Upload session %s was finished as %s with %d bytes", id, session.Object, session.Offset)
+
+	return &session, baseResp
+}
+
+func (m Manager) uploadSessionAbort (workerCtx *WorkerContext) (*UploadSession, BaseResponse) {
+	webRequst := workerCtx.workerRequest.Body.(AlluxioWebRequest)
+	id        := webRequst.SessionID
+
+	baseResp  := BaseResponse {
+		ErrCode: ErrCodeOk,
+		ErrInfo: ErrInfoOk,
+	}
+
+	session, err := m.uploads.acquire(id)
+	if err != nil {
+		uploadSessionError(&baseResp, err)
+		return nil, baseResp
+	}
+
+	if session.User != webRequst.User || session.Domain != webRequst.Domain {
+		m.uploads.release(id)
+		baseResp.ErrCode = ErrCodeUserDeny
+		baseResp.MoreInfo = ErrInfoUserDeny
+		return nil, baseResp
+	}
+
+	m.uploads.remove(id, 0)
+
+	workerCtx.logger.Infof("Upload session %s of %s was aborted", id, session.Object)
+
+	return &session, baseResp
+}
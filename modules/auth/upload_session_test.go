@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func TestUploadSessionStoreReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-sessions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, cleanup := newTestManager(t)
+	defer cleanup()
+
+	store, err := newUploadSessionStore(dir, time.Hour, m.quotas, m.usage, logp.NewLogger("sessions"))
+	assert.NoError(t, err)
+
+	session, err := store.create(UploadSession{User: "user1", Domain: "domain1", Object: "/domain1/user1/a.txt", Length: 10})
+	assert.NoError(t, err)
+
+	offset, err := store.appendChunk(*session, 0, strings.NewReader("hello"), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), offset)
+
+	//a chunk sent again from an earlier offset replaces the tail
+	stored, err := store.get(session.ID)
+	assert.NoError(t, err)
+	offset, err = store.appendChunk(stored, 3, strings.NewReader("LOworld"), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), offset)
+
+	//the sessions survive a restart
+	store, err = newUploadSessionStore(dir, time.Hour, m.quotas, m.usage, logp.NewLogger("sessions"))
+	assert.NoError(t, err)
+
+	stored, err = store.get(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), stored.Offset)
+	assert.Equal(t, "/domain1/user1/a.txt", stored.Object)
+
+	data, err := ioutil.ReadFile(store.dataPath(session.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, "helLOworld", string(data))
+}
+
+func TestUploadSessionStoreOverLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-sessions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, cleanup := newTestManager(t)
+	defer cleanup()
+
+	store, err := newUploadSessionStore(dir, time.Hour, m.quotas, m.usage, logp.NewLogger("sessions"))
+	assert.NoError(t, err)
+
+	session, err := store.create(UploadSession{User: "user1", Domain: "domain1", Object: "/domain1/user1/a.txt", Length: 8})
+	assert.NoError(t, err)
+
+	offset, err := store.appendChunk(*session, 0, strings.NewReader("hello"), 8)
+	assert.NoError(t, err)
+
+	//the chunk over the limit is dropped, the bytes before it are kept
+	stored, _ := store.get(session.ID)
+	offset, err = store.appendChunk(stored, offset, strings.NewReader("world"), 3)
+	assert.Equal(t, ErrUploadTooLarge, errors.Cause(err))
+	assert.Equal(t, int64(5), offset)
+
+	stored, _ = store.get(session.ID)
+	assert.Equal(t, int64(5), stored.Offset)
+
+	info, err := os.Stat(store.dataPath(session.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size())
+}
+
+func TestUploadSessionStoreExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-sessions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, cleanup := newTestManager(t)
+	defer cleanup()
+
+	store, err := newUploadSessionStore(dir, time.Hour, m.quotas, m.usage, logp.NewLogger("sessions"))
+	assert.NoError(t, err)
+
+	idle, err := store.create(UploadSession{User: "user1", Domain: "domain1", Object: "/domain1/user1/a.txt"})
+	assert.NoError(t, err)
+	busy, err := store.create(UploadSession{User: "user1", Domain: "domain1", Object: "/domain1/user1/b.txt"})
+	assert.NoError(t, err)
+	_, err = store.acquire(busy.ID)
+	assert.NoError(t, err)
+
+	store.expire(time.Now().Add(30 * time.Minute))
+	_, err = store.get(idle.ID)
+	assert.NoError(t, err)
+
+	//the idle session is removed with its data, the one with a chunk being written is kept
+	store.expire(time.Now().Add(2 * time.Hour))
+	_, err = store.get(idle.ID)
+	assert.Equal(t, ErrUploadSessionNotFound, err)
+	_, err = os.Stat(store.dataPath(idle.ID))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = store.get(busy.ID)
+	assert.NoError(t, err)
+
+	store.release(busy.ID)
+	store.expire(time.Now().Add(2 * time.Hour))
+	_, err = store.get(busy.ID)
+	assert.Equal(t, ErrUploadSessionNotFound, err)
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Empty(t, names)
+}
+
+func TestUploadSessionChunk(t *testing.T) {
+	m, cleanup := newTestManager(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "tuna-sessions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m.uploads, err = newUploadSessionStore(dir, time.Hour, m.quotas, m.usage, logp.NewLogger("sessions"))
+	assert.NoError(t, err)
+
+	session, err := m.uploads.create(UploadSession{User: "user1", Domain: "domain1", Object: "/domain1/user1/a.txt", Length: 10})
+	assert.NoError(t, err)
+
+	chunk := func(user string, offset string, body string) (*UploadSession, BaseResponse) {
+		ctx, _ := testWorkerContext(RequestUploadSessionChunk, AlluxioWebRequest{RbactBaseRequest: RbactBaseRequest{User: user, Domain: "domain1"}}, nil)
+		req := httptest.NewRequest(http.MethodPatch, "/auth/upload-session/chunk?session_id="+session.ID, strings.NewReader(body))
+		req.Header.Set("Upload-Offset", offset)
+		ctx.workerRequest.GinContext.Request = req
+
+		return m.uploadSessionChunk(ctx)
+	}
+
+	//only the owner of the session writes it
+	_, baseResp := chunk("user2", "0", "hello")
+	assert.Equal(t, ErrCodeUserDeny, baseResp.ErrCode)
+
+	stored, baseResp := chunk("user1", "0", "hello")
+	assert.Equal(t, ErrCodeOk, baseResp.ErrCode)
+	assert.Equal(t, int64(5), stored.Offset)
+
+	//a chunk that does not follow the received bytes is refused with the offset to resume from
+	stored, baseResp = chunk("user1", "3", "world")
+	assert.Equal(t, ErrCodeUploadOffsetMismatch, baseResp.ErrCode)
+	assert.Equal(t, int64(5), stored.Offset)
+}
+
+func TestUploadSessionQuota(t *testing.T) {
+	m, cleanup := newTestManager(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "tuna-sessions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, m.quotas.set("/domain1/user1/", 10))
+	m.uploads, err = newUploadSessionStore(dir, time.Hour, m.quotas, m.usage, logp.NewLogger("sessions"))
+	assert.NoError(t, err)
+
+	//the declared size is held from the create on, a second session does not fit next to it
+	first, err := m.uploads.create(UploadSession{User: "user1", Domain: "domain1", Object: "/domain1/user1/a.txt", Length: 8})
+	assert.NoError(t, err)
+	_, err = m.uploads.create(UploadSession{User: "user1", Domain: "domain1", Object: "/domain1/user1/b.txt", Length: 8})
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(err))
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(m.checkQuota("/domain1/user1/c.txt", 3)))
+
+	//the sessions hold their bytes again after a restart
+	m.quotas.reserved = make(map[string]int64)
+	m.uploads, err = newUploadSessionStore(dir, time.Hour, m.quotas, m.usage, logp.NewLogger("sessions"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), m.quotas.reserved["/domain1/user1/"])
+
+	//an expired session gives its bytes back
+	m.uploads.expire(time.Now().Add(2 * time.Hour))
+	assert.Empty(t, m.quotas.reserved)
+	_, err = m.uploads.get(first.ID)
+	assert.Equal(t, ErrUploadSessionNotFound, err)
+
+	//a session of unknown size holds what it received, up to the quota
+	unknown, err := m.uploads.create(UploadSession{User: "user1", Domain: "domain1", Object: "/domain1/user1/b.txt"})
+	assert.NoError(t, err)
+	offset, err := m.uploads.appendChunk(*unknown, 0, strings.NewReader("hello"), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), m.quotas.reserved["/domain1/user1/"])
+
+	stored, _ := m.uploads.get(unknown.ID)
+	offset, err = m.uploads.appendChunk(stored, offset, strings.NewReader("world!"), 100)
+	assert.Equal(t, ErrQuotaExceeded, errors.Cause(err))
+	assert.Equal(t, int64(5), offset)
+	assert.Equal(t, int64(5), m.quotas.reserved["/domain1/user1/"])
+
+	//an aborted session gives its bytes back without counting them as stored
+	m.uploads.remove(unknown.ID, 0)
+	assert.Empty(t, m.quotas.reserved)
+	assert.Equal(t, int64(0), m.usage.used("/domain1/user1/"))
+}
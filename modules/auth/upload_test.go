@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//a multipart upload-file request of user1 in domain1 with files of the given sizes
+func uploadRequest(t *testing.T, files map[string]int) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	assert.NoError(t, writer.WriteField("user", "user1"))
+	assert.NoError(t, writer.WriteField("domain", "domain1"))
+
+	for name, size := range files {
+		part, err := writer.CreateFormFile("upload", name)
+		assert.NoError(t, err)
+		_, err = part.Write([]byte(strings.Repeat("x", size)))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/upload-file", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return req
+}
+
+func TestUploadFileTooLarge(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, user1, domain1, /domain1/user1/*, *")
+	defer cleanup()
+
+	m.config.MaxUploadSize = 8
+
+	ctx, _ := testWorkerContext(RequestAlluxioUploadFile, AlluxioWebRequest{}, nil)
+	ctx.workerRequest.GinContext.Request = uploadRequest(t, map[string]int{"small.txt": 5, "big.txt": 20})
+
+	results, baseResp := m.alluxioUploadFile(ctx)
+	assert.Equal(t, ErrCodeUploadFileFail, baseResp.ErrCode)
+
+	codes := map[string]int{}
+	for _, result := range results {
+		codes[result.FileName] = result.ErrCode
+	}
+	assert.Equal(t, map[string]int{"small.txt": ErrCodeOk, "big.txt": ErrCodeUploadTooLarge}, codes)
+
+	//the part streamed before the limit was hit is removed
+	_, err := m.fs.GetStatus("/domain1/user1/big.txt")
+	assert.Equal(t, ErrStorageNotFound, err)
+	status, err := m.fs.GetStatus("/domain1/user1/small.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), status.Length)
+}
+
+func TestUploadFileOverQuota(t *testing.T) {
+	m, cleanup := newTestManager(t, "p, user1, domain1, /domain1/user1/*, *")
+	defer cleanup()
+
+	assert.NoError(t, m.quotas.set("/domain1/user1/", 10))
+
+	ctx, _ := testWorkerContext(RequestAlluxioUploadFile, AlluxioWebRequest{}, nil)
+	ctx.workerRequest.GinContext.Request = uploadRequest(t, map[string]int{"big.txt": 20})
+
+	results, _ := m.alluxioUploadFile(ctx)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, ErrCodeQuotaExceeded, results[0].ErrCode)
+		assert.Equal(t, ErrInfoQuotaExceeded, results[0].ErrInfo)
+	}
+
+	_, err := m.fs.GetStatus("/domain1/user1/big.txt")
+	assert.Equal(t, ErrStorageNotFound, err)
+}
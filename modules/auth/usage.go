@@ -0,0 +1,527 @@
+package auth
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+/*********************Usage accounting, stored bytes from scans and daily traffic from the handlers****************************/
+
+// UsageDayFormat layout of the days of the traffic counters
+const UsageDayFormat = "2006-01-02"
+
+// StoredUsage bytes and files of a tenant found by the last scan
+type StoredUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// TrafficUsage bytes moved through tuna by a tenant in one day
+type TrafficUsage struct {
+	Uploaded   int64 `json:"uploaded"`
+	Downloaded int64 `json:"downloaded"`
+}
+
+//usageState is what is saved in the usage file, tenants are keyed by domain/user like their folders,
+//the domain itself is domain/domain, the files right in a domain folder are kept under domain/
+type usageState struct {
+	ScannedAt int64                               `json:"scanned_at"` //unix seconds of the last scan
+	Stored    map[string]StoredUsage              `json:"stored"`
+	Traffic   map[string]map[string]*TrafficUsage `json:"traffic"` //day -> tenant -> traffic
+}
+
+type usageTracker struct {
+	fs        StorageBackend
+	file      string
+	interval  time.Duration
+	retention int
+	logger    *logp.Logger
+	mutex     sync.Mutex
+	state     usageState
+	written   map[string]int64 //bytes written, or removed when negative, by tenant since the last scan started
+}
+
+func newUsageTracker(fs StorageBackend, file string, interval time.Duration, retention int, logger *logp.Logger) (*usageTracker, error) {
+	tracker := &usageTracker{
+		fs:        fs,
+		file:      file,
+		interval:  interval,
+		retention: retention,
+		logger:    logger,
+		state: usageState{
+			Stored:  make(map[string]StoredUsage),
+			Traffic: make(map[string]map[string]*TrafficUsage),
+		},
+		written: make(map[string]int64),
+	}
+
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return tracker, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &tracker.state)
+	if err != nil {
+		return nil, err
+	}
+
+	if tracker.state.Stored == nil {
+		tracker.state.Stored = make(map[string]StoredUsage)
+	}
+	if tracker.state.Traffic == nil {
+		tracker.state.Traffic = make(map[string]map[string]*TrafficUsage)
+	}
+
+	return tracker, nil
+}
+
+//the traffic of a tenant is keyed like the files of its folder, a domain has its files in /domain/domain/
+func usageKey(domain string, user string) string {
+	return domain + "/" + user
+}
+
+//count the traffic of a tenant in today's counters
+func (u *usageTracker) count(domain string, user string, uploaded int64, downloaded int64) {
+	if uploaded == 0 && downloaded == 0 {
+		return
+	}
+
+	day := time.Now().Format(UsageDayFormat)
+	key := usageKey(domain, user)
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	tenants, ok := u.state.Traffic[day]
+	if !ok {
+		tenants = make(map[string]*TrafficUsage)
+		u.state.Traffic[day] = tenants
+	}
+
+	traffic, ok := tenants[key]
+	if !ok {
+		traffic = &TrafficUsage{}
+		tenants[key] = traffic
+	}
+
+	traffic.Uploaded += uploaded
+	traffic.Downloaded += downloaded
+}
+
+func (u *usageTracker) uploaded(domain string, user string, n int64) {
+	u.count(domain, user, n, 0)
+}
+
+func (u *usageTracker) downloaded(domain string, user string, n int64) {
+	u.count(domain, user, 0, n)
+}
+
+//the tenant a stored file is counted in, false for the files outside of the domains
+func storedKey(object string) (string, bool) {
+	segments := strings.SplitN(strings.TrimPrefix(object, "/"), "/", 3)
+	if len(segments) < 2 || strings.HasPrefix(segments[0], ReservedPrefix) {
+		return "", false
+	}
+
+	key := segments[0] + "/"
+	if len(segments) == 3 {
+		key += segments[1]
+	}
+
+	return key, true
+}
+
+//count n bytes written to object, or removed when n is negative, until a scan finds them
+func (u *usageTracker) stored(object string, n int64) {
+	key, ok := storedKey(object)
+	if !ok || n == 0 {
+		return
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.written[key] += n
+	if u.written[key] == 0 {
+		delete(u.written, key)
+	}
+}
+
+//bytes in the tenant folder root, /domain/ or /domain/user/, found by the last scan and written since
+func (u *usageTracker) used(root string) int64 {
+	parts := strings.SplitN(strings.Trim(root, "/"), "/", 2)
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	total := int64(0)
+
+	if len(parts) == 2 {
+		key := parts[0] + "/" + parts[1]
+		total = u.state.Stored[key].Bytes + u.written[key]
+	} else {
+		prefix := parts[0] + "/"
+		for key, usage := range u.state.Stored {
+			if strings.HasPrefix(key, prefix) {
+				total += usage.Bytes
+			}
+		}
+		for key, n := range u.written {
+			if strings.HasPrefix(key, prefix) {
+				total += n
+			}
+		}
+	}
+
+	if total < 0 {
+		total = 0
+	}
+
+	return total
+}
+
+//walk dir and add every file to the tenant it belongs to
+func (u *usageTracker) walk(dir string, stored map[string]StoredUsage) error {
+	statuses, err := u.fs.ListStatus(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if status.Folder {
+			err = u.walk(status.Path, stored)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		key, ok := storedKey(status.Path)
+		if !ok {
+			continue
+		}
+
+		usage := stored[key]
+		usage.Bytes += status.Length
+		usage.Files++
+		stored[key] = usage
+	}
+
+	return nil
+}
+
+//scan the whole storage with ListStatus and replace the stored figures, the writes counted before
+//the scan started are in the figures now, a write during the scan may be counted twice until the next one
+func (u *usageTracker) scan() error {
+	stored := make(map[string]StoredUsage)
+	started := time.Now()
+
+	u.mutex.Lock()
+	counted := make(map[string]int64, len(u.written))
+	for key, n := range u.written {
+		counted[key] = n
+	}
+	u.mutex.Unlock()
+
+	err := u.walk("/", stored)
+	if err != nil {
+		return err
+	}
+
+	u.mutex.Lock()
+	u.state.Stored = stored
+	u.state.ScannedAt = time.Now().Unix()
+	for key, n := range counted {
+		u.written[key] -= n
+		if u.written[key] == 0 {
+			delete(u.written, key)
+		}
+	}
+	u.mutex.Unlock()
+
+	u.logger.Infof("Usage of %d tenants was scanned in %s", len(stored), time.Since(started))
+
+	return u.save()
+}
+
+//drop the traffic older than the retention and write the usage file
+func (u *usageTracker) save() error {
+	oldest := time.Now().AddDate(0, 0, -u.retention).Format(UsageDayFormat)
+
+	u.mutex.Lock()
+	for day := range u.state.Traffic {
+		if day < oldest {
+			delete(u.state.Traffic, day)
+		}
+	}
+
+	data, err := json.Marshal(u.state)
+	u.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	tmp := u.file + ".tmp"
+
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, u.file)
+}
+
+//scan at start and every interval, the counters are saved every minute
+func (u *usageTracker) run(doneChan chan bool) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	nextScan := time.Now()
+
+	for {
+		if !time.Now().Before(nextScan) {
+			err := u.scan()
+			if err != nil {
+				u.logger.Errorf("Scan usage fail: %+v", err)
+			}
+			nextScan = time.Now().Add(u.interval)
+		} else {
+			err := u.save()
+			if err != nil {
+				u.logger.Errorf("Save usage fail: %+v", err)
+			}
+		}
+
+		select {
+		case <-doneChan:
+			u.save()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// TenantUsage usage of a tenant in a report, user is empty for the files right in the domain folder
+// and for the total of the domain
+type TenantUsage struct {
+	Domain string `json:"domain"`
+	User   string `json:"user"`
+	Total  bool   `json:"total"` //the sum of the domain
+	StoredUsage
+	TrafficUsage
+}
+
+// DailyUsage traffic of a tenant in one day
+type DailyUsage struct {
+	Day    string `json:"day"`
+	Domain string `json:"domain"`
+	User   string `json:"user"`
+	TrafficUsage
+}
+
+// UsageReportResponse body of /usage-report
+type UsageReportResponse struct {
+	BaseResponse
+	ScannedAt int64         `json:"scanned_at"`
+	From      string        `json:"from"`
+	To        string        `json:"to"`
+	Tenants   []TenantUsage `json:"tenants"`
+	Daily     []DailyUsage  `json:"daily"`
+}
+
+//build the report of the days from..to, domain and user filter the tenants when set
+func (u *usageTracker) report(domain string, user string, from string, to string) UsageReportResponse {
+	rsp := UsageReportResponse{
+		BaseResponse: BaseResponse{ErrCode: ErrCodeOk, ErrInfo: ErrInfoOk},
+		From:         from,
+		To:           to,
+		Tenants:      []TenantUsage{},
+		Daily:        []DailyUsage{},
+	}
+
+	match := func(key string) (string, string, bool) {
+		parts := strings.SplitN(key, "/", 2)
+		if domain != "" && parts[0] != domain {
+			return "", "", false
+		}
+		if user != "" && parts[1] != user {
+			return "", "", false
+		}
+		return parts[0], parts[1], true
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	rsp.ScannedAt = u.state.ScannedAt
+	tenants := make(map[string]*TenantUsage)
+
+	tenant := func(key string) *TenantUsage {
+		if t, ok := tenants[key]; ok {
+			return t
+		}
+		d, usr, _ := match(key)
+		t := &TenantUsage{Domain: d, User: usr}
+		tenants[key] = t
+		return t
+	}
+
+	for key, stored := range u.state.Stored {
+		if _, _, ok := match(key); ok {
+			tenant(key).StoredUsage = stored
+		}
+	}
+
+	for day, traffic := range u.state.Traffic {
+		if day < from || day > to {
+			continue
+		}
+
+		for key, usage := range traffic {
+			d, usr, ok := match(key)
+			if !ok {
+				continue
+			}
+
+			t := tenant(key)
+			t.Uploaded += usage.Uploaded
+			t.Downloaded += usage.Downloaded
+
+			rsp.Daily = append(rsp.Daily, DailyUsage{Day: day, Domain: d, User: usr, TrafficUsage: *usage})
+		}
+	}
+
+	totals := make(map[string]*TenantUsage)
+	for _, t := range tenants {
+		rsp.Tenants = append(rsp.Tenants, *t)
+
+		total, ok := totals[t.Domain]
+		if !ok {
+			total = &TenantUsage{Domain: t.Domain, Total: true}
+			totals[t.Domain] = total
+		}
+		total.Bytes += t.Bytes
+		total.Files += t.Files
+		total.Uploaded += t.Uploaded
+		total.Downloaded += t.Downloaded
+	}
+
+	//a report of one user has no domain total
+	if user == "" {
+		for _, total := range totals {
+			rsp.Tenants = append(rsp.Tenants, *total)
+		}
+	}
+
+	sort.Slice(rsp.Tenants, func(i, j int) bool {
+		a, b := rsp.Tenants[i], rsp.Tenants[j]
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		if a.Total != b.Total {
+			return b.Total
+		}
+		return a.User < b.User
+	})
+
+	sort.Slice(rsp.Daily, func(i, j int) bool {
+		a, b := rsp.Daily[i], rsp.Daily[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		return a.User < b.User
+	})
+
+	return rsp
+}
+
+//GET /usage-report?domain=&user=&from=2026-01-01&to=2026-01-31&format=csv|csv-daily&refresh=true,
+//the days default to the last 30, refresh scans the storage before the report is built
+func (m Manager) onUsageReport(c *gin.Context) {
+	logger := m.logger.Named("usage")
+
+	to := c.DefaultQuery("to", time.Now().Format(UsageDayFormat))
+	from := c.DefaultQuery("from", time.Now().AddDate(0, 0, -29).Format(UsageDayFormat))
+
+	for _, day := range []string{from, to} {
+		if _, err := time.Parse(UsageDayFormat, day); err != nil {
+			c.JSON(http.StatusBadRequest, BaseResponse{
+				ErrCode:  ErrCodeFailedToParseBody,
+				ErrInfo:  ErrInfoFailedToParseBody,
+				MoreInfo: fmt.Sprintf("day %q should be like %s", day, UsageDayFormat),
+			})
+			return
+		}
+	}
+
+	if c.Query("refresh") == "true" {
+		err := m.usage.scan()
+		if err != nil {
+			logger.Errorf("Scan usage fail: %+v", err)
+			c.JSON(http.StatusOK, BaseResponse{
+				ErrCode:  ErrCodeUsageFail,
+				ErrInfo:  ErrInfoUsageFail,
+				MoreInfo: fmt.Sprintf("Err: %s", err),
+			})
+			return
+		}
+	}
+
+	rsp := m.usage.report(c.Query("domain"), c.Query("user"), from, to)
+
+	switch c.Query("format") {
+	case "csv":
+		records := [][]string{{"domain", "user", "total", "bytes_stored", "file_count", "bytes_uploaded", "bytes_downloaded"}}
+		for _, t := range rsp.Tenants {
+			records = append(records, []string{t.Domain, t.User, strconv.FormatBool(t.Total),
+				strconv.FormatInt(t.Bytes, 10), strconv.FormatInt(t.Files, 10),
+				strconv.FormatInt(t.Uploaded, 10), strconv.FormatInt(t.Downloaded, 10)})
+		}
+		writeCSV(c, fmt.Sprintf("usage-%s-%s.csv", from, to), records)
+
+	case "csv-daily":
+		records := [][]string{{"day", "domain", "user", "bytes_uploaded", "bytes_downloaded"}}
+		for _, d := range rsp.Daily {
+			records = append(records, []string{d.Day, d.Domain, d.User,
+				strconv.FormatInt(d.Uploaded, 10), strconv.FormatInt(d.Downloaded, 10)})
+		}
+		writeCSV(c, fmt.Sprintf("usage-daily-%s-%s.csv", from, to), records)
+
+	default:
+		c.JSON(http.StatusOK, rsp)
+	}
+}
+
+func writeCSV(c *gin.Context, name string, records [][]string) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.WriteAll(records)
+}
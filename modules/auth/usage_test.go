@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hexmeet.com/haishen/tuna/logp"
+)
+
+func TestUsageScanAndReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-usage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fs := newMemoryBackend()
+	for _, file := range []string{"/d1/alice/a.txt", "/d1/alice/x/b.txt", "/d1/bob/c.txt", "/d1/d.txt", "/d1/d1/f.txt", "/d2/carol/e.txt"} {
+		assert.NoError(t, fs.CreateDirectory(file[:strings.LastIndex(file, "/")+1], &DirectoryOption{Recursive: true, AllowExists: true}))
+		id, err := fs.CreateFile(file, &FileOption{})
+		assert.NoError(t, err)
+		_, err = fs.Write(id, strings.NewReader("hello"))
+		assert.NoError(t, err)
+		assert.NoError(t, fs.Close(id))
+	}
+
+	file := filepath.Join(dir, "usage.json")
+	tracker, err := newUsageTracker(fs, file, time.Hour, 30, logp.NewLogger("usage"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, tracker.scan())
+	tracker.uploaded("d1", "alice", 10)
+	tracker.downloaded("d1", "alice", 3)
+	tracker.uploaded("d1", "d1", 7)
+
+	today := time.Now().Format(UsageDayFormat)
+	rsp := tracker.report("d1", "", today, today)
+
+	//the files of the domain tenant in /d1/d1/ and its traffic are one tenant
+	assert.Equal(t, []TenantUsage{
+		{Domain: "d1", User: "", StoredUsage: StoredUsage{Bytes: 5, Files: 1}},
+		{Domain: "d1", User: "alice", StoredUsage: StoredUsage{Bytes: 10, Files: 2}, TrafficUsage: TrafficUsage{Uploaded: 10, Downloaded: 3}},
+		{Domain: "d1", User: "bob", StoredUsage: StoredUsage{Bytes: 5, Files: 1}},
+		{Domain: "d1", User: "d1", StoredUsage: StoredUsage{Bytes: 5, Files: 1}, TrafficUsage: TrafficUsage{Uploaded: 7}},
+		{Domain: "d1", Total: true, StoredUsage: StoredUsage{Bytes: 25, Files: 5}, TrafficUsage: TrafficUsage{Uploaded: 17, Downloaded: 3}},
+	}, rsp.Tenants)
+	assert.Len(t, rsp.Daily, 2)
+
+	//the figures survive a restart
+	assert.NoError(t, tracker.save())
+	tracker, err = newUsageTracker(fs, file, time.Hour, 30, logp.NewLogger("usage"))
+	assert.NoError(t, err)
+
+	rsp = tracker.report("d1", "alice", today, today)
+	assert.Equal(t, []TenantUsage{
+		{Domain: "d1", User: "alice", StoredUsage: StoredUsage{Bytes: 10, Files: 2}, TrafficUsage: TrafficUsage{Uploaded: 10, Downloaded: 3}},
+	}, rsp.Tenants)
+}
+
+func TestUsageScanClusters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuna-usage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	rb, _, _ := newTestRouter()
+	for _, file := range []string{"/domain1/alice/a.txt", "/domain2/bob/b.txt", "/domain2/domain2/c.txt"} {
+		assert.NoError(t, rb.CreateDirectory(file[:strings.LastIndex(file, "/")+1], &DirectoryOption{Recursive: true, AllowExists: true}))
+		id, err := rb.CreateFile(file, &FileOption{})
+		assert.NoError(t, err)
+		_, err = rb.Write(id, strings.NewReader("hello"))
+		assert.NoError(t, err)
+		assert.NoError(t, rb.Close(id))
+	}
+
+	tracker, err := newUsageTracker(rb, filepath.Join(dir, "usage.json"), time.Hour, 30, logp.NewLogger("usage"))
+	assert.NoError(t, err)
+
+	//domain2 lives on another cluster, the scan finds it too
+	assert.NoError(t, tracker.scan())
+	assert.Equal(t, map[string]StoredUsage{
+		"domain1/alice":   {Bytes: 5, Files: 1},
+		"domain2/bob":     {Bytes: 5, Files: 1},
+		"domain2/domain2": {Bytes: 5, Files: 1},
+	}, tracker.state.Stored)
+
+	assert.Equal(t, "domain2/domain2", usageKey("domain2", "domain2"))
+	assert.Equal(t, int64(10), tracker.used("/domain2/"))
+}
@@ -25,31 +25,111 @@ func (m Manager) webListen() {
 	router.Use(static.Serve("/", static.LocalFile("./dist", true)))
 	router.Use(static.Serve("/auth", static.LocalFile("./dist", true)))
 
-	//provide a internal access rest api
-	tuna_v1:= router.Group("/")
+	//provide a internal access rest api, on its own listener unless the address is empty
+	internal := router
+	if m.config.Internal.Address != "" {
+		internal = gin.New()
+		internal.Use(utils.Ginzap(m.logger.Named("internal")))
+		internal.Use(gin.Recovery())
+	} else {
+		m.logger.Warn("The internal api is served on the public port behind its tokens or signatures, set internal.address to move it")
+	}
+
+	tuna_v1:= internal.Group("/")
+	tuna_v1.Use(m.internalAuth())
 	{
 		tuna_v1.POST("/allocate-res", m.alluxioRestCall)
 		tuna_v1.POST("/free-res", m.alluxioRestCall)
+		tuna_v1.POST("/restore-res", m.alluxioRestCall)
+		tuna_v1.POST("/purge-res", m.alluxioRestCall)
+		tuna_v1.POST("/set-quota", m.alluxioRestCall)
+		tuna_v1.POST("/service-account/create", m.alluxioRestCall)
+		tuna_v1.GET("/usage-report", m.onUsageReport)
+	}
+
+	if internal != router {
+		go m.internalListen(internal)
+	}
+
+	//rules of tenants.csv and service accounts for the admins of the config,
+	//the domain admins manage the users and rules of their own domain,
+	//the admin is the caller of the token or signature, never the user of the body
+	tuna_admin := router.Group("/admin")
+	tuna_admin.Use(m.authenticate(), m.requireIdentity())
+	{
+		tuna_admin.POST("/policy/list", m.alluxioRestCall)
+		tuna_admin.POST("/policy/add", m.alluxioRestCall)
+		tuna_admin.POST("/policy/remove", m.alluxioRestCall)
+		tuna_admin.POST("/policy/check", m.alluxioRestCall)
+
+		tuna_admin.POST("/service-account/create", m.alluxioRestCall)
+		tuna_admin.POST("/service-account/remove", m.alluxioRestCall)
+		tuna_admin.POST("/service-account/list", m.alluxioRestCall)
+
+		tuna_admin.POST("/domain/allocate-res", m.alluxioRestCall)
+		tuna_admin.POST("/domain/free-res", m.alluxioRestCall)
+		tuna_admin.POST("/domain/usage", m.alluxioRestCall)
+	}
+
+	if m.bearer == nil {
+		m.logger.Warn("Jwt and oidc are off, the /auth api trusts the user and domain of unsigned bodies")
 	}
 
 	//provide a external access rest api
 	tuna_v2 := router.Group("/auth")
 	{
 		tuna_v2.GET("/ping", m.onPing) //to check the tuna service is accessful
-		tuna_v2.GET("/log-level", m.onGetLogLevel) //get log level
-		tuna_v2.POST("/log-level", m.onSetLogLevel) //set log level
-
-		//tuna_v2.POST("/create-file", m.alluxioRestCall)
-		//tuna_v2.POST("/write-content", m.alluxioRestCall)
-		//tuna_v2.POST("/open-file", m.alluxioRestCall)
-		//tuna_v2.POST("/read-content", m.alluxioRestCall)
-		//tuna_v2.POST("/close-file", m.alluxioRestCall)
+
+		//the routes below need a signature of a service account, or a bearer token when jwt or oidc is enabled
+		tuna_v2.Use(m.authenticate())
+
+		//the log level is for the admins of the config, proven by a token or signature
+		tuna_v2.GET("/log-level", m.requireIdentity(), m.requireAdmin(), m.onGetLogLevel) //get log level
+		tuna_v2.POST("/log-level", m.requireIdentity(), m.requireAdmin(), m.onSetLogLevel) //set log level
+
+		tuna_v2.POST("/create-file", m.alluxioRestCall)
+		tuna_v2.POST("/write-content", m.alluxioRestCall)
+		tuna_v2.POST("/open-file", m.alluxioRestCall)
+		tuna_v2.POST("/read-content", m.alluxioRestCall)
+		tuna_v2.POST("/close-file", m.alluxioRestCall)
 		tuna_v2.POST("/delete-file", m.alluxioRestCall)
 		tuna_v2.POST("/rename-file", m.alluxioRestCall)
+		tuna_v2.POST("/copy-file", m.alluxioRestCall)
+		tuna_v2.POST("/move-file", m.alluxioRestCall)
 		tuna_v2.POST("/upload-file", m.alluxioRestCall)
 		tuna_v2.POST("/read-file", m.alluxioRestCall)
+		tuna_v2.POST("/create-dir", m.alluxioRestCall)
+		tuna_v2.POST("/remove-dir", m.alluxioRestCall)
+		tuna_v2.POST("/list", m.alluxioRestCall)
+		tuna_v2.POST("/stat", m.alluxioRestCall)
+		tuna_v2.POST("/quota", m.alluxioRestCall)
+		tuna_v2.POST("/set-ttl", m.alluxioRestCall)
+		tuna_v2.POST("/presign", m.alluxioRestCall)
+
+		//sharing of files and folders between users
+		tuna_v2.POST("/share", m.alluxioRestCall)
+		tuna_v2.POST("/unshare", m.alluxioRestCall)
+		tuna_v2.POST("/shared-with-me", m.alluxioRestCall)
+		tuna_v2.POST("/shared-by-me", m.alluxioRestCall)
+
+		//cache management of Alluxio
+		tuna_v2.POST("/pin", m.alluxioRestCall)
+		tuna_v2.POST("/unpin", m.alluxioRestCall)
+		tuna_v2.POST("/free", m.alluxioRestCall)
+		tuna_v2.POST("/preload", m.alluxioRestCall)
+
+		//resumable upload of large files
+		tuna_v2.POST("/upload-session/create", m.alluxioRestCall)
+		tuna_v2.PATCH("/upload-session/chunk", m.alluxioRestCall)
+		tuna_v2.POST("/upload-session/offset", m.alluxioRestCall)
+		tuna_v2.POST("/upload-session/finish", m.alluxioRestCall)
+		tuna_v2.POST("/upload-session/abort", m.alluxioRestCall)
 	}
 
+	//presigned urls carry a signature instead of the json body
+	router.GET(PresignedPrefix + "*file_name", m.onPresigned)
+	router.PUT(PresignedPrefix + "*file_name", m.onPresigned)
+
 	portSpec := fmt.Sprintf(":%d", m.config.WebPort)
 
 	router.Run(portSpec)
@@ -43,14 +43,52 @@ func (m Manager) work(workID string) {
 				//m.exampleWorkerHandle(workerCtx) //it has not been run, it is only a example
 			case RequestAlluxioCreateUser,
 				RequestAlluxioDeleteUser,
+				RequestAlluxioRestoreUser,
+				RequestAlluxioPurgeUser,
 			    RequestAlluxioCreateFile,
 				RequestAlluxioWriteContent,
 			    RequestAlluxioOpenFile,
 				RequestAlluxioReadContent,
+				RequestAlluxioCloseFile,
 			    RequestAlluxioDeleteFile,
 			    RequestAlluxioRenameFile,
+				RequestAlluxioCopyFile,
+				RequestAlluxioMoveFile,
+				RequestAlluxioQuota,
+				RequestAlluxioSetQuota,
+				RequestAlluxioSetTTL,
+				RequestAlluxioPresign,
+				RequestPresignedPut,
+				RequestPolicyList,
+				RequestPolicyAdd,
+				RequestPolicyRemove,
+				RequestPolicyCheck,
+				RequestServiceAccountCreate,
+				RequestServiceAccountRemove,
+				RequestServiceAccountList,
+				RequestInternalAccountCreate,
+				RequestDomainCreateUser,
+				RequestDomainDeleteUser,
+				RequestDomainUsage,
+				RequestAlluxioShare,
+				RequestAlluxioUnshare,
+				RequestAlluxioSharedWithMe,
+				RequestAlluxioSharedByMe,
+				RequestAlluxioPin,
+				RequestAlluxioUnpin,
+				RequestAlluxioFree,
+				RequestAlluxioPreload,
 				RequestAlluxioUploadFile,
-				RequestAlluxioReadFile:
+				RequestAlluxioReadFile,
+				RequestAlluxioCreateDir,
+				RequestAlluxioRemoveDir,
+				RequestAlluxioList,
+				RequestAlluxioStat,
+				RequestUploadSessionCreate,
+				RequestUploadSessionChunk,
+				RequestUploadSessionOffset,
+				RequestUploadSessionFinish,
+				RequestUploadSessionAbort:
 				m.alluxioWorkerHandle(workerCtx)
 			default:
 				logger.Errorf("Unexpected worker request type: %s", workerCtx.workerRequest.Type)